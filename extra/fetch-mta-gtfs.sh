@@ -0,0 +1,17 @@
+#!/bin/sh
+# Downloads the MTA's static subway GTFS and puts the schedule files next to
+# vendored/mta/stops.txt, where they are embedded in the next build. Pass a
+# different directory, e.g. $VENDOR_DIR/mta, to use them without rebuilding.
+set -eu
+
+GTFS_URL="${GTFS_URL:-https://rrgtfsfeeds.s3.amazonaws.com/gtfs_subway.zip}"
+DEST="${1:-$(dirname "$0")/../vendored/mta}"
+
+tmp="$(mktemp -d)"
+trap 'rm -rf "$tmp"' EXIT
+
+curl -fsSL -o "$tmp/gtfs.zip" "$GTFS_URL"
+unzip -q -o -d "$tmp" "$tmp/gtfs.zip" routes.txt trips.txt stop_times.txt calendar.txt calendar_dates.txt
+mkdir -p "$DEST"
+mv "$tmp/routes.txt" "$tmp/trips.txt" "$tmp/stop_times.txt" "$tmp/calendar.txt" "$tmp/calendar_dates.txt" "$DEST/"
+echo "wrote the static GTFS schedule to $DEST"
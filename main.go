@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"embed"
 	"flag"
+	"io/fs"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -12,6 +14,14 @@ import (
 	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
 )
 
+var (
+	//go:embed static
+	staticFiles embed.FS
+
+	//go:embed vendored/departure-mono vendored/htmx vendored/weather-icons vendored/mta/*.txt
+	vendorFiles embed.FS
+)
+
 func main() {
 	if run() != nil {
 		os.Exit(1)
@@ -20,6 +30,9 @@ func main() {
 
 func run() error {
 	verbose := flag.Bool("verbose", false, "enable debug logging")
+	configFile := flag.String("config", "", "path to a JSON config file")
+	watchInterval := flag.Duration("watch", 0, "check the config file for changes at this interval (0 disables)")
+	dev := flag.Bool("dev", false, "re-parse templates when files in the static directory change")
 
 	flag.Parse()
 
@@ -29,10 +42,24 @@ func run() error {
 		slog.SetLogLoggerLevel(slog.LevelInfo)
 	}
 
+	staticFS, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		return err
+	}
+	vendorFS, err := fs.Sub(vendorFiles, "vendored")
+	if err != nil {
+		return err
+	}
+	redmaple.SetEmbeddedAssets(staticFS, vendorFS)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	config := redmaple.LoadConfig()
+	config, err := redmaple.ReadConfig(*configFile)
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		return err
+	}
 
 	server, err := redmaple.NewServer(config)
 	if err != nil {
@@ -40,6 +67,14 @@ func run() error {
 		return err
 	}
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go server.WatchConfig(ctx, *configFile, *watchInterval, hup)
+	if *dev {
+		go server.WatchTemplates(ctx, 1*time.Second)
+	}
+
 	go func() {
 		<-ctx.Done()
 		slog.Info("shutting down")
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+)
+
+func TestEmbeddedMTAData(t *testing.T) {
+	vendorFS, err := fs.Sub(vendorFiles, "vendored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stops, err := subway.LoadStops(vendorFS)
+	if err != nil {
+		t.Fatalf("LoadStops error: %v", err)
+	}
+	if _, ok := stops["L03"]; !ok {
+		t.Error("expected the embedded stops to include L03")
+	}
+
+	// the schedule is only embedded if extra/fetch-mta-gtfs.sh was run
+	// before the build; without it the client falls back to guessing
+	schedule, err := subway.LoadSchedule(vendorFS)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		t.Log("static GTFS schedule is not embedded")
+	case err != nil:
+		t.Fatalf("LoadSchedule error: %v", err)
+	case len(schedule.StopRoutes["L03"]) == 0:
+		t.Error("expected the embedded schedule to have the lines stopping at L03")
+	}
+
+	if _, err := subway.NewClientFromFS(vendorFS); err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+}
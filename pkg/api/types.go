@@ -1,195 +1,427 @@
 package api
 
+import "time"
+
 type DatetimePartial struct {
-	Timestamp string
-	AMOrPM    string
-	Seconds   string
-	Date      string
+	Timestamp string `json:"timestamp"`
+	AMOrPM    string `json:"am_or_pm"`
+	Seconds   string `json:"seconds"`
+	Date      string `json:"date"`
 }
 
 type CitibikePartial struct {
-	Stations []CitibikeStation
+	Freshness
+	Stations []CitibikeStation `json:"stations"`
 }
 
 type CitibikeStation struct {
-	Name       string
-	TotalBikes int
-	NumBikes   int
-	NumEbikes  int
+	Name       string `json:"name"`
+	TotalBikes int    `json:"total_bikes"`
+	NumBikes   int    `json:"num_bikes"`
+	NumEbikes  int    `json:"num_ebikes"`
 }
 
 type CitibikeHistory struct {
-	Days      int
-	Station   string
-	BikeKind  string
-	MaxY      int
-	MinY      int
-	Data      []GraphPoint
-	StartTime string
-	EndTime   string
-	Stations  []CitibikeStationSelection
+	Days      int                        `json:"days"`
+	Station   string                     `json:"station"`
+	BikeKind  string                     `json:"bike_kind"`
+	MaxY      int                        `json:"max_y"`
+	MinY      int                        `json:"min_y"`
+	Data      []GraphPoint               `json:"data"`
+	StartTime string                     `json:"start_time"`
+	EndTime   string                     `json:"end_time"`
+	Stations  []CitibikeStationSelection `json:"stations"`
 }
 
 type GraphPoint struct {
-	Min   int
-	Max   int
-	Width float64
+	Min   int     `json:"min"`
+	Max   int     `json:"max"`
+	Width float64 `json:"width"`
 }
 
 type CitibikeStationSelection struct {
-	Name        string
-	UrlSafeName string
-	Days        int
-	BikeKind    string
-	IsSelected  bool
+	Name        string `json:"name"`
+	UrlSafeName string `json:"url_safe_name"`
+	Days        int    `json:"days"`
+	BikeKind    string `json:"bike_kind"`
+	IsSelected  bool   `json:"is_selected"`
 }
 
 type SubwayPartial struct {
-	First  SubwayUpdate
-	Second SubwayUpdate
+	Freshness
+	Stops []SubwayUpdate `json:"stops"`
 }
 
 type SubwayUpdate struct {
-	TrainLine     string
-	StopName      string
-	NextTrainIn   int
-	Destination   string
-	HasIssues     bool
-	FurtherTrains []int
+	StopID        string `json:"stop_id"`
+	TrainLine     string `json:"train_line"`
+	StopName      string `json:"stop_name"`
+	HasTrains     bool   `json:"has_trains"`
+	NextTrainIn   int    `json:"next_train_in"`
+	Destination   string `json:"destination"`
+	HasIssues     bool   `json:"has_issues"`
+	FurtherTrains []int  `json:"further_trains"`
+	// TrainID identifies the physical train coming next.
+	TrainID string `json:"train_id"`
+	// IsUnassigned is true if no train has been assigned to the next trip
+	// yet, so it may not run.
+	IsUnassigned bool   `json:"is_unassigned"`
+	Track        string `json:"track"`
+	IsRerouted   bool   `json:"is_rerouted"`
+	// Delay is how many minutes the next train is behind schedule, negative
+	// if it is early. It is 0 if the trip is not in the static schedule.
+	Delay int `json:"delay"`
+	// WalkMinutes is the configured walk to the stop, or 0 if there is none.
+	WalkMinutes int `json:"walk_minutes"`
+	// Trains are the upcoming trains, the next one first.
+	Trains []SubwayTrain `json:"trains"`
+	// LeaveIn is the minutes until leaving for the first train that can
+	// still be caught, if HasCatchable.
+	HasCatchable bool `json:"has_catchable"`
+	LeaveIn      int  `json:"leave_in"`
+	// IsUnavailable is true if the trips at the stop could not be fetched.
+	IsUnavailable bool `json:"is_unavailable"`
+	StationAccessibility
+}
+
+// StationAccessibility lists the elevators and escalators at a station that
+// are out of service or will be soon.
+type StationAccessibility struct {
+	HasOutage         bool `json:"has_outage"`
+	HasUpcomingOutage bool `json:"has_upcoming_outage"`
+	// IsInaccessible is true if an elevator on the accessible route through
+	// the station is out of service.
+	IsInaccessible bool              `json:"is_inaccessible"`
+	Outages        []EquipmentOutage `json:"outages"`
+}
+
+type EquipmentOutage struct {
+	Equipment string `json:"equipment"`
+	// Type is "elevator" or "escalator".
+	Type       string `json:"type"`
+	Serving    string `json:"serving"`
+	IsADA      bool   `json:"is_ada"`
+	IsUpcoming bool   `json:"is_upcoming"`
+	Start      string `json:"start"`
+	// Until is when the equipment is expected back in service, if known.
+	Until  string `json:"until"`
+	Reason string `json:"reason"`
+}
+
+// TrainStatus says whether a train can be caught given the walk to the stop.
+type TrainStatus string
+
+const (
+	TrainCatchable TrainStatus = "catchable"
+	// TrainLeaveNow is a train that can only be caught by leaving now.
+	TrainLeaveNow TrainStatus = "leave_now"
+	TrainMissed   TrainStatus = "missed"
+)
+
+type SubwayTrain struct {
+	Minutes int         `json:"minutes"`
+	Status  TrainStatus `json:"status"`
+}
+
+type BusPartial struct {
+	Freshness
+	Stops []BusUpdate `json:"stops"`
+}
+
+type BusUpdate struct {
+	StopID   string `json:"stop_id"`
+	StopName string `json:"stop_name"`
+	Line     string `json:"line"`
+	HasBuses bool   `json:"has_buses"`
+	// HasEstimate is false if the next bus has no predicted arrival yet, so
+	// only its distance is known.
+	HasEstimate bool `json:"has_estimate"`
+	NextBusIn   int  `json:"next_bus_in"`
+	// Distance is how far away the next bus is, such as "approaching" or
+	// "2 stops away".
+	Distance     string       `json:"distance"`
+	Destination  string       `json:"destination"`
+	HasIssues    bool         `json:"has_issues"`
+	FurtherBuses []BusArrival `json:"further_buses"`
+	// IsUnavailable is true if the buses at the stop could not be fetched.
+	IsUnavailable bool `json:"is_unavailable"`
+}
+
+type BusArrival struct {
+	Line        string `json:"line"`
+	HasEstimate bool   `json:"has_estimate"`
+	Minutes     int    `json:"minutes"`
+	Distance    string `json:"distance"`
+}
+
+// TransitPartial is the tile of an agency configured under transit.
+type TransitPartial struct {
+	Freshness
+	Agency string          `json:"agency"`
+	Stops  []TransitUpdate `json:"stops"`
+}
+
+type TransitUpdate struct {
+	StopID   string `json:"stop_id"`
+	StopName string `json:"stop_name"`
+	Route    string `json:"route"`
+	// RouteColor is the hex color of the next trip's route without the
+	// leading #, or "" if the agency does not set one.
+	RouteColor   string `json:"route_color"`
+	HasTrips     bool   `json:"has_trips"`
+	NextTripIn   int    `json:"next_trip_in"`
+	Headsign     string `json:"headsign"`
+	HasIssues    bool   `json:"has_issues"`
+	FurtherTrips []int  `json:"further_trips"`
+	// Delay is how many minutes the next trip is behind schedule according
+	// to the feed, negative if it is early.
+	Delay int `json:"delay"`
+	// IsUnavailable is true if the trips at the stop could not be fetched.
+	IsUnavailable bool `json:"is_unavailable"`
 }
 
 type WeatherPartial struct {
-	CurrentWeatherIcon int
-	TodayHighTemp      int
-	TodayLowTemp       int
-	TodayRainChance    int
-	Forecast           []WeatherForecast
+	Freshness
+	CurrentWeatherIcon int               `json:"current_weather_icon"`
+	TodayHighTemp      int               `json:"today_high_temp"`
+	TodayLowTemp       int               `json:"today_low_temp"`
+	TodayRainChance    int               `json:"today_rain_chance"`
+	Forecast           []WeatherForecast `json:"forecast"`
 }
 
 type WeatherForecast struct {
-	DayOfWeek   string
-	WeatherIcon int
-	RainChance  int
-	HighTemp    int
-	LowTemp     int
+	DayOfWeek   string `json:"day_of_week"`
+	WeatherIcon int    `json:"weather_icon"`
+	RainChance  int    `json:"rain_chance"`
+	HighTemp    int    `json:"high_temp"`
+	LowTemp     int    `json:"low_temp"`
 }
 
 type IndoorPartial struct {
-	IntegerTemp          int
-	FractionalTemp       int
-	IsTempTrendingUp     bool
-	IntegerHumidity      int
-	FractionalHumidity   int
-	IsHumidityTrendingUp bool
-	HumidityLevel        int
+	Freshness
+	IntegerTemp          int  `json:"integer_temp"`
+	FractionalTemp       int  `json:"fractional_temp"`
+	IsTempTrendingUp     bool `json:"is_temp_trending_up"`
+	IntegerHumidity      int  `json:"integer_humidity"`
+	FractionalHumidity   int  `json:"fractional_humidity"`
+	IsHumidityTrendingUp bool `json:"is_humidity_trending_up"`
+	HumidityLevel        int  `json:"humidity_level"`
 }
 
 type OutdoorPartial IndoorPartial
 
 type IndoorHistory struct {
-	Days      int
-	DataName  string
-	MaxY      int
-	MinY      int
-	Data      []GraphPoint
-	StartTime string
-	EndTime   string
+	Days      int          `json:"days"`
+	DataName  string       `json:"data_name"`
+	MaxY      int          `json:"max_y"`
+	MinY      int          `json:"min_y"`
+	Data      []GraphPoint `json:"data"`
+	StartTime string       `json:"start_time"`
+	EndTime   string       `json:"end_time"`
 }
 
 type OutdoorHistory IndoorHistory
 
 type SunrisePartial struct {
-	SunriseTime   string
-	SunsetTime    string
-	AQI           int
-	MoonPhaseIcon string
+	Freshness
+	SunriseTime   string `json:"sunrise_time"`
+	SunsetTime    string `json:"sunset_time"`
+	AQI           int    `json:"aqi"`
+	MoonPhaseIcon string `json:"moon_phase_icon"`
 }
 
 type SundialPartial struct {
-	Rotation float64
-	Color    string
+	Freshness
+	Rotation float64 `json:"rotation"`
+	Color    string  `json:"color"`
 }
 
 type WeatherFull struct {
-	Hourly []HourlyWeather
-	Daily  []DailyWeather
-	Alerts []WeatherAlert
+	Freshness
+	Hourly []HourlyWeather `json:"hourly"`
+	Daily  []DailyWeather  `json:"daily"`
+	Alerts []WeatherAlert  `json:"alerts"`
 }
 
 type HourlyWeather struct {
-	Stamp          string
-	Icon           int
-	Temperature    int
-	Humidity       int
-	WindSpeed      int
-	RainChance     int
-	TotalRain      string
-	RainOrSnowIcon string
+	Stamp          string `json:"stamp"`
+	Icon           int    `json:"icon"`
+	Temperature    int    `json:"temperature"`
+	Humidity       int    `json:"humidity"`
+	WindSpeed      int    `json:"wind_speed"`
+	RainChance     int    `json:"rain_chance"`
+	TotalRain      string `json:"total_rain"`
+	RainOrSnowIcon string `json:"rain_or_snow_icon"`
 }
 
 type DailyWeather struct {
-	DayOfWeek      string
-	Icon           int
-	HighTemp       int
-	LowTemp        int
-	Humidity       int
-	RainChance     int
-	TotalRain      string
-	RainOrSnowIcon string
+	DayOfWeek      string `json:"day_of_week"`
+	Icon           int    `json:"icon"`
+	HighTemp       int    `json:"high_temp"`
+	LowTemp        int    `json:"low_temp"`
+	Humidity       int    `json:"humidity"`
+	RainChance     int    `json:"rain_chance"`
+	TotalRain      string `json:"total_rain"`
+	RainOrSnowIcon string `json:"rain_or_snow_icon"`
 }
 
 type WeatherAlert struct {
-	Title       string
-	Stamp       string
-	Description string
+	Title       string `json:"title"`
+	Stamp       string `json:"stamp"`
+	Description string `json:"description"`
 }
 
 type AqiPartial struct {
-	AQI              int
-	CarbonMonoxide   int
-	NitrogenMonoxide int
-	NitrogenDioxide  int
-	Ozone            int
-	SulfurDioxide    int
-	Particulates2_5  int
-	Particulates10   int
-	Ammonia          int
+	Freshness
+	AQI              int `json:"aqi"`
+	CarbonMonoxide   int `json:"carbon_monoxide"`
+	NitrogenMonoxide int `json:"nitrogen_monoxide"`
+	NitrogenDioxide  int `json:"nitrogen_dioxide"`
+	Ozone            int `json:"ozone"`
+	SulfurDioxide    int `json:"sulfur_dioxide"`
+	Particulates2_5  int `json:"particulates_2_5"`
+	Particulates10   int `json:"particulates_10"`
+	Ammonia          int `json:"ammonia"`
 }
 
 type SunriseForecast struct {
-	Forecast []SunForecast
+	Freshness
+	Forecast []SunForecast `json:"forecast"`
 }
 
 type SunForecast struct {
-	DayOfWeek string
-	Sunrise   string
-	Sunset    string
-	MoonIcon  string
-	UVIndex   int
+	DayOfWeek string `json:"day_of_week"`
+	Sunrise   string `json:"sunrise"`
+	Sunset    string `json:"sunset"`
+	MoonIcon  string `json:"moon_icon"`
+	UVIndex   int    `json:"uv_index"`
 }
 
 type SubwayFull struct {
-	Line string
+	Line string `json:"line"`
 }
 
 type SubwayLine struct {
-	Segments []SubwaySegment
-	Alerts   []string
+	Freshness
+	Sections []SubwaySection `json:"sections"`
+	Alerts   []SubwayAlert   `json:"alerts"`
+}
+
+// SubwaySection is a stretch of a line; its branches are drawn side by side.
+type SubwaySection struct {
+	Branches []SubwayBranch `json:"branches"`
+}
+
+type SubwayBranch struct {
+	Segments []SubwaySegment `json:"segments"`
+}
+
+type SubwayAlert struct {
+	Header      string   `json:"header"`
+	Description string   `json:"description"`
+	Effect      string   `json:"effect"`
+	Cause       string   `json:"cause"`
+	Routes      []string `json:"routes"`
+	// Until is when the alert's current active period ends, if it does.
+	Until string `json:"until"`
+}
+
+// SubwayHistory graphs the minutes between trains at a stop by the hour of
+// day, either as they came (observed) or as they were predicted.
+type SubwayHistory struct {
+	Days      int                   `json:"days"`
+	Stop      string                `json:"stop"`
+	Kind      string                `json:"kind"`
+	MaxY      int                   `json:"max_y"`
+	MinY      int                   `json:"min_y"`
+	Data      []GraphPoint          `json:"data"`
+	StartTime string                `json:"start_time"`
+	EndTime   string                `json:"end_time"`
+	Stops     []SubwayStopSelection `json:"stops"`
+}
+
+type SubwayStopSelection struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Days       int    `json:"days"`
+	Kind       string `json:"kind"`
+	IsSelected bool   `json:"is_selected"`
+}
+
+// SubwayStations are the results of a station search, either by name (Query)
+// or by distance from a location (Near).
+type SubwayStations struct {
+	Query    string          `json:"query"`
+	Near     string          `json:"near"`
+	Stations []SubwayStation `json:"stations"`
+}
+
+type SubwayStation struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Routes      []string `json:"routes"`
+	NorthStopID string   `json:"north_stop_id"`
+	SouthStopID string   `json:"south_stop_id"`
+	Latitude    float64  `json:"latitude"`
+	Longitude   float64  `json:"longitude"`
+	// DistanceMeters is only set when searching by location.
+	DistanceMeters int `json:"distance_meters"`
 }
 
 type SubwaySegment struct {
-	IsStation      bool
-	StationName    string
-	HasTrainNorth  bool
-	HasTrainSouth  bool
-	NoServiceNorth bool
-	NoServiceSouth bool
+	IsStation      bool   `json:"is_station"`
+	StationID      string `json:"station_id"`
+	StationName    string `json:"station_name"`
+	HasTrainNorth  bool   `json:"has_train_north"`
+	HasTrainSouth  bool   `json:"has_train_south"`
+	NoServiceNorth bool   `json:"no_service_north"`
+	NoServiceSouth bool   `json:"no_service_south"`
+	// DelayNorth and DelaySouth are the minutes behind schedule of the latest
+	// train on the segment in each direction.
+	DelayNorth int `json:"delay_north"`
+	DelaySouth int `json:"delay_south"`
+	StationAccessibility
 }
 
 type BikeBridges struct {
-	Queensboro   int
-	Williamsburg int
-	Manhattan    int
-	Brooklyn     int
-	Range        string
+	Queensboro   int    `json:"queensboro"`
+	Williamsburg int    `json:"williamsburg"`
+	Manhattan    int    `json:"manhattan"`
+	Brooklyn     int    `json:"brooklyn"`
+	Range        string `json:"range"`
+}
+
+// Freshness says when the data in a partial was fetched and whether it is
+// last known good data being served because the upstream is failing.
+type Freshness struct {
+	AsOf    time.Time `json:"as_of"`
+	IsStale bool      `json:"is_stale"`
+}
+
+// Merge combines the freshness of two sources: the result is as old as the
+// oldest of them and stale if either is.
+func (f Freshness) Merge(other Freshness) Freshness {
+	if f.AsOf.IsZero() || (!other.AsOf.IsZero() && other.AsOf.Before(f.AsOf)) {
+		f.AsOf = other.AsOf
+	}
+	f.IsStale = f.IsStale || other.IsStale
+	return f
+}
+
+// In returns f with AsOf in loc, for display.
+func (f Freshness) In(loc *time.Location) Freshness {
+	f.AsOf = f.AsOf.In(loc)
+	return f
+}
+
+type Dashboard struct {
+	Tiles []DashboardTile `json:"tiles"`
+}
+
+type DashboardTile struct {
+	Name    string `json:"name"`
+	Partial string `json:"partial"`
+	Link    string `json:"link"`
+	Trigger string `json:"trigger"`
+	Span    int    `json:"span"`
 }
@@ -0,0 +1,359 @@
+// Package bustime reads bus arrivals and positions from the SIRI StopMonitoring
+// and VehicleMonitoring APIs of MTA Bus Time.
+package bustime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+const (
+	defaultBaseURL = "https://bustime.mta.info"
+	siriVersion    = "2"
+	// Bus Time asks that each stop or line is requested at most every 30
+	// seconds.
+	cacheTTL = 30 * time.Second
+)
+
+type Client interface {
+	// GetArrivals returns the buses heading to stopID, closest first, and the
+	// active service alerts about the lines serving it.
+	GetArrivals(ctx context.Context, stopID string) ([]Arrival, []Situation, error)
+	// GetVehicles returns the position of every bus on lineRef, such as
+	// "MTA NYCT_B63".
+	GetVehicles(ctx context.Context, lineRef string) ([]Vehicle, error)
+}
+
+type ClientImpl struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	delivery  *serviceDelivery
+	fetchedAt time.Time
+}
+
+var _ Client = (*ClientImpl)(nil)
+
+type Option func(*ClientImpl)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *ClientImpl) {
+		c.httpClient = client
+	}
+}
+
+func WithBaseURL(url string) Option {
+	return func(c *ClientImpl) {
+		c.baseURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithClock sets the clock used for caching and to decide which alerts are
+// active.
+func WithClock(now func() time.Time) Option {
+	return func(c *ClientImpl) {
+		c.now = now
+	}
+}
+
+func NewClient(apiKey string, opts ...Option) *ClientImpl {
+	c := &ClientImpl{
+		httpClient: http.DefaultClient,
+		baseURL:    defaultBaseURL,
+		apiKey:     apiKey,
+		now:        time.Now,
+		cache:      map[string]cachedResponse{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Arrival is a bus heading to a stop.
+type Arrival struct {
+	// LineRef identifies the line in requests, e.g. "MTA NYCT_B63".
+	LineRef string
+	// Line is the name riders know the line by, e.g. "B63".
+	Line        string
+	Destination string
+	VehicleRef  string
+	StopID      string
+	StopName    string
+	// ExpectedArrival is the predicted arrival, or zero if Bus Time has no
+	// prediction for the bus yet, e.g. while it is on a layover.
+	ExpectedArrival time.Time
+	// Distance is how far away the bus is as Bus Time presents it, such as
+	// "approaching", "at stop" or "2 stops away".
+	Distance       string
+	StopsAway      int
+	DistanceMeters float64
+	// IsLayover is true if the bus is waiting at the start of its route,
+	// or is still finishing its previous trip.
+	IsLayover bool
+}
+
+// Vehicle is the position of a bus on a line.
+type Vehicle struct {
+	LineRef     string
+	Line        string
+	Direction   string
+	Destination string
+	VehicleRef  string
+	Latitude    float64
+	Longitude   float64
+	Bearing     float64
+	// NextStopID and NextStopName are the stop the bus is heading to, and
+	// Distance how far it is from it.
+	NextStopID   string
+	NextStopName string
+	Distance     string
+	RecordedAt   time.Time
+}
+
+// Situation is a Bus Time service alert.
+type Situation struct {
+	ID          string
+	Summary     string
+	Description string
+	// LineRefs are the lines the alert is about.
+	LineRefs []string
+	Start    time.Time
+	End      time.Time
+}
+
+// IsActive reports whether the alert is published at t. A zero Start or End
+// leaves that side open.
+func (s Situation) IsActive(t time.Time) bool {
+	return (s.Start.IsZero() || !t.Before(s.Start)) && (s.End.IsZero() || t.Before(s.End))
+}
+
+func (c *ClientImpl) GetArrivals(ctx context.Context, stopID string) ([]Arrival, []Situation, error) {
+	slog.Debug("getting bus arrivals", "stop", stopID)
+	params := url.Values{"MonitoringRef": {stopID}}
+	delivery, err := c.get(ctx, "stop-monitoring.json", params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	arrivals := []Arrival{}
+	for _, smd := range delivery.StopMonitoringDelivery {
+		if smd.ErrorCondition != nil {
+			return nil, nil, fmt.Errorf("stop %s: %w", stopID, smd.ErrorCondition)
+		}
+		for _, visit := range smd.MonitoredStopVisit {
+			journey := visit.MonitoredVehicleJourney
+			call := journey.MonitoredCall
+			arrival := Arrival{
+				LineRef:         journey.LineRef,
+				Line:            lineName(journey),
+				Destination:     string(journey.DestinationName),
+				VehicleRef:      journey.VehicleRef,
+				StopID:          call.StopPointRef,
+				StopName:        string(call.StopPointName),
+				ExpectedArrival: call.ExpectedArrivalTime,
+				Distance:        call.ArrivalProximityText,
+				StopsAway:       call.NumberOfStopsAway,
+				DistanceMeters:  call.DistanceFromStop,
+				IsLayover:       isLayover(journey.ProgressStatus),
+			}
+			if distances := call.Extensions.Distances; arrival.Distance == "" {
+				arrival.Distance = distances.PresentableDistance
+				arrival.StopsAway = distances.StopsFromCall
+				arrival.DistanceMeters = distances.DistanceFromCall
+			}
+			arrivals = append(arrivals, arrival)
+		}
+	}
+
+	lineRefs := []string{}
+	for _, arrival := range arrivals {
+		if !slices.Contains(lineRefs, arrival.LineRef) {
+			lineRefs = append(lineRefs, arrival.LineRef)
+		}
+	}
+	situations := []Situation{}
+	for _, situation := range c.situations(delivery) {
+		// alerts about no line in particular apply to every line
+		if len(situation.LineRefs) == 0 || slices.ContainsFunc(situation.LineRefs, func(ref string) bool { return slices.Contains(lineRefs, ref) }) {
+			situations = append(situations, situation)
+		}
+	}
+	return arrivals, situations, nil
+}
+
+func (c *ClientImpl) GetVehicles(ctx context.Context, lineRef string) ([]Vehicle, error) {
+	slog.Debug("getting bus positions", "line", lineRef)
+	params := url.Values{"LineRef": {lineRef}, "VehicleMonitoringDetailLevel": {"normal"}}
+	delivery, err := c.get(ctx, "vehicle-monitoring.json", params)
+	if err != nil {
+		return nil, err
+	}
+
+	vehicles := []Vehicle{}
+	for _, vmd := range delivery.VehicleMonitoringDelivery {
+		if vmd.ErrorCondition != nil {
+			return nil, fmt.Errorf("line %s: %w", lineRef, vmd.ErrorCondition)
+		}
+		for _, activity := range vmd.VehicleActivity {
+			journey := activity.MonitoredVehicleJourney
+			vehicle := Vehicle{
+				LineRef:      journey.LineRef,
+				Line:         lineName(journey),
+				Direction:    journey.DirectionRef,
+				Destination:  string(journey.DestinationName),
+				VehicleRef:   journey.VehicleRef,
+				Latitude:     journey.VehicleLocation.Latitude,
+				Longitude:    journey.VehicleLocation.Longitude,
+				Bearing:      journey.Bearing,
+				NextStopID:   journey.MonitoredCall.StopPointRef,
+				NextStopName: string(journey.MonitoredCall.StopPointName),
+				Distance:     journey.MonitoredCall.ArrivalProximityText,
+				RecordedAt:   activity.RecordedAtTime,
+			}
+			if vehicle.Distance == "" {
+				vehicle.Distance = journey.MonitoredCall.Extensions.Distances.PresentableDistance
+			}
+			vehicles = append(vehicles, vehicle)
+		}
+	}
+	return vehicles, nil
+}
+
+// get requests the SIRI endpoint with params, reusing a response to the same
+// request from within the last 30 seconds.
+func (c *ClientImpl) get(ctx context.Context, endpoint string, params url.Values) (*serviceDelivery, error) {
+	params.Set("key", c.apiKey)
+	params.Set("version", siriVersion)
+	uri := c.baseURL + "/api/siri/" + endpoint + "?" + params.Encode()
+
+	c.mu.Lock()
+	cached, ok := c.cache[uri]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.fetchedAt) < cacheTTL {
+		metrics.CacheLookups.Inc("bustime", "hit")
+		return cached.delivery, nil
+	}
+	metrics.CacheLookups.Inc("bustime", "miss")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, c.redactKey(err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, c.redactKey(err)
+	}
+	defer resp.Body.Close()
+
+	res := siriResponse{}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode >= 400 {
+		// rejected requests, e.g. with an invalid key, still explain why
+		if err := deliveryError(&res.Siri.ServiceDelivery); decodeErr == nil && err != nil {
+			return nil, fmt.Errorf("HTTP error: %d: %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
+
+	c.mu.Lock()
+	c.cache[uri] = cachedResponse{delivery: &res.Siri.ServiceDelivery, fetchedAt: c.now()}
+	c.mu.Unlock()
+	return &res.Siri.ServiceDelivery, nil
+}
+
+// redactKey removes the API key from the request URL that net/http puts in
+// its errors, so that the key does not end up in the logs.
+func (c *ClientImpl) redactKey(err error) error {
+	urlErr, ok := err.(*url.Error)
+	if !ok || c.apiKey == "" {
+		return err
+	}
+	return &url.Error{
+		Op:  urlErr.Op,
+		URL: strings.ReplaceAll(urlErr.URL, "key="+url.QueryEscape(c.apiKey), "key=REDACTED"),
+		Err: urlErr.Err,
+	}
+}
+
+// deliveryError returns the first error condition in delivery, if any.
+func deliveryError(delivery *serviceDelivery) error {
+	for _, smd := range delivery.StopMonitoringDelivery {
+		if smd.ErrorCondition != nil {
+			return smd.ErrorCondition
+		}
+	}
+	for _, vmd := range delivery.VehicleMonitoringDelivery {
+		if vmd.ErrorCondition != nil {
+			return vmd.ErrorCondition
+		}
+	}
+	return nil
+}
+
+// situations returns the active alerts in delivery.
+func (c *ClientImpl) situations(delivery *serviceDelivery) []Situation {
+	res := []Situation{}
+	for _, sed := range delivery.SituationExchangeDelivery {
+		for _, element := range sed.Situations.PtSituationElement {
+			situation := Situation{
+				ID:          element.SituationNumber,
+				Summary:     string(element.Summary),
+				Description: string(element.Description),
+				LineRefs:    []string{},
+				Start:       element.PublicationWindow.StartTime,
+				End:         element.PublicationWindow.EndTime,
+			}
+			for _, journey := range element.Affects.VehicleJourneys.AffectedVehicleJourney {
+				if journey.LineRef != "" && !slices.Contains(situation.LineRefs, journey.LineRef) {
+					situation.LineRefs = append(situation.LineRefs, journey.LineRef)
+				}
+			}
+			if situation.IsActive(c.now()) {
+				res = append(res, situation)
+			}
+		}
+	}
+	return res
+}
+
+// lineName returns the published name of the journey's line, or its LineRef
+// without the agency prefix.
+func lineName(journey vehicleJourney) string {
+	if journey.PublishedLineName != "" {
+		return string(journey.PublishedLineName)
+	}
+	if _, name, ok := strings.Cut(journey.LineRef, "_"); ok {
+		return name
+	}
+	return journey.LineRef
+}
+
+func isLayover(status siriText) bool {
+	for _, s := range strings.Fields(string(status)) {
+		if s == "layover" || s == "prevTrip" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package bustime_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	bustime "github.com/mpoegel/red-maple/pkg/bustime"
+)
+
+// stopMonitoring is a version 2 StopMonitoring response for 5 Av/Union St with
+// a B63 that is two stops away, one on a layover without a prediction yet and
+// an alert about the B63.
+const stopMonitoring = `{"Siri": {"ServiceDelivery": {
+	"ResponseTimestamp": "2026-10-16T08:00:00.000-04:00",
+	"StopMonitoringDelivery": [{
+		"MonitoredStopVisit": [
+			{"MonitoredVehicleJourney": {
+				"LineRef": "MTA NYCT_B63",
+				"DirectionRef": "1",
+				"PublishedLineName": ["B63"],
+				"DestinationName": ["COBBLE HILL ATLANTIC AV via 5 AV"],
+				"VehicleRef": "MTA NYCT_4567",
+				"ProgressStatus": [],
+				"MonitoredCall": {
+					"StopPointRef": "MTA_308209",
+					"StopPointName": ["5 AV/UNION ST"],
+					"ExpectedArrivalTime": "2026-10-16T08:04:30.000-04:00",
+					"ArrivalProximityText": "2 stops away",
+					"DistanceFromStop": 512,
+					"NumberOfStopsAway": 2
+				}
+			}},
+			{"MonitoredVehicleJourney": {
+				"LineRef": "MTA NYCT_B63",
+				"PublishedLineName": ["B63"],
+				"DestinationName": ["COBBLE HILL ATLANTIC AV via 5 AV"],
+				"VehicleRef": "MTA NYCT_4890",
+				"ProgressStatus": ["layover"],
+				"MonitoredCall": {
+					"StopPointRef": "MTA_308209",
+					"StopPointName": ["5 AV/UNION ST"],
+					"ArrivalProximityText": "4.2 miles away",
+					"DistanceFromStop": 6759,
+					"NumberOfStopsAway": 31
+				}
+			}}
+		]
+	}],
+	"SituationExchangeDelivery": [{"Situations": {"PtSituationElement": [
+		{
+			"SituationNumber": "MTA NYCT_lmm:planned_work:1",
+			"Summary": ["B63 detoured"],
+			"Description": ["Buses are detoured at 9 St."],
+			"PublicationWindow": {"StartTime": "2026-10-01T00:00:00.000-04:00"},
+			"Affects": {"VehicleJourneys": {"AffectedVehicleJourney": [{"LineRef": "MTA NYCT_B63"}]}}
+		},
+		{
+			"SituationNumber": "MTA NYCT_lmm:planned_work:2",
+			"Summary": ["B63 stop closed"],
+			"PublicationWindow": {"StartTime": "2026-09-01T00:00:00.000-04:00", "EndTime": "2026-09-30T00:00:00.000-04:00"},
+			"Affects": {"VehicleJourneys": {"AffectedVehicleJourney": [{"LineRef": "MTA NYCT_B63"}]}}
+		}
+	]}}]
+}}}`
+
+// vehicleMonitoring is a version 1 VehicleMonitoring response, which has the
+// distances under Extensions.
+const vehicleMonitoring = `{"Siri": {"ServiceDelivery": {
+	"VehicleMonitoringDelivery": [{
+		"VehicleActivity": [{
+			"RecordedAtTime": "2026-10-16T07:59:40.000-04:00",
+			"MonitoredVehicleJourney": {
+				"LineRef": "MTA NYCT_B63",
+				"DirectionRef": "0",
+				"PublishedLineName": "B63",
+				"DestinationName": "BAY RIDGE SHORE RD via 5 AV",
+				"VehicleRef": "MTA NYCT_4567",
+				"VehicleLocation": {"Longitude": -73.983, "Latitude": 40.677},
+				"Bearing": 232.5,
+				"MonitoredCall": {
+					"StopPointRef": "MTA_308209",
+					"StopPointName": "5 AV/UNION ST",
+					"Extensions": {"Distances": {"PresentableDistance": "approaching", "DistanceFromCall": 80, "StopsFromCall": 0}}
+				}
+			}
+		}]
+	}]
+}}}`
+
+const invalidKey = `{"Siri": {"ServiceDelivery": {"StopMonitoringDelivery": [{
+	"ErrorCondition": {"OtherError": {"ErrorText": "API key is not authorized."}, "Description": "API key is not authorized."}
+}]}}}`
+
+// fixtureServer serves the SIRI responses by endpoint and records the query
+// of every request.
+type fixtureServer struct {
+	mu        sync.Mutex
+	responses map[string]string
+	status    int
+	queries   []url.Values
+}
+
+func (f *fixtureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, r.URL.Query())
+	body, ok := f.responses[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if f.status != 0 {
+		w.WriteHeader(f.status)
+	}
+	w.Write([]byte(body))
+}
+
+func newTestClient(t *testing.T, fixtures *fixtureServer, now time.Time) *bustime.ClientImpl {
+	t.Helper()
+	server := httptest.NewServer(fixtures)
+	t.Cleanup(server.Close)
+	return bustime.NewClient("test-key",
+		bustime.WithBaseURL(server.URL+"/"),
+		bustime.WithHTTPClient(server.Client()),
+		bustime.WithClock(func() time.Time { return now }),
+	)
+}
+
+func TestGetArrivals(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixtures := &fixtureServer{responses: map[string]string{"/api/siri/stop-monitoring.json": stopMonitoring}}
+	client := newTestClient(t, fixtures, now)
+
+	arrivals, situations, err := client.GetArrivals(t.Context(), "308209")
+	if err != nil {
+		t.Fatalf("GetArrivals error: %v", err)
+	}
+	if len(arrivals) != 2 {
+		t.Fatalf("expected 2 arrivals, got %d", len(arrivals))
+	}
+	first := arrivals[0]
+	if first.Line != "B63" || first.Destination != "COBBLE HILL ATLANTIC AV via 5 AV" || first.StopName != "5 AV/UNION ST" {
+		t.Errorf("unexpected first arrival: %+v", first)
+	}
+	if want := now.Add(4*time.Minute + 30*time.Second); !first.ExpectedArrival.Equal(want) {
+		t.Errorf("expected arrival at %v, got %v", want, first.ExpectedArrival)
+	}
+	if first.Distance != "2 stops away" || first.StopsAway != 2 || first.IsLayover {
+		t.Errorf("unexpected distance of first arrival: %+v", first)
+	}
+	second := arrivals[1]
+	if !second.ExpectedArrival.IsZero() || !second.IsLayover || second.Distance != "4.2 miles away" {
+		t.Errorf("expected a bus on layover without a prediction, got %+v", second)
+	}
+	if len(situations) != 1 || situations[0].Summary != "B63 detoured" {
+		t.Errorf("expected only the active alert, got %+v", situations)
+	}
+
+	query := fixtures.queries[0]
+	if query.Get("key") != "test-key" || query.Get("MonitoringRef") != "308209" || query.Get("version") != "2" {
+		t.Errorf("unexpected query: %v", query)
+	}
+}
+
+func TestGetArrivals_Cached(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixtures := &fixtureServer{responses: map[string]string{"/api/siri/stop-monitoring.json": stopMonitoring}}
+	client := newTestClient(t, fixtures, now)
+
+	for range 3 {
+		if _, _, err := client.GetArrivals(t.Context(), "308209"); err != nil {
+			t.Fatalf("GetArrivals error: %v", err)
+		}
+	}
+	if _, _, err := client.GetArrivals(t.Context(), "308210"); err != nil {
+		t.Fatalf("GetArrivals error: %v", err)
+	}
+	if len(fixtures.queries) != 2 {
+		t.Errorf("expected 1 request per stop within 30 seconds, got %d", len(fixtures.queries))
+	}
+}
+
+func TestGetArrivals_InvalidKey(t *testing.T) {
+	fixtures := &fixtureServer{responses: map[string]string{"/api/siri/stop-monitoring.json": invalidKey}, status: http.StatusForbidden}
+	client := newTestClient(t, fixtures, time.Now())
+
+	_, _, err := client.GetArrivals(t.Context(), "308209")
+	if err == nil || !strings.Contains(err.Error(), "API key is not authorized") {
+		t.Errorf("expected the reason for the rejection, got %v", err)
+	}
+}
+
+func TestGetArrivals_RedactsKey(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	client := bustime.NewClient("secret key", bustime.WithBaseURL(server.URL+"/"))
+
+	_, _, err := client.GetArrivals(t.Context(), "308209")
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the API key to be redacted, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "MonitoringRef=308209") {
+		t.Errorf("expected the rest of the URL to be kept, got %v", err)
+	}
+}
+
+func TestGetVehicles(t *testing.T) {
+	fixtures := &fixtureServer{responses: map[string]string{"/api/siri/vehicle-monitoring.json": vehicleMonitoring}}
+	client := newTestClient(t, fixtures, time.Now())
+
+	vehicles, err := client.GetVehicles(t.Context(), "MTA NYCT_B63")
+	if err != nil {
+		t.Fatalf("GetVehicles error: %v", err)
+	}
+	if len(vehicles) != 1 {
+		t.Fatalf("expected 1 vehicle, got %d", len(vehicles))
+	}
+	got := vehicles[0]
+	if got.Line != "B63" || got.Destination != "BAY RIDGE SHORE RD via 5 AV" || got.Latitude != 40.677 || got.Bearing != 232.5 {
+		t.Errorf("unexpected vehicle: %+v", got)
+	}
+	if got.NextStopID != "MTA_308209" || got.Distance != "approaching" {
+		t.Errorf("expected the bus approaching MTA_308209, got %+v", got)
+	}
+	if query := fixtures.queries[0]; query.Get("LineRef") != "MTA NYCT_B63" {
+		t.Errorf("unexpected query: %v", query)
+	}
+}
@@ -0,0 +1,126 @@
+package bustime
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// siriResponse is the envelope of every SIRI response from Bus Time.
+type siriResponse struct {
+	Siri struct {
+		ServiceDelivery serviceDelivery `json:"ServiceDelivery"`
+	} `json:"Siri"`
+}
+
+type serviceDelivery struct {
+	ResponseTimestamp         time.Time                   `json:"ResponseTimestamp"`
+	StopMonitoringDelivery    []stopMonitoringDelivery    `json:"StopMonitoringDelivery"`
+	VehicleMonitoringDelivery []vehicleMonitoringDelivery `json:"VehicleMonitoringDelivery"`
+	SituationExchangeDelivery []situationExchangeDelivery `json:"SituationExchangeDelivery"`
+}
+
+type stopMonitoringDelivery struct {
+	MonitoredStopVisit []struct {
+		MonitoredVehicleJourney vehicleJourney `json:"MonitoredVehicleJourney"`
+	} `json:"MonitoredStopVisit"`
+	ErrorCondition *errorCondition `json:"ErrorCondition"`
+}
+
+type vehicleMonitoringDelivery struct {
+	VehicleActivity []struct {
+		RecordedAtTime          time.Time      `json:"RecordedAtTime"`
+		MonitoredVehicleJourney vehicleJourney `json:"MonitoredVehicleJourney"`
+	} `json:"VehicleActivity"`
+	ErrorCondition *errorCondition `json:"ErrorCondition"`
+}
+
+type situationExchangeDelivery struct {
+	Situations struct {
+		PtSituationElement []situation `json:"PtSituationElement"`
+	} `json:"Situations"`
+}
+
+type errorCondition struct {
+	Description string `json:"Description"`
+	OtherError  struct {
+		ErrorText string `json:"ErrorText"`
+	} `json:"OtherError"`
+}
+
+func (e *errorCondition) Error() string {
+	if e.OtherError.ErrorText != "" {
+		return e.OtherError.ErrorText
+	}
+	return e.Description
+}
+
+type vehicleJourney struct {
+	LineRef           string   `json:"LineRef"`
+	DirectionRef      string   `json:"DirectionRef"`
+	PublishedLineName siriText `json:"PublishedLineName"`
+	DestinationName   siriText `json:"DestinationName"`
+	VehicleRef        string   `json:"VehicleRef"`
+	ProgressStatus    siriText `json:"ProgressStatus"`
+	VehicleLocation   struct {
+		Latitude  float64 `json:"Latitude"`
+		Longitude float64 `json:"Longitude"`
+	} `json:"VehicleLocation"`
+	Bearing       float64       `json:"Bearing"`
+	MonitoredCall monitoredCall `json:"MonitoredCall"`
+}
+
+type monitoredCall struct {
+	StopPointRef          string    `json:"StopPointRef"`
+	StopPointName         siriText  `json:"StopPointName"`
+	AimedArrivalTime      time.Time `json:"AimedArrivalTime"`
+	ExpectedArrivalTime   time.Time `json:"ExpectedArrivalTime"`
+	ExpectedDepartureTime time.Time `json:"ExpectedDepartureTime"`
+	// ArrivalProximityText and the distances are only in version 2 responses;
+	// version 1 has them under Extensions.
+	ArrivalProximityText string  `json:"ArrivalProximityText"`
+	DistanceFromStop     float64 `json:"DistanceFromStop"`
+	NumberOfStopsAway    int     `json:"NumberOfStopsAway"`
+	Extensions           struct {
+		Distances struct {
+			PresentableDistance string  `json:"PresentableDistance"`
+			DistanceFromCall    float64 `json:"DistanceFromCall"`
+			StopsFromCall       int     `json:"StopsFromCall"`
+		} `json:"Distances"`
+	} `json:"Extensions"`
+}
+
+type situation struct {
+	SituationNumber   string   `json:"SituationNumber"`
+	Summary           siriText `json:"Summary"`
+	Description       siriText `json:"Description"`
+	PublicationWindow struct {
+		StartTime time.Time `json:"StartTime"`
+		EndTime   time.Time `json:"EndTime"`
+	} `json:"PublicationWindow"`
+	Affects struct {
+		VehicleJourneys struct {
+			AffectedVehicleJourney []struct {
+				LineRef string `json:"LineRef"`
+			} `json:"AffectedVehicleJourney"`
+		} `json:"VehicleJourneys"`
+	} `json:"Affects"`
+}
+
+// siriText is a text field, which version 1 responses send as a string and
+// version 2 responses as a list of strings.
+type siriText string
+
+func (t *siriText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = siriText(s)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*t = siriText(strings.Join(list, " "))
+	return nil
+}
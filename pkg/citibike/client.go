@@ -11,6 +11,7 @@ import (
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 )
 
 const (
@@ -85,8 +86,10 @@ func NewClient(opts ...Option) *ClientImpl {
 func (c *ClientImpl) GetVehicleTypes(ctx context.Context) (*VehicleTypesResponse, error) {
 	now := time.Now()
 	if c.lastVehicleTypesResp != nil && c.lastVehicleTypesUpdatedAt.Add(time.Duration(c.lastVehicleTypesResp.TimeToLive)*time.Second).After(now) {
+		metrics.CacheLookups.Inc("citibike_vehicle_types", "hit")
 		return c.lastVehicleTypesResp, nil
 	}
+	metrics.CacheLookups.Inc("citibike_vehicle_types", "miss")
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+vehicleTypeEndpoint, nil)
 	if err != nil {
@@ -113,8 +116,10 @@ func (c *ClientImpl) GetVehicleTypes(ctx context.Context) (*VehicleTypesResponse
 func (c *ClientImpl) GetStationInformation(ctx context.Context) (*StationInformationResponse, error) {
 	now := time.Now()
 	if c.lastStationInfoResp != nil && c.lastStationInfoUpdatedAt.Add(time.Duration(c.lastStationInfoResp.TimeToLive)*time.Second).After(now) {
+		metrics.CacheLookups.Inc("citibike_station_information", "hit")
 		return c.lastStationInfoResp, nil
 	}
+	metrics.CacheLookups.Inc("citibike_station_information", "miss")
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+stationInfoEndpoint, nil)
 	if err != nil {
@@ -142,8 +147,10 @@ func (c *ClientImpl) GetStationInformation(ctx context.Context) (*StationInforma
 func (c *ClientImpl) GetStationStatus(ctx context.Context) (*StationStatusResponse, error) {
 	now := time.Now()
 	if c.lastStationStatusResp != nil && c.lastStationStatusUpdatedAt.Add(time.Duration(c.lastStationStatusResp.TimeToLive)*time.Second).After(now) {
+		metrics.CacheLookups.Inc("citibike_station_status", "hit")
 		return c.lastStationStatusResp, nil
 	}
+	metrics.CacheLookups.Inc("citibike_station_status", "miss")
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+stationStatusEndpoint, nil)
 	if err != nil {
@@ -0,0 +1,269 @@
+// Package elevators reads the elevator and escalator outages of the NYC subway
+// from the MTA's ENE (elevator and escalator) feeds.
+package elevators
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+// DefaultBaseURL is where the MTA publishes the ENE feeds.
+const DefaultBaseURL = "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/"
+
+const (
+	outagesPath       = "nyct%2Fnyct_ene.json"
+	upcomingPath      = "nyct%2Fnyct_ene_upcoming.json"
+	equipmentPath     = "nyct%2Fnyct_ene_equipments.json"
+	outagesCacheTTL   = 5 * time.Minute
+	equipmentCacheTTL = 24 * time.Hour
+)
+
+type EquipmentType string
+
+const (
+	Elevator  EquipmentType = "EL"
+	Escalator EquipmentType = "ES"
+)
+
+type Client interface {
+	// GetOutages returns the current and upcoming outages of every elevator
+	// and escalator, the earliest first.
+	GetOutages(ctx context.Context) ([]Outage, error)
+	// GetOutagesAtStop returns the current and upcoming outages at the station
+	// of stopID, which may be a station or one of its platforms.
+	GetOutagesAtStop(ctx context.Context, stopID string) ([]Outage, error)
+}
+
+type ClientImpl struct {
+	httpClient *http.Client
+	baseURL    string
+	now        func() time.Time
+
+	mu                 sync.Mutex
+	outages            []Outage
+	outagesFetchedAt   time.Time
+	equipment          map[string]equipmentRecord
+	equipmentFetchedAt time.Time
+}
+
+var _ Client = (*ClientImpl)(nil)
+
+type Option func(*ClientImpl)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *ClientImpl) {
+		c.httpClient = client
+	}
+}
+
+func WithBaseURL(url string) Option {
+	return func(c *ClientImpl) {
+		c.baseURL = strings.TrimSuffix(url, "/") + "/"
+	}
+}
+
+// WithClock sets the clock used for caching.
+func WithClock(now func() time.Time) Option {
+	return func(c *ClientImpl) {
+		c.now = now
+	}
+}
+
+func NewClient(opts ...Option) *ClientImpl {
+	c := &ClientImpl{
+		httpClient: http.DefaultClient,
+		baseURL:    DefaultBaseURL,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Outage is an elevator or escalator that is, or is going to be, out of
+// service.
+type Outage struct {
+	// Equipment identifies the elevator or escalator, e.g. "EL222".
+	Equipment string
+	Type      EquipmentType
+	Station   string
+	// StopIDs are the GTFS stations the equipment is at, e.g. "L03". They are
+	// empty if the equipment is not in the equipment feed.
+	StopIDs []string
+	// Lines are the lines at the station, e.g. "L" and "N".
+	Lines []string
+	// Serving describes where the equipment goes, e.g. "street to mezzanine".
+	Serving string
+	// IsADA is true if the equipment is part of the accessible route through
+	// the station.
+	IsADA bool
+	Start time.Time
+	// EstimatedReturn is when the equipment is expected back in service, or
+	// zero if it is not known.
+	EstimatedReturn  time.Time
+	Reason           string
+	IsMaintenance    bool
+	AlternativeRoute string
+}
+
+// IsUpcoming reports whether the outage has not started yet at t.
+func (o Outage) IsUpcoming(t time.Time) bool {
+	return t.Before(o.Start)
+}
+
+func (c *ClientImpl) GetOutages(ctx context.Context) ([]Outage, error) {
+	c.mu.Lock()
+	if c.outages != nil && c.now().Sub(c.outagesFetchedAt) < outagesCacheTTL {
+		outages := c.outages
+		c.mu.Unlock()
+		metrics.CacheLookups.Inc("elevator_outages", "hit")
+		return outages, nil
+	}
+	c.mu.Unlock()
+	metrics.CacheLookups.Inc("elevator_outages", "miss")
+
+	slog.Debug("getting elevator outages")
+	current := []outageRecord{}
+	if err := c.get(ctx, outagesPath, &current); err != nil {
+		return nil, err
+	}
+	upcoming := []outageRecord{}
+	if err := c.get(ctx, upcomingPath, &upcoming); err != nil {
+		return nil, err
+	}
+	equipment, err := c.getEquipment(ctx)
+	if err != nil {
+		// outages are still useful without knowing which stops they are at
+		slog.Warn("failed to get elevator equipment", "err", err)
+	}
+
+	outages := []Outage{}
+	for _, record := range append(current, upcoming...) {
+		outage := newOutage(record, equipment)
+		// an outage that starts soon can be in both feeds
+		if slices.ContainsFunc(outages, func(o Outage) bool { return o.Equipment == outage.Equipment && o.Start.Equal(outage.Start) }) {
+			continue
+		}
+		outages = append(outages, outage)
+	}
+	slices.SortStableFunc(outages, func(a, b Outage) int { return a.Start.Compare(b.Start) })
+
+	c.mu.Lock()
+	c.outages, c.outagesFetchedAt = outages, c.now()
+	c.mu.Unlock()
+	return outages, nil
+}
+
+func (c *ClientImpl) GetOutagesAtStop(ctx context.Context, stopID string) ([]Outage, error) {
+	outages, err := c.GetOutages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return AtStop(outages, stopID), nil
+}
+
+// AtStop returns the outages at the station of stopID, which may be a station
+// such as L03 or one of its platforms such as L03N.
+func AtStop(outages []Outage, stopID string) []Outage {
+	station := StationID(stopID)
+	res := []Outage{}
+	for _, outage := range outages {
+		if slices.Contains(outage.StopIDs, station) {
+			res = append(res, outage)
+		}
+	}
+	return res
+}
+
+// StationID returns the station of a platform's stop ID, e.g. L03 for L03N.
+func StationID(stopID string) string {
+	if len(stopID) > 1 && (strings.HasSuffix(stopID, "N") || strings.HasSuffix(stopID, "S")) {
+		return stopID[:len(stopID)-1]
+	}
+	return stopID
+}
+
+func newOutage(record outageRecord, equipment map[string]equipmentRecord) Outage {
+	outage := Outage{
+		Equipment:       record.Equipment,
+		Type:            EquipmentType(strings.ToUpper(record.EquipmentType)),
+		Station:         record.Station,
+		StopIDs:         []string{},
+		Lines:           splitList(record.TrainNo),
+		Serving:         record.Serving,
+		IsADA:           bool(record.ADA),
+		Start:           time.Time(record.OutageDate),
+		EstimatedReturn: time.Time(record.EstimatedReturnToService),
+		Reason:          record.Reason,
+		IsMaintenance:   bool(record.IsMaintenanceOutage),
+	}
+	if info, ok := equipment[record.Equipment]; ok {
+		outage.StopIDs = splitList(info.GTFSStopIDs)
+		outage.AlternativeRoute = info.AlternativeRoute
+	}
+	return outage
+}
+
+// getEquipment returns the equipment feed by equipment number. It changes
+// rarely, so it is only downloaded once a day.
+func (c *ClientImpl) getEquipment(ctx context.Context) (map[string]equipmentRecord, error) {
+	c.mu.Lock()
+	if c.equipment != nil && c.now().Sub(c.equipmentFetchedAt) < equipmentCacheTTL {
+		equipment := c.equipment
+		c.mu.Unlock()
+		return equipment, nil
+	}
+	c.mu.Unlock()
+
+	records := []equipmentRecord{}
+	if err := c.get(ctx, equipmentPath, &records); err != nil {
+		return nil, err
+	}
+	equipment := map[string]equipmentRecord{}
+	for _, record := range records {
+		equipment[record.EquipmentNo] = record
+	}
+
+	c.mu.Lock()
+	c.equipment, c.equipmentFetchedAt = equipment, c.now()
+	c.mu.Unlock()
+	return equipment, nil
+}
+
+func (c *ClientImpl) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("HTTP error: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// splitList splits a list such as "4/5/6/L" or "635/L03/R20".
+func splitList(s string) []string {
+	res := []string{}
+	for _, item := range strings.Split(s, "/") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
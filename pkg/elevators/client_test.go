@@ -0,0 +1,270 @@
+package elevators_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	elevators "github.com/mpoegel/red-maple/pkg/elevators"
+)
+
+// currentOutages has an elevator out at 14 St-Union Sq, which is in the
+// equipment feed, and an escalator out at a station that is not.
+const currentOutages = `[
+	{
+		"station": "14 St-Union Sq",
+		"borough": "MN",
+		"trainno": "L/N/Q/R/W/4/5/6",
+		"equipment": "EL222",
+		"equipmenttype": "EL",
+		"serving": "L platform to mezzanine",
+		"ADA": "Y",
+		"outagedate": "10/15/2026 11:30:00 PM",
+		"estimatedreturntoservice": "10/17/2026 05:00:00 PM",
+		"reason": "Repair",
+		"isupcomingoutage": "N",
+		"ismaintenanceoutage": "N"
+	},
+	{
+		"station": "Times Sq-42 St",
+		"borough": "MN",
+		"trainno": "1/2/3/7/N/Q/R/W/S",
+		"equipment": "ES311",
+		"equipmenttype": "ES",
+		"serving": "street to mezzanine",
+		"ADA": "N",
+		"outagedate": "10/16/2026 06:00:00 AM",
+		"estimatedreturntoservice": "",
+		"reason": "Capital Replacement",
+		"isupcomingoutage": "N",
+		"ismaintenanceoutage": "N"
+	}
+]`
+
+// upcomingOutages has planned maintenance of a Bedford Av elevator, and the
+// Union Sq outage again since it is in both feeds.
+const upcomingOutages = `[
+	{
+		"station": "Bedford Av",
+		"borough": "BK",
+		"trainno": "L",
+		"equipment": "EL411",
+		"equipmenttype": "EL",
+		"serving": "street to Manhattan-bound platform",
+		"ADA": "Y",
+		"outagedate": "10/20/2026 10:00:00 PM",
+		"estimatedreturntoservice": "10/21/2026 05:00:00 AM",
+		"reason": "Preventive Maintenance",
+		"isupcomingoutage": "Y",
+		"ismaintenanceoutage": "Y"
+	},
+	{
+		"station": "14 St-Union Sq",
+		"borough": "MN",
+		"trainno": "L/N/Q/R/W/4/5/6",
+		"equipment": "EL222",
+		"equipmenttype": "EL",
+		"serving": "L platform to mezzanine",
+		"ADA": "Y",
+		"outagedate": "10/15/2026 11:30:00 PM",
+		"estimatedreturntoservice": "10/17/2026 05:00:00 PM",
+		"reason": "Repair",
+		"isupcomingoutage": "N",
+		"ismaintenanceoutage": "N"
+	}
+]`
+
+const equipment = `[
+	{
+		"station": "14 St-Union Sq",
+		"equipmentno": "EL222",
+		"equipmenttype": "EL",
+		"serving": "L platform to mezzanine",
+		"ADA": "Y",
+		"isactive": "Y",
+		"shortdescription": "L platform to mezzanine",
+		"elevatorsgtfsstopid": "635/L03/R20",
+		"alternativeroute": "Take the L to 3 Av"
+	},
+	{
+		"station": "Bedford Av",
+		"equipmentno": "EL411",
+		"equipmenttype": "EL",
+		"serving": "street to Manhattan-bound platform",
+		"ADA": "Y",
+		"isactive": "Y",
+		"shortdescription": "Manhattan-bound platform",
+		"elevatorsgtfsstopid": "L08",
+		"alternativeroute": ""
+	}
+]`
+
+// fixtureServer serves the feeds by path and counts the requests for each.
+type fixtureServer struct {
+	mu        sync.Mutex
+	responses map[string]string
+	requests  map[string]int
+}
+
+func (f *fixtureServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.URL.Path]++
+	body, ok := f.responses[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(body))
+}
+
+func newFixtures() *fixtureServer {
+	return &fixtureServer{
+		responses: map[string]string{
+			"/nyct/nyct_ene.json":            currentOutages,
+			"/nyct/nyct_ene_upcoming.json":   upcomingOutages,
+			"/nyct/nyct_ene_equipments.json": equipment,
+		},
+		requests: map[string]int{},
+	}
+}
+
+func newTestClient(t *testing.T, fixtures *fixtureServer, now *time.Time) *elevators.ClientImpl {
+	t.Helper()
+	server := httptest.NewServer(fixtures)
+	t.Cleanup(server.Close)
+	return elevators.NewClient(
+		elevators.WithBaseURL(server.URL),
+		elevators.WithHTTPClient(server.Client()),
+		elevators.WithClock(func() time.Time { return *now }),
+	)
+}
+
+func TestGetOutages(t *testing.T) {
+	newYork, _ := time.LoadLocation("America/New_York")
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, newYork)
+	client := newTestClient(t, newFixtures(), &now)
+
+	outages, err := client.GetOutages(t.Context())
+	if err != nil {
+		t.Fatalf("GetOutages error: %v", err)
+	}
+	if len(outages) != 3 {
+		t.Fatalf("expected 3 outages without the duplicate, got %d", len(outages))
+	}
+
+	unionSq := outages[0]
+	if unionSq.Equipment != "EL222" || unionSq.Type != elevators.Elevator || !unionSq.IsADA || unionSq.IsMaintenance {
+		t.Errorf("unexpected Union Sq outage: %+v", unionSq)
+	}
+	if want := time.Date(2026, 10, 15, 23, 30, 0, 0, newYork); !unionSq.Start.Equal(want) {
+		t.Errorf("expected the outage to start at %v, got %v", want, unionSq.Start)
+	}
+	if want := time.Date(2026, 10, 17, 17, 0, 0, 0, newYork); !unionSq.EstimatedReturn.Equal(want) {
+		t.Errorf("expected the elevator back at %v, got %v", want, unionSq.EstimatedReturn)
+	}
+	if len(unionSq.StopIDs) != 3 || unionSq.StopIDs[1] != "L03" || len(unionSq.Lines) != 8 {
+		t.Errorf("unexpected stops of Union Sq outage: %v %v", unionSq.StopIDs, unionSq.Lines)
+	}
+	if unionSq.AlternativeRoute != "Take the L to 3 Av" || unionSq.IsUpcoming(now) {
+		t.Errorf("unexpected Union Sq outage: %+v", unionSq)
+	}
+
+	timesSq := outages[1]
+	if timesSq.Type != elevators.Escalator || !timesSq.EstimatedReturn.IsZero() || len(timesSq.StopIDs) != 0 {
+		t.Errorf("expected an escalator without a return time or stops, got %+v", timesSq)
+	}
+
+	bedford := outages[2]
+	if bedford.Equipment != "EL411" || !bedford.IsMaintenance || !bedford.IsUpcoming(now) {
+		t.Errorf("expected upcoming maintenance at Bedford Av, got %+v", bedford)
+	}
+	if bedford.IsUpcoming(time.Date(2026, 10, 20, 23, 0, 0, 0, newYork)) {
+		t.Error("expected the maintenance to have started")
+	}
+}
+
+func TestGetOutages_Cached(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixtures := newFixtures()
+	client := newTestClient(t, fixtures, &now)
+
+	for range 3 {
+		if _, err := client.GetOutages(t.Context()); err != nil {
+			t.Fatalf("GetOutages error: %v", err)
+		}
+	}
+	if fixtures.requests["/nyct/nyct_ene.json"] != 1 {
+		t.Errorf("expected 1 request within 5 minutes, got %v", fixtures.requests)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if _, err := client.GetOutages(t.Context()); err != nil {
+		t.Fatalf("GetOutages error: %v", err)
+	}
+	if fixtures.requests["/nyct/nyct_ene.json"] != 2 || fixtures.requests["/nyct/nyct_ene_equipments.json"] != 1 {
+		t.Errorf("expected the outages again but not the equipment, got %v", fixtures.requests)
+	}
+}
+
+func TestGetOutages_NoEquipment(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixtures := newFixtures()
+	delete(fixtures.responses, "/nyct/nyct_ene_equipments.json")
+	client := newTestClient(t, fixtures, &now)
+
+	outages, err := client.GetOutages(t.Context())
+	if err != nil {
+		t.Fatalf("GetOutages error: %v", err)
+	}
+	if len(outages) != 3 || len(outages[0].StopIDs) != 0 {
+		t.Errorf("expected the outages without their stops, got %+v", outages)
+	}
+}
+
+func TestGetOutages_Error(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fixtures := newFixtures()
+	delete(fixtures.responses, "/nyct/nyct_ene.json")
+	client := newTestClient(t, fixtures, &now)
+
+	if _, err := client.GetOutages(t.Context()); err == nil {
+		t.Error("expected an error without the outages feed")
+	}
+}
+
+func TestGetOutagesAtStop(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	client := newTestClient(t, newFixtures(), &now)
+
+	tests := map[string]string{
+		"L03N": "EL222",
+		"R20":  "EL222",
+		"L08S": "EL411",
+		"G29N": "",
+	}
+	for stopID, want := range tests {
+		outages, err := client.GetOutagesAtStop(t.Context(), stopID)
+		if err != nil {
+			t.Fatalf("GetOutagesAtStop error: %v", err)
+		}
+		if want == "" && len(outages) != 0 {
+			t.Errorf("expected no outages at %s, got %+v", stopID, outages)
+		}
+		if want != "" && (len(outages) != 1 || outages[0].Equipment != want) {
+			t.Errorf("expected %s out at %s, got %+v", want, stopID, outages)
+		}
+	}
+}
+
+func TestStationID(t *testing.T) {
+	tests := map[string]string{"L03N": "L03", "L03S": "L03", "L03": "L03", "635": "635", "S": "S"}
+	for stopID, want := range tests {
+		if got := elevators.StationID(stopID); got != want {
+			t.Errorf("StationID(%q) = %q, expected %q", stopID, got, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package elevators
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// outageRecord is an entry of the current and the upcoming outages feeds.
+type outageRecord struct {
+	Station                  string   `json:"station"`
+	Borough                  string   `json:"borough"`
+	TrainNo                  string   `json:"trainno"`
+	Equipment                string   `json:"equipment"`
+	EquipmentType            string   `json:"equipmenttype"`
+	Serving                  string   `json:"serving"`
+	ADA                      yesNo    `json:"ADA"`
+	OutageDate               feedTime `json:"outagedate"`
+	EstimatedReturnToService feedTime `json:"estimatedreturntoservice"`
+	Reason                   string   `json:"reason"`
+	IsUpcomingOutage         yesNo    `json:"isupcomingoutage"`
+	IsMaintenanceOutage      yesNo    `json:"ismaintenanceoutage"`
+}
+
+// equipmentRecord is an entry of the equipment feed, which lists every
+// elevator and escalator with the GTFS stops it serves.
+type equipmentRecord struct {
+	Station          string `json:"station"`
+	EquipmentNo      string `json:"equipmentno"`
+	EquipmentType    string `json:"equipmenttype"`
+	Serving          string `json:"serving"`
+	ADA              yesNo  `json:"ADA"`
+	IsActive         yesNo  `json:"isactive"`
+	ShortDescription string `json:"shortdescription"`
+	// GTFSStopIDs are the parent stations the equipment is at, separated by
+	// "/", e.g. "635/L03/R20".
+	GTFSStopIDs      string `json:"elevatorsgtfsstopid"`
+	AlternativeRoute string `json:"alternativeroute"`
+}
+
+// yesNo is a flag the feeds send as "Y" or "N".
+type yesNo bool
+
+func (b *yesNo) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*b = yesNo(strings.EqualFold(s, "Y"))
+	return nil
+}
+
+// feedTimeLayout is the format of the times in the feeds, which are local to
+// New York.
+const feedTimeLayout = "01/02/2006 03:04:05 PM"
+
+var newYork = loadNewYork()
+
+// feedTime is a time in the feeds, or zero if it is empty.
+type feedTime time.Time
+
+func (t *feedTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if strings.TrimSpace(s) == "" {
+		*t = feedTime{}
+		return nil
+	}
+	parsed, err := time.ParseInLocation(feedTimeLayout, strings.TrimSpace(s), newYork)
+	if err != nil {
+		return err
+	}
+	*t = feedTime(parsed)
+	return nil
+}
+
+func loadNewYork() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		slog.Warn("unknown timezone of the outage feeds, using local time", "err", err)
+		return time.Local
+	}
+	return loc
+}
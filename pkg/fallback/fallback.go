@@ -0,0 +1,169 @@
+// Package fallback serves the last successful response from an upstream when a
+// fresh fetch fails, and trips a circuit breaker per upstream and key so that a
+// failing API is not retried on every request.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+// ErrCircuitOpen is returned when the breaker for an upstream and key is open
+// and there is no previous response to fall back to.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+var staleResponses = metrics.NewCounterVec("redmaple_stale_responses_total",
+	"Responses served from the last known good data after an upstream failure.", "upstream")
+
+type entry struct {
+	value any
+	asOf  time.Time
+}
+
+// breaker opens after threshold consecutive failures. Once the cooldown has
+// passed a single request is let through to probe the upstream; it closes the
+// breaker on success and reopens it on failure.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+type Cache struct {
+	mu        sync.Mutex
+	entries   map[string]entry
+	breakers  map[string]*breaker
+	threshold int
+	cooldown  time.Duration
+	maxAge    time.Duration
+	now       func() time.Time
+}
+
+type Option func(*Cache)
+
+// WithFailureThreshold sets how many consecutive failures open the breaker.
+func WithFailureThreshold(n int) Option {
+	return func(c *Cache) {
+		c.threshold = n
+	}
+}
+
+// WithCooldown sets how long the breaker stays open before probing again.
+func WithCooldown(d time.Duration) Option {
+	return func(c *Cache) {
+		c.cooldown = d
+	}
+}
+
+// WithMaxAge sets how old the last known good data may be and still be served.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *Cache) {
+		c.maxAge = d
+	}
+}
+
+func WithClock(now func() time.Time) Option {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+func NewCache(opts ...Option) *Cache {
+	c := &Cache{
+		entries:   map[string]entry{},
+		breakers:  map[string]*breaker{},
+		threshold: 3,
+		cooldown:  30 * time.Second,
+		maxAge:    6 * time.Hour,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Fetch calls fetch unless the breaker for upstream and key is open, so one bad
+// stop or device does not hold back the rest of an upstream. Successful results
+// are remembered under upstream and key. If fetch fails, or is skipped because
+// the breaker is open, the last successful result is returned instead with its
+// freshness marked stale. Failures caused by ctx being canceled, such as a
+// client disconnecting, do not count towards the breaker. An error is only
+// returned when there is nothing to fall back to.
+func Fetch[T any](ctx context.Context, c *Cache, upstream, key string, fetch func(context.Context) (T, error)) (T, api.Freshness, error) {
+	id := upstream + "/" + key
+	var err error
+	if c.allow(id) {
+		var value T
+		value, err = fetch(ctx)
+		if err == nil {
+			asOf := c.succeed(id, value)
+			return value, api.Freshness{AsOf: asOf}, nil
+		}
+		if ctx.Err() == nil {
+			c.fail(id)
+		}
+	} else {
+		err = ErrCircuitOpen
+	}
+
+	if e, ok := c.last(id); ok {
+		staleResponses.Inc(upstream)
+		return e.value.(T), api.Freshness{AsOf: e.asOf, IsStale: true}, nil
+	}
+	var zero T
+	return zero, api.Freshness{}, err
+}
+
+func (c *Cache) allow(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[id]
+	if !ok || b.failures < c.threshold {
+		return true
+	}
+	now := c.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	// let this request probe the upstream and hold back the rest
+	b.openUntil = now.Add(c.cooldown)
+	return true
+}
+
+func (c *Cache) succeed(id string, value any) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.entries[id] = entry{value: value, asOf: now}
+	delete(c.breakers, id)
+	return now
+}
+
+func (c *Cache) fail(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.breakers[id]
+	if !ok {
+		b = &breaker{}
+		c.breakers[id] = b
+	}
+	b.failures++
+	if b.failures == c.threshold {
+		b.openUntil = c.now().Add(c.cooldown)
+	}
+}
+
+func (c *Cache) last(id string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[id]
+	if !ok || c.now().Sub(e.asOf) > c.maxAge {
+		return entry{}, false
+	}
+	return e, true
+}
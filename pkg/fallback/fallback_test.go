@@ -0,0 +1,125 @@
+package fallback_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+)
+
+type mockUpstream struct {
+	value     string
+	err       error
+	callCount int
+}
+
+func (m *mockUpstream) fetch(ctx context.Context) (string, error) {
+	m.callCount++
+	return m.value, m.err
+}
+
+func TestFetch_ServesLastKnownGood(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := fallback.NewCache(fallback.WithClock(func() time.Time { return now }))
+	upstream := &mockUpstream{value: "sunny"}
+
+	value, freshness, err := fallback.Fetch(t.Context(), cache, "weather", "nyc", upstream.fetch)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value != "sunny" || freshness.IsStale || !freshness.AsOf.Equal(now) {
+		t.Errorf("unexpected fresh result: %q %+v", value, freshness)
+	}
+
+	fetchedAt := now
+	now = now.Add(5 * time.Minute)
+	upstream.err = errors.New("503 Service Unavailable")
+	upstream.value = ""
+
+	value, freshness, err = fallback.Fetch(t.Context(), cache, "weather", "nyc", upstream.fetch)
+	if err != nil {
+		t.Fatalf("expected last known good data, got error: %v", err)
+	}
+	if value != "sunny" || !freshness.IsStale || !freshness.AsOf.Equal(fetchedAt) {
+		t.Errorf("unexpected stale result: %q %+v", value, freshness)
+	}
+
+	if _, _, err := fallback.Fetch(t.Context(), cache, "weather", "boston", upstream.fetch); err == nil {
+		t.Error("expected error for a key with no previous data")
+	}
+}
+
+func TestFetch_MaxAge(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := fallback.NewCache(
+		fallback.WithClock(func() time.Time { return now }),
+		fallback.WithMaxAge(time.Hour),
+	)
+	upstream := &mockUpstream{value: "sunny"}
+	fallback.Fetch(t.Context(), cache, "weather", "nyc", upstream.fetch)
+
+	now = now.Add(2 * time.Hour)
+	upstream.err = errors.New("timeout")
+	if _, _, err := fallback.Fetch(t.Context(), cache, "weather", "nyc", upstream.fetch); err == nil {
+		t.Error("expected error once the last known good data is too old")
+	}
+}
+
+func TestFetch_CircuitBreaker(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cache := fallback.NewCache(
+		fallback.WithClock(func() time.Time { return now }),
+		fallback.WithFailureThreshold(2),
+		fallback.WithCooldown(time.Minute),
+	)
+	upstream := &mockUpstream{err: errors.New("connection refused")}
+
+	for range 2 {
+		fallback.Fetch(t.Context(), cache, "citibike", "station", upstream.fetch)
+	}
+	if upstream.callCount != 2 {
+		t.Fatalf("expected 2 calls before the breaker opens, got %d", upstream.callCount)
+	}
+
+	_, _, err := fallback.Fetch(t.Context(), cache, "citibike", "station", upstream.fetch)
+	if !errors.Is(err, fallback.ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if upstream.callCount != 2 {
+		t.Errorf("expected no calls while the breaker is open, got %d", upstream.callCount)
+	}
+
+	// other keys on the same upstream keep their own breaker
+	fallback.Fetch(t.Context(), cache, "citibike", "other station", upstream.fetch)
+	if upstream.callCount != 3 {
+		t.Errorf("expected other keys to still be fetched, got %d calls", upstream.callCount)
+	}
+
+	// after the cooldown a single probe is let through
+	now = now.Add(time.Minute)
+	upstream.err = nil
+	upstream.value = "12 bikes"
+	value, _, err := fallback.Fetch(t.Context(), cache, "citibike", "station", upstream.fetch)
+	if err != nil || value != "12 bikes" {
+		t.Errorf("expected probe to succeed, got %q %v", value, err)
+	}
+	fallback.Fetch(t.Context(), cache, "citibike", "station", upstream.fetch)
+	if upstream.callCount != 5 {
+		t.Errorf("expected the breaker to close after a successful probe, got %d calls", upstream.callCount)
+	}
+}
+
+func TestFetch_CanceledDoesNotTripBreaker(t *testing.T) {
+	cache := fallback.NewCache(fallback.WithFailureThreshold(1))
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	upstream := &mockUpstream{err: context.Canceled}
+
+	fallback.Fetch(ctx, cache, "subway", "stop@L03S", upstream.fetch)
+	fallback.Fetch(ctx, cache, "subway", "stop@L03S", upstream.fetch)
+	if upstream.callCount != 2 {
+		t.Errorf("expected canceled requests not to open the breaker, got %d calls", upstream.callCount)
+	}
+}
@@ -0,0 +1,233 @@
+// Package gtfsrt holds the GTFS-realtime protocol buffers and a FeedManager
+// that downloads and caches GTFS-realtime feeds of any agency.
+package gtfsrt
+
+//go:generate protoc --proto_path=../../vendored/mta --go_opt=paths=source_relative --go_out=. ../../vendored/mta/gtfs-realtime.proto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+	proto "google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultPollInterval = 30 * time.Second
+	feedFetchTimeout    = 10 * time.Second
+)
+
+// Recorder saves the raw bytes of a feed each time it is downloaded.
+type Recorder interface {
+	Record(feedURL string, body []byte, t time.Time) error
+}
+
+// FeedManager keeps the latest FeedMessage of every GTFS-realtime feed URL it
+// has been asked for. Run polls each of them in the background; Get serves the
+// cached copy and only fetches a feed itself if the copy is older than the
+// poll interval. Concurrent fetches of the same URL are merged into one.
+type FeedManager struct {
+	name       string
+	httpClient *http.Client
+	header     http.Header
+	recorder   Recorder
+	now        func() time.Time
+
+	mu       sync.Mutex
+	interval time.Duration
+	feeds    map[string]*cachedFeed
+	inflight map[string]*feedCall
+}
+
+type cachedFeed struct {
+	feed      *FeedMessage
+	fetchedAt time.Time
+}
+
+type feedCall struct {
+	done chan struct{}
+	feed *FeedMessage
+	err  error
+}
+
+type FeedManagerOption func(*FeedManager)
+
+func WithPollInterval(interval time.Duration) FeedManagerOption {
+	return func(m *FeedManager) {
+		m.interval = interval
+	}
+}
+
+func WithFeedClock(now func() time.Time) FeedManagerOption {
+	return func(m *FeedManager) {
+		m.now = now
+	}
+}
+
+// WithFeedHeader sets a header on every feed request, such as the API key of
+// feeds that require one.
+func WithFeedHeader(key, value string) FeedManagerOption {
+	return func(m *FeedManager) {
+		m.header.Set(key, value)
+	}
+}
+
+// WithFeedRecorder saves every feed that is downloaded with recorder.
+func WithFeedRecorder(recorder Recorder) FeedManagerOption {
+	return func(m *FeedManager) {
+		m.recorder = recorder
+	}
+}
+
+// NewFeedManager creates a FeedManager that reports its cache lookups and
+// failed polls as the feeds of name, e.g. "subway".
+func NewFeedManager(name string, httpClient *http.Client, opts ...FeedManagerOption) *FeedManager {
+	m := &FeedManager{
+		name:       name,
+		httpClient: httpClient,
+		header:     http.Header{},
+		now:        time.Now,
+		interval:   defaultPollInterval,
+		feeds:      map[string]*cachedFeed{},
+		inflight:   map[string]*feedCall{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// SetInterval changes how often feeds are polled, from the next poll on.
+func (m *FeedManager) SetInterval(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.interval = interval
+}
+
+// Get returns the latest copy of the feed at url, fetching it if there is no
+// copy from within the poll interval.
+func (m *FeedManager) Get(ctx context.Context, url string) (*FeedMessage, error) {
+	m.mu.Lock()
+	cached, ok := m.feeds[url]
+	if ok && cached.feed != nil && m.now().Sub(cached.fetchedAt) < m.interval {
+		m.mu.Unlock()
+		metrics.CacheLookups.Inc(m.name+"_feed", "hit")
+		return cached.feed, nil
+	}
+	if !ok {
+		// remember the url so that Run polls it from now on
+		m.feeds[url] = &cachedFeed{}
+	}
+	m.mu.Unlock()
+	metrics.CacheLookups.Inc(m.name+"_feed", "miss")
+
+	return m.fetch(ctx, url)
+}
+
+// Run polls every feed that has been requested until ctx is done.
+func (m *FeedManager) Run(ctx context.Context) {
+	for {
+		m.mu.Lock()
+		interval := m.interval
+		urls := make([]string, 0, len(m.feeds))
+		for url, cached := range m.feeds {
+			// feeds fetched by Get since the last poll are still fresh
+			if m.now().Sub(cached.fetchedAt) >= interval/2 {
+				urls = append(urls, url)
+			}
+		}
+		m.mu.Unlock()
+
+		for _, url := range urls {
+			if ctx.Err() != nil {
+				return
+			}
+			if _, err := m.fetch(ctx, url); err != nil && ctx.Err() == nil {
+				slog.Warn("failed to poll feed", "feed", m.name, "url", url, "err", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// fetch downloads the feed at url and caches it. If a fetch of url is already
+// in flight, it waits for that one instead.
+func (m *FeedManager) fetch(ctx context.Context, url string) (*FeedMessage, error) {
+	m.mu.Lock()
+	if call, ok := m.inflight[url]; ok {
+		m.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.feed, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &feedCall{done: make(chan struct{})}
+	m.inflight[url] = call
+	m.mu.Unlock()
+
+	// the fetch is shared, so it must not be cancelled by the first caller
+	fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), feedFetchTimeout)
+	call.feed, call.err = m.download(fetchCtx, url)
+	cancel()
+
+	m.mu.Lock()
+	delete(m.inflight, url)
+	if call.err == nil {
+		m.feeds[url] = &cachedFeed{feed: call.feed, fetchedAt: m.now()}
+	}
+	m.mu.Unlock()
+	close(call.done)
+
+	return call.feed, call.err
+}
+
+func (m *FeedManager) download(ctx context.Context, url string) (*FeedMessage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range m.header {
+		req.Header[key] = values
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &FeedMessage{}
+	if err := proto.Unmarshal(body, feed); err != nil {
+		return nil, err
+	}
+
+	if m.recorder != nil {
+		if err := m.recorder.Record(url, body, m.now()); err != nil {
+			slog.Warn("failed to record feed", "url", url, "err", err)
+		}
+	}
+
+	return feed, nil
+}
@@ -0,0 +1,150 @@
+package gtfsrt_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// mockTransport answers every request with body and statusCode.
+type mockTransport struct {
+	body       []byte
+	statusCode int
+	callCount  int
+}
+
+func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.callCount++
+	return &http.Response{StatusCode: m.statusCode, Body: io.NopCloser(bytes.NewReader(m.body))}, nil
+}
+
+func tripFeed(tripID, stopID string, arrival int64) *gtfsrt.FeedMessage {
+	return &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{{
+			Id: proto.String(tripID),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{TripId: proto.String(tripID)},
+				StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{{
+					StopId:  proto.String(stopID),
+					Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival)},
+				}},
+			},
+		}},
+	}
+}
+
+// blockingTransport holds every request until release is closed.
+type blockingTransport struct {
+	body    []byte
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.calls.Add(1)
+	<-b.release
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(b.body))}, nil
+}
+
+func TestFeedManager_CachesWithinInterval(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	feedBytes, _ := proto.Marshal(tripFeed("L-trip", "L03N", 1000))
+	mt := &mockTransport{body: feedBytes, statusCode: 200}
+	feeds := gtfsrt.NewFeedManager("test", &http.Client{Transport: mt},
+		gtfsrt.WithPollInterval(30*time.Second),
+		gtfsrt.WithFeedClock(func() time.Time { return now }),
+	)
+
+	for range 3 {
+		if _, err := feeds.Get(t.Context(), "http://redmaple.tree/feed-l"); err != nil {
+			t.Fatalf("Get error: %v", err)
+		}
+	}
+	if mt.callCount != 1 {
+		t.Errorf("expected 1 fetch within the poll interval, got %d", mt.callCount)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, err := feeds.Get(t.Context(), "http://redmaple.tree/feed-l"); err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	if mt.callCount != 2 {
+		t.Errorf("expected a second fetch after the poll interval, got %d", mt.callCount)
+	}
+}
+
+func TestFeedManager_MergesConcurrentFetches(t *testing.T) {
+	feedBytes, _ := proto.Marshal(tripFeed("L-trip", "L03N", 1000))
+	bt := &blockingTransport{body: feedBytes, release: make(chan struct{})}
+	feeds := gtfsrt.NewFeedManager("test", &http.Client{Transport: bt})
+
+	var wg sync.WaitGroup
+	results := make([]*gtfsrt.FeedMessage, 5)
+	for i := range results {
+		wg.Go(func() {
+			feed, err := feeds.Get(t.Context(), "http://redmaple.tree/feed-l")
+			if err != nil {
+				t.Errorf("Get error: %v", err)
+			}
+			results[i] = feed
+		})
+	}
+	// give every goroutine a chance to join the in-flight fetch
+	for bt.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(bt.release)
+	wg.Wait()
+
+	if n := bt.calls.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %d", n)
+	}
+	for _, feed := range results {
+		if feed != results[0] {
+			t.Error("expected every caller to get the same feed")
+		}
+	}
+}
+
+func TestFeedManager_FailedFetchKeepsNothing(t *testing.T) {
+	mt := &mockTransport{statusCode: 503}
+	feeds := gtfsrt.NewFeedManager("test", &http.Client{Transport: mt})
+
+	for range 2 {
+		if _, err := feeds.Get(t.Context(), "http://redmaple.tree/feed-l"); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	}
+	if mt.callCount != 2 {
+		t.Errorf("expected failed fetches not to be cached, got %d calls", mt.callCount)
+	}
+}
+
+func TestFeedManager_RunPollsRequestedFeeds(t *testing.T) {
+	feedBytes, _ := proto.Marshal(tripFeed("L-trip", "L03N", 1000))
+	mt := &mockTransport{body: feedBytes, statusCode: 200}
+	feeds := gtfsrt.NewFeedManager("test", &http.Client{Transport: mt}, gtfsrt.WithPollInterval(time.Hour))
+	if _, err := feeds.Get(t.Context(), "http://redmaple.tree/feed-l"); err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+
+	// the feed was just fetched, so the first poll skips it
+	feeds.SetInterval(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	feeds.Run(ctx)
+
+	if mt.callCount < 2 {
+		t.Errorf("expected Run to poll the feed, got %d calls", mt.callCount)
+	}
+}
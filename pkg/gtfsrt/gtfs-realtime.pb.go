@@ -28,7 +28,7 @@
 // 	protoc        v3.21.12
 // source: gtfs-realtime.proto
 
-package subway
+package gtfsrt
 
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
@@ -2265,7 +2265,7 @@ var file_gtfs_realtime_proto_rawDesc = []byte{
 	0x61, 0x6e, 0x73, 0x69, 0x74, 0x2e, 0x72, 0x65, 0x61, 0x6c, 0x74, 0x69, 0x6d, 0x65, 0x5a, 0x27,
 	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6d, 0x70, 0x6f, 0x65, 0x67,
 	0x65, 0x6c, 0x2f, 0x72, 0x65, 0x64, 0x2d, 0x6d, 0x61, 0x70, 0x6c, 0x65, 0x2f, 0x70, 0x6b, 0x67,
-	0x2f, 0x73, 0x75, 0x62, 0x77, 0x61, 0x79,
+	0x2f, 0x67, 0x74, 0x66, 0x73, 0x72, 0x74,
 }
 
 var (
@@ -0,0 +1,174 @@
+// Package health tracks the outcome of requests to each upstream dependency so
+// that readiness can be reported per dependency.
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusDegraded    = "degraded"
+	StatusUnavailable = "unavailable"
+
+	// StatusFailing means the latest request failed but the dependency
+	// succeeded recently enough that its data is not yet stale.
+	StatusFailing = "failing"
+	// StatusDown means the latest request failed and there has been no
+	// success within the staleness threshold.
+	StatusDown = "down"
+	// StatusUnknown means no request has been made yet.
+	StatusUnknown = "unknown"
+)
+
+// Default is the tracker that the upstream clients in this repo report to.
+var Default = NewTracker()
+
+type state struct {
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastError   string
+}
+
+type Tracker struct {
+	mu   sync.Mutex
+	deps map[string]*state
+	now  func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		deps: map[string]*state{},
+		now:  time.Now,
+	}
+}
+
+// SetClock replaces the clock used to timestamp results, for tests.
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.now = now
+}
+
+func (t *Tracker) get(dep string) *state {
+	s, ok := t.deps[dep]
+	if !ok {
+		s = &state{}
+		t.deps[dep] = s
+	}
+	return s
+}
+
+// Success records a successful request to dep.
+func (t *Tracker) Success(dep string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.get(dep).lastSuccess = t.now()
+}
+
+// Failure records a failed request to dep.
+func (t *Tracker) Failure(dep string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.get(dep)
+	s.lastFailure = t.now()
+	s.lastError = err.Error()
+}
+
+type Report struct {
+	Status       string                      `json:"status"`
+	Dependencies map[string]DependencyReport `json:"dependencies"`
+}
+
+type DependencyReport struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	// Staleness is the time since the last success.
+	Staleness string `json:"staleness,omitempty"`
+}
+
+// Check reports on each of deps. The overall status is unavailable if any of
+// the critical deps are down, degraded if any dep is failing or down, and ok
+// otherwise. Deps that have not been contacted yet do not affect the status.
+func (t *Tracker) Check(deps, critical []string, staleAfter time.Duration) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+
+	report := Report{
+		Status:       StatusOK,
+		Dependencies: map[string]DependencyReport{},
+	}
+	for _, dep := range deps {
+		dr := DependencyReport{
+			Status:   StatusUnknown,
+			Critical: slices.Contains(critical, dep),
+		}
+		if s, ok := t.deps[dep]; ok {
+			if !s.lastSuccess.IsZero() {
+				lastSuccess := s.lastSuccess
+				dr.LastSuccess = &lastSuccess
+				dr.Staleness = now.Sub(lastSuccess).Round(time.Second).String()
+			}
+			if !s.lastFailure.IsZero() {
+				lastFailure := s.lastFailure
+				dr.LastFailure = &lastFailure
+				dr.LastError = s.lastError
+			}
+			switch {
+			case !s.lastSuccess.Before(s.lastFailure):
+				dr.Status = StatusOK
+			case !s.lastSuccess.IsZero() && now.Sub(s.lastSuccess) <= staleAfter:
+				dr.Status = StatusFailing
+			default:
+				dr.Status = StatusDown
+			}
+		}
+
+		switch {
+		case dr.Status == StatusDown && dr.Critical:
+			report.Status = StatusUnavailable
+		case (dr.Status == StatusDown || dr.Status == StatusFailing) && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+		report.Dependencies[dep] = dr
+	}
+	return report
+}
+
+type transport struct {
+	tracker *Tracker
+	dep     string
+	next    http.RoundTripper
+}
+
+// Transport wraps next so that every request it makes is recorded as a success
+// or failure of dep. Responses with a 4xx or 5xx status count as failures. The
+// recorded error leaves out the query string, which may hold API keys. If next
+// is nil, http.DefaultTransport is used.
+func (t *Tracker) Transport(dep string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{tracker: t, dep: dep, next: next}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		t.tracker.Failure(t.dep, err)
+	case resp.StatusCode >= 400:
+		t.tracker.Failure(t.dep, fmt.Errorf("%s %s%s: %s", req.Method, req.URL.Host, req.URL.Path, resp.Status))
+	default:
+		t.tracker.Success(t.dep)
+	}
+	return resp, err
+}
@@ -0,0 +1,110 @@
+package health_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	health "github.com/mpoegel/red-maple/pkg/health"
+)
+
+type mockTransport struct {
+	statusCode int
+	err        error
+}
+
+func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &http.Response{
+		StatusCode: m.statusCode,
+		Status:     http.StatusText(m.statusCode),
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
+
+func TestCheck(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tracker := health.NewTracker()
+	tracker.SetClock(func() time.Time { return now })
+
+	deps := []string{"weather", "subway", "citibike", "s3"}
+	critical := []string{"subway"}
+
+	report := tracker.Check(deps, critical, 5*time.Minute)
+	if report.Status != health.StatusOK {
+		t.Errorf("expected ok before any requests, got %s", report.Status)
+	}
+	if got := report.Dependencies["weather"].Status; got != health.StatusUnknown {
+		t.Errorf("expected weather unknown, got %s", got)
+	}
+
+	tracker.Success("weather")
+	tracker.Success("subway")
+	tracker.Failure("citibike", errors.New("connection refused"))
+	report = tracker.Check(deps, critical, 5*time.Minute)
+	if report.Status != health.StatusDegraded {
+		t.Errorf("expected degraded when citibike is down, got %s", report.Status)
+	}
+	citibike := report.Dependencies["citibike"]
+	if citibike.Status != health.StatusDown || citibike.LastError != "connection refused" || citibike.Critical {
+		t.Errorf("unexpected citibike report: %+v", citibike)
+	}
+
+	now = now.Add(time.Minute)
+	tracker.Failure("subway", errors.New("timeout"))
+	report = tracker.Check(deps, critical, 5*time.Minute)
+	if report.Status != health.StatusDegraded {
+		t.Errorf("expected degraded while subway is within its grace period, got %s", report.Status)
+	}
+	subway := report.Dependencies["subway"]
+	if subway.Status != health.StatusFailing || subway.Staleness != "1m0s" {
+		t.Errorf("unexpected subway report: %+v", subway)
+	}
+
+	now = now.Add(5 * time.Minute)
+	report = tracker.Check(deps, critical, 5*time.Minute)
+	if report.Status != health.StatusUnavailable {
+		t.Errorf("expected unavailable once subway is stale, got %s", report.Status)
+	}
+
+	tracker.Success("subway")
+	report = tracker.Check(deps, critical, 5*time.Minute)
+	if got := report.Dependencies["subway"].Status; got != health.StatusOK {
+		t.Errorf("expected subway to recover, got %s", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tracker := health.NewTracker()
+	client := &http.Client{Transport: tracker.Transport("weather", &mockTransport{statusCode: 401})}
+
+	resp, err := client.Get("http://redmaple.tree/data?appid=secret")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	dep := tracker.Check([]string{"weather"}, nil, time.Minute).Dependencies["weather"]
+	if dep.Status != health.StatusDown {
+		t.Errorf("expected weather down after a 401, got %s", dep.Status)
+	}
+	if want := "GET redmaple.tree/data: Unauthorized"; dep.LastError != want {
+		t.Errorf("expected last error %q, got %q", want, dep.LastError)
+	}
+
+	client.Transport = tracker.Transport("weather", &mockTransport{statusCode: 200})
+	resp, err = client.Get("http://redmaple.tree/data")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if got := tracker.Check([]string{"weather"}, nil, time.Minute).Dependencies["weather"].Status; got != health.StatusOK {
+		t.Errorf("expected weather ok after a 200, got %s", got)
+	}
+}
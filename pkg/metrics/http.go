@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// UpstreamRequests counts requests made to each upstream API by response
+	// status code, or "error" if no response was received.
+	UpstreamRequests = NewCounterVec("redmaple_upstream_requests_total",
+		"Requests made to upstream APIs.", "upstream", "code")
+
+	// UpstreamLatency tracks how long requests to each upstream API take.
+	UpstreamLatency = NewHistogramVec("redmaple_upstream_request_duration_seconds",
+		"Latency of requests made to upstream APIs.", DefaultBuckets, "upstream")
+
+	// CacheLookups counts hits and misses for each client-side cache.
+	CacheLookups = NewCounterVec("redmaple_cache_lookups_total",
+		"Lookups in client-side caches of upstream data.", "cache", "result")
+)
+
+type instrumentedTransport struct {
+	upstream string
+	next     http.RoundTripper
+}
+
+// InstrumentTransport wraps next so that every request it makes is counted in
+// UpstreamRequests and UpstreamLatency under the given upstream name. If next
+// is nil, http.DefaultTransport is used.
+func InstrumentTransport(upstream string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &instrumentedTransport{upstream: upstream, next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	UpstreamLatency.Observe(time.Since(start).Seconds(), t.upstream)
+	if err != nil {
+		UpstreamRequests.Inc(t.upstream, "error")
+		return nil, err
+	}
+	UpstreamRequests.Inc(t.upstream, strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
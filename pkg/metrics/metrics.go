@@ -0,0 +1,296 @@
+// Package metrics is a small Prometheus-compatible metrics library. Metrics are
+// registered with a Registry and written out in the Prometheus text exposition
+// format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets used for request latencies, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry that the metrics in this repo are registered with.
+var Default = NewRegistry()
+
+type collector interface {
+	write(w io.Writer) error
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every registered metric in the Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// vec holds one series per combination of label values.
+type vec[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*T
+	values map[string][]string
+	newT   func() *T
+}
+
+func (v *vec[T]) get(labelValues []string) *T {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = v.newT()
+		v.series[key] = s
+		v.values[key] = slices.Clone(labelValues)
+	}
+	return s
+}
+
+func (v *vec[T]) each(fn func(labels string, s *T) error) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	v.mu.Unlock()
+
+	for _, key := range keys {
+		v.mu.Lock()
+		s, values := v.series[key], v.values[key]
+		v.mu.Unlock()
+		if err := fn(formatLabels(v.labels, values), s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vec[T]) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+	return err
+}
+
+type counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	vec[counter]
+}
+
+// NewCounterVec creates a counter and registers it with the Default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec[counter]{
+		name:   name,
+		help:   help,
+		kind:   "counter",
+		labels: labels,
+		series: map[string]*counter{},
+		values: map[string][]string{},
+		newT:   func() *counter { return &counter{} },
+	}}
+	Default.register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta to the counter with the given label values.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	s := c.get(labelValues)
+	s.mu.Lock()
+	s.value += delta
+	s.mu.Unlock()
+}
+
+// Value returns the current count for the given label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	s := c.get(labelValues)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	return c.each(func(labels string, s *counter) error {
+		s.mu.Lock()
+		value := s.value
+		s.mu.Unlock()
+		_, err := fmt.Fprintf(w, "%s%s %s\n", c.name, labels, formatFloat(value))
+		return err
+	})
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds and
+// registers it with the Default registry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{buckets: slices.Sorted(slices.Values(buckets))}
+	h.vec = vec[histogram]{
+		name:   name,
+		help:   help,
+		kind:   "histogram",
+		labels: labels,
+		series: map[string]*histogram{},
+		values: map[string][]string{},
+		newT:   func() *histogram { return &histogram{counts: make([]uint64, len(h.buckets))} },
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe records value in the histogram with the given label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	s := h.get(labelValues)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	return h.each(func(labels string, s *histogram) error {
+		s.mu.Lock()
+		counts, sum, count := slices.Clone(s.counts), s.sum, s.count
+		s.mu.Unlock()
+
+		for i, bound := range h.buckets {
+			le := withLabel(labels, "le", formatFloat(bound))
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, le, counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, withLabel(labels, "le", "+Inf"), count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels, formatFloat(sum)); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, count)
+		return err
+	})
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=%q", name, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(labels, name, value string) string {
+	pair := fmt.Sprintf("%s=%q", name, value)
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+// escapeLabel strips characters that %q would escape differently than the
+// Prometheus text format expects.
+func escapeLabel(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+type mockTransport struct {
+	statusCode int
+	err        error
+}
+
+func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &http.Response{
+		StatusCode: m.statusCode,
+		Body:       io.NopCloser(bytes.NewReader(nil)),
+	}, nil
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	c := metrics.NewCounterVec("test_counter_total", "A test counter.", "kind")
+	c.Inc("a")
+	c.Add(2.5, "a")
+	c.Inc(`b"c`)
+
+	if got := c.Value("a"); got != 3.5 {
+		t.Errorf("expected 3.5, got %v", got)
+	}
+
+	body := scrape(t)
+	for _, want := range []string{
+		"# HELP test_counter_total A test counter.\n",
+		"# TYPE test_counter_total counter\n",
+		`test_counter_total{kind="a"} 3.5` + "\n",
+		`test_counter_total{kind="b\"c"} 1` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := metrics.NewHistogramVec("test_latency_seconds", "A test histogram.", []float64{1, 0.1}, "op")
+	h.Observe(0.05, "read")
+	h.Observe(0.5, "read")
+	h.Observe(3, "read")
+
+	body := scrape(t)
+	for _, want := range []string{
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{op="read",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{op="read",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{op="read",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{op="read"} 3.55` + "\n",
+		`test_latency_seconds_count{op="read"} 3` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestInstrumentTransport(t *testing.T) {
+	client := &http.Client{Transport: metrics.InstrumentTransport("test", &mockTransport{statusCode: 503})}
+	resp, err := client.Get("http://redmaple.tree/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	client = &http.Client{Transport: metrics.InstrumentTransport("test", &mockTransport{err: errors.New("boom")})}
+	if _, err := client.Get("http://redmaple.tree/"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if got := metrics.UpstreamRequests.Value("test", "503"); got != 1 {
+		t.Errorf("expected 1 request with code 503, got %v", got)
+	}
+	if got := metrics.UpstreamRequests.Value("test", "error"); got != 1 {
+		t.Errorf("expected 1 failed request, got %v", got)
+	}
+	if body := scrape(t); !strings.Contains(body, `redmaple_upstream_request_duration_seconds_count{upstream="test"} 2`) {
+		t.Errorf("expected latency to be recorded, got:\n%s", body)
+	}
+}
@@ -13,6 +13,8 @@ import (
 	"strconv"
 	"sync"
 	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 )
 
 const (
@@ -151,15 +153,18 @@ func (c *ClientImpl) GetBicycleCounts(ctx context.Context, counterID CounterID,
 	if cached, ok := c.cache[cacheKey]; ok && time.Since(cached.lastUpdate) < cacheTTL {
 		slog.Debug("using in-memory cached bicycle counts", "counterID", counterID)
 		c.cacheMu.RUnlock()
+		metrics.CacheLookups.Inc("nycdata", "hit")
 		return cached.data, nil
 	}
 	c.cacheMu.RUnlock()
+	metrics.CacheLookups.Inc("nycdata", "miss")
 
 	if c.fsCacheDir != "" {
 		if data, cachedAt, err := c.readFSCache(cacheKey); err == nil {
 			age := time.Since(cachedAt)
 			if age < fsCacheTTL {
 				slog.Debug("using filesystem cached bicycle counts", "counterID", counterID, "age", age)
+				metrics.CacheLookups.Inc("nycdata_fs", "hit")
 				c.cacheMu.Lock()
 				c.cache[cacheKey] = &bicycleCountCache{
 					data:       data,
@@ -170,6 +175,7 @@ func (c *ClientImpl) GetBicycleCounts(ctx context.Context, counterID CounterID,
 			}
 
 			slog.Debug("filesystem cache stale, returning stale data and async refreshing", "counterID", counterID, "age", age)
+			metrics.CacheLookups.Inc("nycdata_fs", "stale")
 			c.cacheMu.Lock()
 			c.cache[cacheKey] = &bicycleCountCache{
 				data:       data,
@@ -185,6 +191,7 @@ func (c *ClientImpl) GetBicycleCounts(ctx context.Context, counterID CounterID,
 
 			return data, nil
 		}
+		metrics.CacheLookups.Inc("nycdata_fs", "miss")
 	}
 
 	slog.Debug("fetching bicycle counts from API", "counterID", counterID)
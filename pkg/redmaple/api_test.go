@@ -0,0 +1,117 @@
+package redmaple_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func newTestMux(t *testing.T) *http.ServeMux {
+	t.Helper()
+	server, err := redmaple.NewServer(newTestConfig())
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+	return mux
+}
+
+func TestAPIPartialAsJSON(t *testing.T) {
+	mux := newTestMux(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"versioned path", "/api/v1/datetime", ""},
+		{"accept header", "/x/datetime", "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected application/json, got %q", ct)
+			}
+			data := api.DatetimePartial{}
+			if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if data.Timestamp == "" || data.Date == "" {
+				t.Errorf("expected timestamp and date, got %+v", data)
+			}
+		})
+	}
+}
+
+func TestAPIPartialAsHTML(t *testing.T) {
+	mux := newTestMux(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/x/datetime", nil)
+	req.Header.Set("Accept", "text/html,application/json;q=0.9")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if strings.HasPrefix(strings.TrimSpace(rec.Body.String()), "{") {
+		t.Errorf("expected HTML, got %s", rec.Body.String())
+	}
+}
+
+func TestAPISubwayStations(t *testing.T) {
+	mux := newTestMux(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantID   string
+		wantName string
+	}{
+		{"by name", "/api/v1/subway/stations?q=bedford+av&limit=1", "L08", "Bedford Av"},
+		{"near weather location", "/api/v1/subway/stations", "", "Grand Central-42 St"},
+		{"near location", "/api/v1/subway/stations?near=40.7173,-73.9569&limit=3", "L08", "Bedford Av"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rec.Code)
+			}
+			data := api.SubwayStations{}
+			if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(data.Stations) == 0 {
+				t.Fatal("expected stations, got none")
+			}
+			first := data.Stations[0]
+			if first.Name != tt.wantName || (tt.wantID != "" && first.ID != tt.wantID) {
+				t.Errorf("expected %s %s first, got %+v", tt.wantID, tt.wantName, first)
+			}
+			if first.NorthStopID == "" || first.SouthStopID == "" || len(first.Routes) == 0 {
+				t.Errorf("expected platforms and routes, got %+v", first)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subway/stations?near=nowhere", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an invalid location, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package redmaple
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+var (
+	embeddedStatic fs.FS
+	embeddedVendor fs.FS
+)
+
+// SetEmbeddedAssets registers the static and vendored assets compiled into the
+// binary. It must be called before the config is read. Files found under
+// STATIC_DIR and VENDOR_DIR take precedence over the embedded copies, so
+// either directory can be used to override individual templates or styles.
+func SetEmbeddedAssets(static, vendor fs.FS) {
+	embeddedStatic = static
+	embeddedVendor = vendor
+}
+
+func (c Config) staticFS() fs.FS {
+	return assetFS(c.StaticDir, embeddedStatic)
+}
+
+func (c Config) vendorFS() fs.FS {
+	return assetFS(c.VendorDir, embeddedVendor)
+}
+
+func assetFS(dir string, embedded fs.FS) fs.FS {
+	if embedded == nil {
+		return os.DirFS(dir)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return embedded
+	}
+	return overlayFS{upper: os.DirFS(dir), lower: embedded}
+}
+
+// overlayFS serves files from upper, falling back to lower for any file that
+// upper does not have.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	return o.lower.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, err1 := fs.ReadDir(o.upper, name)
+	lower, err2 := fs.ReadDir(o.lower, name)
+	if err1 != nil && err2 != nil {
+		return nil, errors.Join(err1, err2)
+	}
+
+	entries := slices.Clone(upper)
+	for _, entry := range lower {
+		if !slices.ContainsFunc(upper, func(e fs.DirEntry) bool { return e.Name() == entry.Name() }) {
+			entries = append(entries, entry)
+		}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, nil
+}
@@ -0,0 +1,74 @@
+package redmaple_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func TestEmbeddedAssetsWithOverride(t *testing.T) {
+	redmaple.SetEmbeddedAssets(fstest.MapFS{
+		"pages/index.html":   {Data: []byte(`{{define "Index"}}embedded index{{end}}`)},
+		"partials/head.html": {Data: []byte(`{{define "Head"}}{{end}}`)},
+		"css/index.css":      {Data: []byte("embedded index.css")},
+		"css/subway.css":     {Data: []byte("embedded subway.css")},
+	}, os.DirFS("../../vendored"))
+	t.Cleanup(func() { redmaple.SetEmbeddedAssets(nil, nil) })
+
+	staticDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(staticDir, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staticDir, "css/index.css"), []byte("themed index.css"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := redmaple.DefaultConfig()
+	config.StaticDir = staticDir
+	config.VendorDir = filepath.Join(t.TempDir(), "missing")
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "embedded index"},
+		{"/static/css/index.css", "themed index.css"},
+		{"/static/css/subway.css", "embedded subway.css"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			body, _ := io.ReadAll(rec.Body)
+			if string(body) != tt.want {
+				t.Errorf("GET %s = %q, want %q", tt.path, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerRejectsBrokenTemplates(t *testing.T) {
+	redmaple.SetEmbeddedAssets(fstest.MapFS{
+		"pages/index.html":   {Data: []byte(`{{define "Index"}}{{.Missing{{end}}`)},
+		"partials/head.html": {Data: []byte(`{{define "Head"}}{{end}}`)},
+	}, os.DirFS("../../vendored"))
+	t.Cleanup(func() { redmaple.SetEmbeddedAssets(nil, nil) })
+
+	config := redmaple.DefaultConfig()
+	config.StaticDir = filepath.Join(t.TempDir(), "missing")
+	if _, err := redmaple.NewServer(config); err == nil {
+		t.Fatal("expected template parse error, got nil")
+	}
+}
@@ -49,5 +49,5 @@ func (s *Server) HandleBikeBridges(w http.ResponseWriter, r *http.Request) {
 	}
 
 	slog.Debug("prepared bike bridges", "data", data)
-	s.executeTemplate(w, "BikeBridges", data)
+	s.render(w, r, "BikeBridges", data)
 }
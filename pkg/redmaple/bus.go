@@ -0,0 +1,110 @@
+package redmaple
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	bustime "github.com/mpoegel/red-maple/pkg/bustime"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+)
+
+type busArrivals struct {
+	arrivals   []bustime.Arrival
+	situations []bustime.Situation
+}
+
+func (s *Server) fetchBus(r *http.Request) (any, error) {
+	data := api.BusPartial{Stops: []api.BusUpdate{}}
+	now := time.Now()
+
+	for _, stop := range s.config.BusStops {
+		buses, freshness, err := fallback.Fetch(r.Context(), s.fallback, "bustime", "stop@"+stop.ID, func(ctx context.Context) (busArrivals, error) {
+			arrivals, situations, err := s.busCli.GetArrivals(ctx, stop.ID)
+			return busArrivals{arrivals, situations}, err
+		})
+		if err != nil {
+			slog.Warn("failed to get buses", "stop", stop.ID, "err", err)
+			update := SummarizeBuses(stop, nil, now)
+			update.IsUnavailable = true
+			data.Stops = append(data.Stops, update)
+			continue
+		}
+		update := SummarizeBuses(stop, buses.arrivals, now)
+		if len(buses.arrivals) == 0 {
+			slog.Warn("no buses found", "stop", stop.ID)
+		}
+		update.HasIssues = slices.ContainsFunc(buses.situations, func(situation bustime.Situation) bool {
+			return situationAffects(situation, stop.Lines)
+		})
+		data.Stops = append(data.Stops, update)
+		data.Freshness = data.Freshness.Merge(freshness.In(s.tz))
+	}
+
+	slog.Debug("prepared bus partial", "data", data)
+
+	return data, nil
+}
+
+// SummarizeBuses turns the buses heading to a configured stop into the next
+// bus and the arrivals after it, skipping buses on lines the stop is not
+// configured for.
+func SummarizeBuses(stop BusStopConfig, arrivals []bustime.Arrival, now time.Time) api.BusUpdate {
+	res := api.BusUpdate{
+		StopID:       stop.ID,
+		StopName:     stop.Label,
+		FurtherBuses: []api.BusArrival{},
+	}
+	for _, arrival := range arrivals {
+		if len(stop.Lines) > 0 && !slices.Contains(stop.Lines, arrival.Line) {
+			continue
+		}
+		minutes := 0
+		if !arrival.ExpectedArrival.IsZero() {
+			minutes = max(int(arrival.ExpectedArrival.Sub(now).Minutes()), 0)
+		}
+		if res.HasBuses {
+			res.FurtherBuses = append(res.FurtherBuses, api.BusArrival{
+				Line:        arrival.Line,
+				HasEstimate: !arrival.ExpectedArrival.IsZero(),
+				Minutes:     minutes,
+				Distance:    arrival.Distance,
+			})
+			continue
+		}
+		res.HasBuses = true
+		res.Line = arrival.Line
+		res.HasEstimate = !arrival.ExpectedArrival.IsZero()
+		res.NextBusIn = minutes
+		res.Distance = arrival.Distance
+		res.Destination = arrival.Destination
+		if res.StopName == "" {
+			res.StopName = arrival.StopName
+		}
+	}
+	if res.Line == "" && len(stop.Lines) > 0 {
+		res.Line = stop.Lines[0]
+	}
+	if res.StopName == "" {
+		res.StopName = stop.ID
+	}
+	return res
+}
+
+// situationAffects reports whether an alert is about any of lines, which are
+// names such as "B63". Alerts about no line in particular affect every line.
+func situationAffects(situation bustime.Situation, lines []string) bool {
+	if len(lines) == 0 || len(situation.LineRefs) == 0 {
+		return true
+	}
+	for _, ref := range situation.LineRefs {
+		if _, name, ok := strings.Cut(ref, "_"); ok && slices.Contains(lines, name) {
+			return true
+		}
+	}
+	return false
+}
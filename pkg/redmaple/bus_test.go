@@ -0,0 +1,68 @@
+package redmaple_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	bustime "github.com/mpoegel/red-maple/pkg/bustime"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func TestSummarizeBuses(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	arrivals := []bustime.Arrival{
+		{Line: "B103", Destination: "CANARSIE", ExpectedArrival: now.Add(1 * time.Minute), Distance: "approaching"},
+		{Line: "B63", Destination: "COBBLE HILL", StopName: "5 AV/UNION ST", ExpectedArrival: now.Add(4*time.Minute + 30*time.Second), Distance: "2 stops away"},
+		{Line: "B63", Destination: "COBBLE HILL", ExpectedArrival: now.Add(12 * time.Minute), Distance: "1.1 miles away"},
+		{Line: "B63", Destination: "COBBLE HILL", Distance: "4.2 miles away", IsLayover: true},
+	}
+
+	got := redmaple.SummarizeBuses(redmaple.BusStopConfig{ID: "308209", Lines: []string{"B63"}}, arrivals, now)
+	if !got.HasBuses || !got.HasEstimate || got.NextBusIn != 4 || got.Line != "B63" {
+		t.Errorf("unexpected next bus: %+v", got)
+	}
+	if got.Distance != "2 stops away" || got.StopName != "5 AV/UNION ST" {
+		t.Errorf("expected the next B63 two stops away at 5 AV/UNION ST, got %+v", got)
+	}
+	if len(got.FurtherBuses) != 2 || got.FurtherBuses[0].Minutes != 12 || got.FurtherBuses[1].HasEstimate {
+		t.Errorf("unexpected further buses: %+v", got.FurtherBuses)
+	}
+
+	got = redmaple.SummarizeBuses(redmaple.BusStopConfig{ID: "308209", Label: "Union St"}, arrivals, now)
+	if got.Line != "B103" || got.Distance != "approaching" || got.StopName != "Union St" {
+		t.Errorf("expected the approaching B103 without a line filter, got %+v", got)
+	}
+
+	got = redmaple.SummarizeBuses(redmaple.BusStopConfig{ID: "308209", Lines: []string{"B37"}}, arrivals, now)
+	if got.HasBuses || got.Line != "B37" || got.StopName != "308209" {
+		t.Errorf("expected no buses for the B37, got %+v", got)
+	}
+}
+
+func TestLoadConfigBusStopsFromEnv(t *testing.T) {
+	t.Setenv("BUS_STOPS", "308209:B63:Union St,305423")
+	t.Setenv("BUSTIME_API_KEY", "key")
+
+	config := redmaple.LoadConfig()
+	want := []redmaple.BusStopConfig{
+		{ID: "308209", Lines: []string{"B63"}, Label: "Union St"},
+		{ID: "305423"},
+	}
+	if !reflect.DeepEqual(config.BusStops, want) {
+		t.Errorf("expected BUS_STOPS=%v, got %v", want, config.BusStops)
+	}
+	if config.BusTimeAPIKey != "key" {
+		t.Errorf("expected BUSTIME_API_KEY=key, got %q", config.BusTimeAPIKey)
+	}
+}
+
+func TestReadConfigBusStopsWithoutKey(t *testing.T) {
+	filename := writeConfigFile(t, `{"vendor_dir": "../../vendored", "bus_stops": [{"id": "308209"}]}`)
+
+	_, err := redmaple.ReadConfig(filename)
+	if err == nil || !strings.Contains(err.Error(), "bustime_api_key is required") {
+		t.Errorf("expected the missing API key to be reported, got %v", err)
+	}
+}
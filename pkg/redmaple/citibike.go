@@ -1,6 +1,8 @@
 package redmaple
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"net/url"
@@ -10,29 +12,37 @@ import (
 
 	api "github.com/mpoegel/red-maple/pkg/api"
 	citibike "github.com/mpoegel/red-maple/pkg/citibike"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
 )
 
-func (s *Server) HandleCitibike(w http.ResponseWriter, r *http.Request) {
+type bikeCounts struct {
+	classics int
+	ebikes   int
+}
+
+func (s *Server) fetchCitibike(r *http.Request) (any, error) {
 	data := api.CitibikePartial{
 		Stations: []api.CitibikeStation{},
 	}
 	for i := 0; i < max(len(s.config.CitibikeStations), 2); i++ {
 		name := s.config.CitibikeStations[i]
-		numClassics, numEbikes, err := s.citibike.GetNumBikesAtStation(r.Context(), name)
+		counts, freshness, err := fallback.Fetch(r.Context(), s.fallback, "citibike", name, func(ctx context.Context) (bikeCounts, error) {
+			numClassics, numEbikes, err := s.citibike.GetNumBikesAtStation(ctx, name)
+			return bikeCounts{numClassics, numEbikes}, err
+		})
 		if err != nil {
-			slog.Error("failed to get citibike station status", "err", err, "station", name)
-			w.WriteHeader(http.StatusServiceUnavailable)
-			return
+			return nil, fmt.Errorf("citibike station %s: %w", name, err)
 		}
+		data.Freshness = data.Freshness.Merge(freshness.In(s.tz))
 		data.Stations = append(data.Stations, api.CitibikeStation{
 			Name:       name,
-			TotalBikes: numClassics + numEbikes,
-			NumBikes:   numClassics,
-			NumEbikes:  numEbikes,
+			TotalBikes: counts.classics + counts.ebikes,
+			NumBikes:   counts.classics,
+			NumEbikes:  counts.ebikes,
 		})
 	}
 
-	s.executeTemplate(w, "Citibike", data)
+	return data, nil
 }
 
 func (s *Server) HandleBikesFull(w http.ResponseWriter, r *http.Request) {
@@ -171,7 +181,7 @@ func (s *Server) HandleCitiBikeHistory(w http.ResponseWriter, r *http.Request) {
 		Stations:  stations,
 	}
 
-	s.executeTemplate(w, "CitibikeHistory", dataPayload)
+	s.render(w, r, "CitibikeHistory", dataPayload)
 }
 
 type Bucket struct {
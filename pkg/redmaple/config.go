@@ -1,128 +1,656 @@
 package redmaple
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	subway "github.com/mpoegel/red-maple/pkg/subway"
 )
 
 type Config struct {
-	Port             int
-	StaticDir        string
-	VendorDir        string
-	Timezone         string
-	CitibikeStations []string
-	SubwayStops      string
-	WeatherLocation  string
-	WeatherAPIKey    string
-	HomeAssistant    HomeAssistantConfig
-	ExportInterval   time.Duration
-	S3               S3Config
-	NycDataAppKey    string
-	CacheDir         string
+	Port             int                `json:"port"`
+	StaticDir        string             `json:"static_dir"`
+	VendorDir        string             `json:"vendor_dir"`
+	Timezone         string             `json:"timezone"`
+	CitibikeStations []string           `json:"citibike_stations"`
+	SubwayStops      []SubwayStopConfig `json:"subway_stops"`
+	// SubwayPollInterval is how often the subway feeds are downloaded.
+	SubwayPollInterval time.Duration `json:"subway_poll_interval"`
+	// SubwayRecordDir saves every subway feed download under this directory
+	// if set, to be replayed with SubwayReplayDir.
+	SubwayRecordDir string `json:"subway_record_dir"`
+	// SubwayRecordRetention is how long recorded snapshots are kept, or 0 to
+	// keep them all.
+	SubwayRecordRetention time.Duration `json:"subway_record_retention"`
+	// SubwayReplayDir serves the subway feeds from a recording in this
+	// directory instead of from the MTA if set.
+	SubwayReplayDir string              `json:"subway_replay_dir"`
+	WeatherLocation string              `json:"weather_location"`
+	WeatherAPIKey   string              `json:"weather_api_key"`
+	HomeAssistant   HomeAssistantConfig `json:"home_assistant"`
+	ExportInterval  time.Duration       `json:"export_interval"`
+	S3              S3Config            `json:"s3"`
+	NycDataAppKey   string              `json:"nycdata_app_key"`
+	CacheDir        string              `json:"cache_dir"`
+	Health          HealthConfig        `json:"health"`
+	Layouts         map[string]Layout   `json:"layouts"`
+	BusTimeAPIKey   string              `json:"bustime_api_key"`
+	BusStops        []BusStopConfig     `json:"bus_stops"`
+	// ElevatorOutagesURL is the base URL of the MTA's elevator and escalator
+	// outage feeds, e.g. elevators.DefaultBaseURL. Stations with outages are
+	// not flagged if it is empty, which is the default.
+	ElevatorOutagesURL string `json:"elevator_outages_url"`
+	// Transit adds a tile for each agency with GTFS-realtime feeds, such as
+	// the LIRR or NYC Ferry.
+	Transit []TransitConfig `json:"transit"`
 }
 
 type HomeAssistantConfig struct {
-	Endpoint          string
-	APIKey            string
-	OutdoorTempID     string
-	OutdoorHumidityID string
-	IndoorTempID      string
-	IndoorHumidityID  string
+	Endpoint          string `json:"endpoint"`
+	APIKey            string `json:"api_key"`
+	OutdoorTempID     string `json:"outdoor_temp_id"`
+	OutdoorHumidityID string `json:"outdoor_humidity_id"`
+	IndoorTempID      string `json:"indoor_temp_id"`
+	IndoorHumidityID  string `json:"indoor_humidity_id"`
+}
+
+type SubwayStopConfig struct {
+	ID string `json:"id"`
+	// Label is shown instead of the stop name if set.
+	Label string `json:"label"`
+	// Routes limits the trains shown to these lines, e.g. only the Q at a
+	// platform shared with the N, R and W. All lines are shown if empty.
+	Routes []subway.TrainLine `json:"routes"`
+	// WalkTime is how long it takes to walk to the stop. Trains arriving
+	// sooner are shown as missed.
+	WalkTime time.Duration `json:"walk_time"`
+}
+
+type BusStopConfig struct {
+	// ID is the Bus Time stop code posted at the stop, e.g. 308209.
+	ID string `json:"id"`
+	// Label is shown instead of the stop name if set.
+	Label string `json:"label"`
+	// Lines limits the buses shown to these lines, e.g. only the B63 at a
+	// stop shared with the B103. All lines are shown if empty.
+	Lines []string `json:"lines"`
+}
+
+// TransitConfig is an agency shown in its own tile, named Name.
+type TransitConfig struct {
+	Name string `json:"name"`
+	// Label is shown at the top of the tile instead of Name if set.
+	Label string `json:"label"`
+	// GTFS is the path to the agency's static GTFS zip.
+	GTFS string `json:"gtfs"`
+	// Feeds are the GTFS-realtime feed URLs of the agency.
+	Feeds []string `json:"feeds"`
+	// APIKey is sent in the APIKeyHeader header of every feed request.
+	APIKeyHeader string              `json:"api_key_header"`
+	APIKey       string              `json:"api_key"`
+	Stops        []TransitStopConfig `json:"stops"`
+}
+
+type TransitStopConfig struct {
+	// ID is a stop_id from the agency's stops.txt. Stations include the trips
+	// at all of their platforms.
+	ID string `json:"id"`
+	// Label is shown instead of the stop name if set.
+	Label string `json:"label"`
+	// Routes limits the trips shown to these route IDs. All routes are shown
+	// if empty.
+	Routes []string `json:"routes"`
+}
+
+// sameClient reports whether t and other can share a client, which only
+// depends on the static data and the feeds.
+func (t TransitConfig) sameClient(other TransitConfig) bool {
+	return t.GTFS == other.GTFS && slices.Equal(t.Feeds, other.Feeds) &&
+		t.APIKeyHeader == other.APIKeyHeader && t.APIKey == other.APIKey
+}
+
+type HealthConfig struct {
+	// Critical lists the dependencies that make the server unavailable, rather
+	// than degraded, when they are down.
+	Critical []string `json:"critical"`
+	// StaleAfter is how long a dependency may keep failing after its last
+	// success before it is considered down.
+	StaleAfter time.Duration `json:"stale_after"`
 }
 
 type S3Config struct {
-	Enabled       bool
-	Endpoint      string
-	Scheme        string
-	Bucket        string
-	Region        string
-	AccessKey     string
-	SecretKey     string
-	RetentionDays int
-	FlushInterval time.Duration
+	Enabled       bool          `json:"enabled"`
+	Endpoint      string        `json:"endpoint"`
+	Scheme        string        `json:"scheme"`
+	Bucket        string        `json:"bucket"`
+	Region        string        `json:"region"`
+	AccessKey     string        `json:"access_key"`
+	SecretKey     string        `json:"secret_key"`
+	RetentionDays int           `json:"retention_days"`
+	FlushInterval time.Duration `json:"flush_interval"`
 }
 
-func LoadConfig() Config {
+// DefaultConfig returns the configuration used when neither a config file nor
+// environment variables are provided.
+func DefaultConfig() Config {
 	return Config{
-		Port:             loadIntEnv("PORT", 6556),
-		StaticDir:        loadStrEnv("STATIC_DIR", "./static"),
-		VendorDir:        loadStrEnv("VENDOR_DIR", "./vendored"),
-		Timezone:         loadStrEnv("TIMEZONE", "America/New_York"),
-		CitibikeStations: loadStrListEnv("CITIBIKE_STATIONS", []string{"Park Ave & E 42 St", "Park Ave & E 41 St"}),
-		SubwayStops:      loadStrEnv("SUBWAY_STOPS", "L03S,G29N"),
-		WeatherLocation:  loadStrEnv("WEATHER_LOC", "40.75261,-73.97728"),
-		WeatherAPIKey:    loadStrEnv("WEATHER_API_KEY", ""),
+		Port:                  6556,
+		StaticDir:             "./static",
+		VendorDir:             "./vendored",
+		Timezone:              "America/New_York",
+		CitibikeStations:      []string{"Park Ave & E 42 St", "Park Ave & E 41 St"},
+		SubwayStops:           []SubwayStopConfig{{ID: "L03S"}, {ID: "G29N"}},
+		SubwayPollInterval:    30 * time.Second,
+		SubwayRecordRetention: 24 * time.Hour,
+		WeatherLocation:       "40.75261,-73.97728",
 		HomeAssistant: HomeAssistantConfig{
-			Endpoint:          loadStrEnv("HA_ENDPOINT", "http://localhost:8123"),
-			APIKey:            loadStrEnv("HA_API_KEY", ""),
-			OutdoorTempID:     loadStrEnv("HA_OUTDOOR_TEMP_ID", ""),
-			OutdoorHumidityID: loadStrEnv("HA_OUTDOOR_HUMID_ID", ""),
-			IndoorTempID:      loadStrEnv("HA_INDOOR_TEMP_ID", ""),
-			IndoorHumidityID:  loadStrEnv("HA_INDOOR_HUMID_ID", ""),
+			Endpoint: "http://localhost:8123",
 		},
-		ExportInterval: loadDurationEnv("EXPORT_INTERVAL", 1*time.Minute),
+		ExportInterval: 1 * time.Minute,
 		S3: S3Config{
-			Enabled:       loadBoolEnv("S3_ENABLED", false),
-			Endpoint:      loadStrEnv("S3_ENDPOINT", ""),
-			Scheme:        loadStrEnv("S3_SCHEME", "https"),
-			Bucket:        loadStrEnv("S3_BUCKET", ""),
-			Region:        loadStrEnv("S3_REGION", "us-east-1"),
-			AccessKey:     loadStrEnv("S3_ACCESS_KEY", ""),
-			SecretKey:     loadStrEnv("S3_SECRET_KEY", ""),
-			RetentionDays: loadIntEnv("S3_RETENTION_DAYS", 30),
-			FlushInterval: loadDurationEnv("S3_FLUSH_INTERVAL", 1*time.Minute),
+			Scheme:        "https",
+			Region:        "us-east-1",
+			RetentionDays: 30,
+			FlushInterval: 1 * time.Minute,
+		},
+		CacheDir: ".cache",
+		Health: HealthConfig{
+			Critical:   []string{"subway", "weather"},
+			StaleAfter: 5 * time.Minute,
 		},
-		NycDataAppKey: loadStrEnv("NYCDATA_APP_KEY", ""),
-		CacheDir:      loadStrEnv("CACHE_DIR", ".cache"),
+		Layouts: defaultLayouts(),
 	}
 }
 
-func loadStrEnv(name, defaultVal string) string {
-	val, ok := os.LookupEnv(name)
-	if !ok {
-		return defaultVal
+// LoadConfig reads the configuration from environment variables only. Malformed
+// values are ignored and fall back to their defaults; use ReadConfig to have
+// them reported instead.
+func LoadConfig() Config {
+	config := DefaultConfig()
+	config.loadEnv()
+	return config
+}
+
+// ReadConfig layers the JSON config file at filename (if not empty) over the
+// defaults, then applies any environment variable overrides and validates the
+// result. All invalid fields are reported together in the returned error.
+func ReadConfig(filename string) (Config, error) {
+	config := DefaultConfig()
+	if filename != "" {
+		if err := config.loadFile(filename); err != nil {
+			return config, err
+		}
+	}
+	errs := config.loadEnv()
+	if err := config.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	return config, errors.Join(errs...)
+}
+
+func (c *Config) loadFile(filename string) error {
+	fp, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	decoder := json.NewDecoder(fp)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() []error {
+	env := envLoader{}
+	env.integer("PORT", &c.Port)
+	env.str("STATIC_DIR", &c.StaticDir)
+	env.str("VENDOR_DIR", &c.VendorDir)
+	env.str("TIMEZONE", &c.Timezone)
+	env.strList("CITIBIKE_STATIONS", &c.CitibikeStations)
+	env.subwayStops("SUBWAY_STOPS", &c.SubwayStops)
+	env.duration("SUBWAY_POLL_INTERVAL", &c.SubwayPollInterval)
+	env.str("SUBWAY_RECORD_DIR", &c.SubwayRecordDir)
+	env.duration("SUBWAY_RECORD_RETENTION", &c.SubwayRecordRetention)
+	env.str("SUBWAY_REPLAY_DIR", &c.SubwayReplayDir)
+	env.str("WEATHER_LOC", &c.WeatherLocation)
+	env.str("WEATHER_API_KEY", &c.WeatherAPIKey)
+	env.str("HA_ENDPOINT", &c.HomeAssistant.Endpoint)
+	env.str("HA_API_KEY", &c.HomeAssistant.APIKey)
+	env.str("HA_OUTDOOR_TEMP_ID", &c.HomeAssistant.OutdoorTempID)
+	env.str("HA_OUTDOOR_HUMID_ID", &c.HomeAssistant.OutdoorHumidityID)
+	env.str("HA_INDOOR_TEMP_ID", &c.HomeAssistant.IndoorTempID)
+	env.str("HA_INDOOR_HUMID_ID", &c.HomeAssistant.IndoorHumidityID)
+	env.duration("EXPORT_INTERVAL", &c.ExportInterval)
+	env.boolean("S3_ENABLED", &c.S3.Enabled)
+	env.str("S3_ENDPOINT", &c.S3.Endpoint)
+	env.str("S3_SCHEME", &c.S3.Scheme)
+	env.str("S3_BUCKET", &c.S3.Bucket)
+	env.str("S3_REGION", &c.S3.Region)
+	env.str("S3_ACCESS_KEY", &c.S3.AccessKey)
+	env.str("S3_SECRET_KEY", &c.S3.SecretKey)
+	env.integer("S3_RETENTION_DAYS", &c.S3.RetentionDays)
+	env.duration("S3_FLUSH_INTERVAL", &c.S3.FlushInterval)
+	env.str("BUSTIME_API_KEY", &c.BusTimeAPIKey)
+	env.busStops("BUS_STOPS", &c.BusStops)
+	env.str("ELEVATOR_OUTAGES_URL", &c.ElevatorOutagesURL)
+	env.str("NYCDATA_APP_KEY", &c.NycDataAppKey)
+	env.str("CACHE_DIR", &c.CacheDir)
+	env.strList("HEALTH_CRITICAL", &c.Health.Critical)
+	env.duration("HEALTH_STALE_AFTER", &c.Health.StaleAfter)
+	env.layout("DASHBOARD_LAYOUT", &c.Layouts)
+	return env.errs
+}
+
+// Validate checks every field of the config and returns an error listing all
+// of the invalid ones.
+func (c Config) Validate() error {
+	errs := []error{}
+	if c.Port <= 0 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port: %d is out of range", c.Port))
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %w", err))
+	}
+	if _, _, err := parseLatLon(c.WeatherLocation); err != nil {
+		errs = append(errs, fmt.Errorf("weather_location: %w", err))
+	}
+	for _, name := range c.CitibikeStations {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, errors.New("citibike_stations: empty station name"))
+		}
+	}
+	if err := c.validateSubwayStops(); err != nil {
+		errs = append(errs, fmt.Errorf("subway_stops: %w", err))
+	}
+	if c.SubwayPollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("subway_poll_interval: %v must be positive", c.SubwayPollInterval))
+	}
+	if c.SubwayRecordRetention < 0 {
+		errs = append(errs, fmt.Errorf("subway_record_retention: %v must not be negative", c.SubwayRecordRetention))
+	}
+	if c.SubwayReplayDir != "" {
+		if c.SubwayRecordDir != "" {
+			errs = append(errs, errors.New("subway_record_dir: cannot record while replaying subway_replay_dir"))
+		}
+		if _, err := subway.OpenFeedReplay(c.SubwayReplayDir); err != nil {
+			errs = append(errs, fmt.Errorf("subway_replay_dir: %w", err))
+		}
+	}
+	if _, err := url.ParseRequestURI(c.HomeAssistant.Endpoint); err != nil {
+		errs = append(errs, fmt.Errorf("home_assistant.endpoint: %w", err))
+	}
+	if c.ExportInterval <= 0 {
+		errs = append(errs, fmt.Errorf("export_interval: %v must be positive", c.ExportInterval))
+	}
+	if len(c.BusStops) > 0 && c.BusTimeAPIKey == "" {
+		errs = append(errs, errors.New("bus_stops: bustime_api_key is required"))
+	}
+	for _, stop := range c.BusStops {
+		if strings.TrimSpace(stop.ID) == "" {
+			errs = append(errs, errors.New("bus_stops: empty stop id"))
+		}
+	}
+	if c.ElevatorOutagesURL != "" {
+		if _, err := url.ParseRequestURI(c.ElevatorOutagesURL); err != nil {
+			errs = append(errs, fmt.Errorf("elevator_outages_url: %w", err))
+		}
 	}
-	return val
+	if err := c.validateTransit(); err != nil {
+		errs = append(errs, fmt.Errorf("transit: %w", err))
+	}
+	for _, dep := range c.Health.Critical {
+		if !slices.Contains(dependencies, dep) && !slices.Contains(c.transitNames(), dep) {
+			errs = append(errs, fmt.Errorf("health.critical: unknown dependency %q", dep))
+		}
+	}
+	if c.Health.StaleAfter <= 0 {
+		errs = append(errs, fmt.Errorf("health.stale_after: %v must be positive", c.Health.StaleAfter))
+	}
+	if err := c.validateLayouts(); err != nil {
+		errs = append(errs, fmt.Errorf("layouts: %w", err))
+	}
+	if c.S3.Enabled {
+		if c.S3.Bucket == "" {
+			errs = append(errs, errors.New("s3.bucket: required when s3 is enabled"))
+		}
+		if c.S3.AccessKey == "" || c.S3.SecretKey == "" {
+			errs = append(errs, errors.New("s3.access_key, s3.secret_key: required when s3 is enabled"))
+		}
+		if c.S3.Scheme != "http" && c.S3.Scheme != "https" {
+			errs = append(errs, fmt.Errorf("s3.scheme: %q must be http or https", c.S3.Scheme))
+		}
+		if c.S3.RetentionDays <= 0 {
+			errs = append(errs, fmt.Errorf("s3.retention_days: %d must be positive", c.S3.RetentionDays))
+		}
+		if c.S3.FlushInterval <= 0 {
+			errs = append(errs, fmt.Errorf("s3.flush_interval: %v must be positive", c.S3.FlushInterval))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c Config) validateSubwayStops() error {
+	stopMap, err := subway.LoadStops(c.vendorFS())
+	if err != nil {
+		return err
+	}
+	errs := []error{}
+	for _, stop := range c.SubwayStops {
+		if _, ok := stopMap[stop.ID]; !ok {
+			errs = append(errs, fmt.Errorf("unknown stop %q", stop.ID))
+		}
+		for _, route := range stop.Routes {
+			if subway.ParseTrainLine(string(route)) == subway.UnknownTrain {
+				errs = append(errs, fmt.Errorf("%s: unknown route %q", stop.ID, route))
+			}
+		}
+		if stop.WalkTime < 0 {
+			errs = append(errs, fmt.Errorf("%s: walk time %v must not be negative", stop.ID, stop.WalkTime))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-func loadBoolEnv(name string, defaultVal bool) bool {
+func (c Config) validateTransit() error {
+	errs := []error{}
+	for i, agency := range c.Transit {
+		if agency.Name == "" {
+			errs = append(errs, fmt.Errorf("%d: name is required", i))
+			continue
+		}
+		if url.PathEscape(agency.Name) != agency.Name {
+			errs = append(errs, fmt.Errorf("%s: name must be usable in a URL path", agency.Name))
+		}
+		if slices.Contains(tileNames(), agency.Name) || slices.Contains(dependencies, agency.Name) || isPartialPath(agency.Name) {
+			errs = append(errs, fmt.Errorf("%s: name is already used by a built-in tile, route or dependency", agency.Name))
+		}
+		if slices.Contains(c.transitNames()[:i], agency.Name) {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", agency.Name))
+		}
+		if len(agency.Feeds) == 0 {
+			errs = append(errs, fmt.Errorf("%s: at least one feed is required", agency.Name))
+		}
+		for _, feed := range agency.Feeds {
+			if _, err := url.ParseRequestURI(feed); err != nil {
+				errs = append(errs, fmt.Errorf("%s: feeds: %w", agency.Name, err))
+			}
+		}
+		if agency.APIKey != "" && agency.APIKeyHeader == "" {
+			errs = append(errs, fmt.Errorf("%s: api_key_header is required with an api_key", agency.Name))
+		}
+		if agency.GTFS == "" {
+			errs = append(errs, fmt.Errorf("%s: gtfs is required", agency.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// transitNames returns the names of the transit agencies, which are also the
+// names of their tiles and dependencies.
+func (c Config) transitNames() []string {
+	names := []string{}
+	for _, agency := range c.Transit {
+		names = append(names, agency.Name)
+	}
+	return names
+}
+
+// parseSubwayStops parses the SUBWAY_STOPS syntax, a comma-separated list of
+// id[@walk][:routes[:label]] entries with the routes separated by "+".
+func parseSubwayStops(s string) ([]SubwayStopConfig, error) {
+	stops := []SubwayStopConfig{}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		stop := SubwayStopConfig{ID: parts[0]}
+		if id, walk, ok := strings.Cut(parts[0], "@"); ok {
+			walkTime, err := time.ParseDuration(walk)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid walk time %q", id, walk)
+			}
+			stop.ID, stop.WalkTime = id, walkTime
+		}
+		if len(parts) > 1 && parts[1] != "" {
+			for _, route := range strings.Split(parts[1], "+") {
+				stop.Routes = append(stop.Routes, subway.TrainLine(route))
+			}
+		}
+		if len(parts) > 2 {
+			stop.Label = parts[2]
+		}
+		stops = append(stops, stop)
+	}
+	return stops, nil
+}
+
+// parseBusStops parses the BUS_STOPS syntax, a comma-separated list of
+// id[:lines[:label]] entries with the lines separated by "+".
+func parseBusStops(s string) []BusStopConfig {
+	stops := []BusStopConfig{}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+		stop := BusStopConfig{ID: parts[0]}
+		if len(parts) > 1 && parts[1] != "" {
+			stop.Lines = strings.Split(parts[1], "+")
+		}
+		if len(parts) > 2 {
+			stop.Label = parts[2]
+		}
+		stops = append(stops, stop)
+	}
+	return stops
+}
+
+// UnmarshalJSON accepts durations in the config file as strings such as "30s".
+// subway_stops may be a list or a string in the SUBWAY_STOPS syntax.
+func (c *Config) UnmarshalJSON(b []byte) error {
+	type config Config
+	aux := struct {
+		*config
+		ExportInterval        *jsonDuration `json:"export_interval"`
+		SubwayStops           *subwayStops  `json:"subway_stops"`
+		SubwayPollInterval    *jsonDuration `json:"subway_poll_interval"`
+		SubwayRecordRetention *jsonDuration `json:"subway_record_retention"`
+	}{
+		config:                (*config)(c),
+		ExportInterval:        (*jsonDuration)(&c.ExportInterval),
+		SubwayStops:           (*subwayStops)(&c.SubwayStops),
+		SubwayPollInterval:    (*jsonDuration)(&c.SubwayPollInterval),
+		SubwayRecordRetention: (*jsonDuration)(&c.SubwayRecordRetention),
+	}
+	return decodeStrict(b, &aux)
+}
+
+// UnmarshalJSON accepts durations in the config file as strings such as "30s".
+func (c *S3Config) UnmarshalJSON(b []byte) error {
+	type s3Config S3Config
+	aux := struct {
+		*s3Config
+		FlushInterval *jsonDuration `json:"flush_interval"`
+	}{s3Config: (*s3Config)(c), FlushInterval: (*jsonDuration)(&c.FlushInterval)}
+	return decodeStrict(b, &aux)
+}
+
+// UnmarshalJSON accepts durations in the config file as strings such as "30s".
+func (c *HealthConfig) UnmarshalJSON(b []byte) error {
+	type healthConfig HealthConfig
+	aux := struct {
+		*healthConfig
+		StaleAfter *jsonDuration `json:"stale_after"`
+	}{healthConfig: (*healthConfig)(c), StaleAfter: (*jsonDuration)(&c.StaleAfter)}
+	return decodeStrict(b, &aux)
+}
+
+// subwayStops accepts subway_stops in the config file either as a list of
+// stops or as a string in the SUBWAY_STOPS syntax.
+type subwayStops []SubwayStopConfig
+
+func (s *subwayStops) UnmarshalJSON(b []byte) error {
+	var str string
+	if err := json.Unmarshal(b, &str); err == nil {
+		stops, err := parseSubwayStops(str)
+		if err != nil {
+			return err
+		}
+		*s = stops
+		return nil
+	}
+	return decodeStrict(b, (*[]SubwayStopConfig)(s))
+}
+
+// UnmarshalJSON accepts walk_time as a string such as "6m".
+func (c *SubwayStopConfig) UnmarshalJSON(b []byte) error {
+	type subwayStopConfig SubwayStopConfig
+	aux := struct {
+		*subwayStopConfig
+		WalkTime *jsonDuration `json:"walk_time"`
+	}{subwayStopConfig: (*subwayStopConfig)(c), WalkTime: (*jsonDuration)(&c.WalkTime)}
+	return decodeStrict(b, &aux)
+}
+
+// decodeStrict decodes b into v, rejecting unknown keys. The UnmarshalJSON
+// methods use it so that the DisallowUnknownFields set when reading the config
+// file also applies below their aux structs.
+func decodeStrict(b []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+type jsonDuration time.Duration
+
+func (d *jsonDuration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	val, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = jsonDuration(val)
+	return nil
+}
+
+func parseLatLon(s string) (lat, lon float64, err error) {
+	coords := strings.Split(s, ",")
+	if len(coords) != 2 {
+		return 0, 0, fmt.Errorf("%q is not a lat,lon pair", s)
+	}
+	lat, err1 := strconv.ParseFloat(strings.TrimSpace(coords[0]), 64)
+	lon, err2 := strconv.ParseFloat(strings.TrimSpace(coords[1]), 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errors.Join(err1, err2)
+	}
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("%q is out of range", s)
+	}
+	return lat, lon, nil
+}
+
+// envLoader overrides config fields from environment variables, collecting an
+// error for each variable that is set but cannot be parsed. Fields with
+// malformed values keep their previous value.
+type envLoader struct {
+	errs []error
+}
+
+func (l *envLoader) str(name string, dst *string) {
+	if val, ok := os.LookupEnv(name); ok {
+		*dst = val
+	}
+}
+
+func (l *envLoader) strList(name string, dst *[]string) {
 	val, ok := os.LookupEnv(name)
-	if !ok {
-		return defaultVal
+	switch {
+	case !ok:
+	case val == "":
+		*dst = []string{}
+	default:
+		*dst = strings.Split(val, ",")
+	}
+}
+
+func (l *envLoader) boolean(name string, dst *bool) {
+	if val, ok := os.LookupEnv(name); ok {
+		*dst = strings.ToLower(val) == "true" || val == "1"
 	}
-	return strings.ToLower(val) == "true" || val == "1"
 }
 
-func loadIntEnv(name string, defaultVal int) int {
+func (l *envLoader) integer(name string, dst *int) {
 	valStr, ok := os.LookupEnv(name)
 	if !ok {
-		return defaultVal
+		return
 	}
 	val, err := strconv.Atoi(valStr)
 	if err != nil {
-		return defaultVal
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid integer %q", name, valStr))
+		return
 	}
-	return val
+	*dst = val
 }
 
-func loadDurationEnv(name string, defaultVal time.Duration) time.Duration {
+func (l *envLoader) duration(name string, dst *time.Duration) {
 	valStr, ok := os.LookupEnv(name)
 	if !ok {
-		return defaultVal
+		return
 	}
 	val, err := time.ParseDuration(valStr)
 	if err != nil {
-		return defaultVal
+		l.errs = append(l.errs, fmt.Errorf("%s: invalid duration %q", name, valStr))
+		return
 	}
-	return val
+	*dst = val
 }
 
-func loadStrListEnv(name string, defaultVal []string) []string {
+func (l *envLoader) subwayStops(name string, dst *[]SubwayStopConfig) {
 	val, ok := os.LookupEnv(name)
 	if !ok {
-		return defaultVal
+		return
+	}
+	stops, err := parseSubwayStops(val)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return
+	}
+	*dst = stops
+}
+
+func (l *envLoader) busStops(name string, dst *[]BusStopConfig) {
+	val, ok := os.LookupEnv(name)
+	switch {
+	case !ok:
+	case val == "":
+		*dst = []BusStopConfig{}
+	default:
+		*dst = parseBusStops(val)
+	}
+}
+
+// layout sets the default layout.
+func (l *envLoader) layout(name string, dst *map[string]Layout) {
+	valStr, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	val, err := parseLayout(valStr)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", name, err))
+		return
+	}
+	if *dst == nil {
+		*dst = map[string]Layout{}
 	}
-	return strings.Split(val, ",")
+	(*dst)[DefaultLayout] = val
 }
@@ -1,10 +1,15 @@
 package redmaple_test
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
 )
 
 func TestLoadConfigWithValidValues(t *testing.T) {
@@ -54,8 +59,8 @@ func TestLoadConfigWithValidValues(t *testing.T) {
 	if config.CitibikeStations[2] != "Station C" {
 		t.Errorf("expected third station=Station C, got %s", config.CitibikeStations[2])
 	}
-	if config.SubwayStops != "L03N,L04S" {
-		t.Errorf("expected SUBWAY_STOPS=L03N,L04S, got %s", config.SubwayStops)
+	if len(config.SubwayStops) != 2 || config.SubwayStops[0].ID != "L03N" || config.SubwayStops[1].ID != "L04S" {
+		t.Errorf("expected SUBWAY_STOPS=L03N,L04S, got %v", config.SubwayStops)
 	}
 	if config.WeatherLocation != "40.7128,-74.0060" {
 		t.Errorf("expected WEATHER_LOC=40.7128,-74.0060, got %s", config.WeatherLocation)
@@ -105,3 +110,176 @@ func TestLoadConfigWithInvalidValues(t *testing.T) {
 		t.Errorf("expected EXPORT_INTERVAL=1m (default), got %v", config.ExportInterval)
 	}
 }
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return filename
+}
+
+func TestReadConfigFromFile(t *testing.T) {
+	filename := writeConfigFile(t, `{
+		"port": 8080,
+		"vendor_dir": "../../vendored",
+		"subway_stops": "L03N,G29S",
+		"weather_location": "40.7128,-74.0060",
+		"export_interval": "30s",
+		"subway_poll_interval": "15s",
+		"home_assistant": {"endpoint": "http://ha.local:8123", "indoor_temp_id": "sensor.indoor_temp"},
+		"s3": {"enabled": true, "bucket": "maple", "access_key": "a", "secret_key": "b", "flush_interval": "5m"}
+	}`)
+
+	config, err := redmaple.ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Port != 8080 {
+		t.Errorf("expected port=8080, got %d", config.Port)
+	}
+	if len(config.SubwayStops) != 2 || config.SubwayStops[0].ID != "L03N" || config.SubwayStops[1].ID != "G29S" {
+		t.Errorf("expected subway_stops=L03N,G29S, got %v", config.SubwayStops)
+	}
+	if config.ExportInterval != 30*time.Second {
+		t.Errorf("expected export_interval=30s, got %v", config.ExportInterval)
+	}
+	if config.SubwayPollInterval != 15*time.Second {
+		t.Errorf("expected subway_poll_interval=15s, got %v", config.SubwayPollInterval)
+	}
+	if config.HomeAssistant.IndoorTempID != "sensor.indoor_temp" {
+		t.Errorf("expected indoor_temp_id=sensor.indoor_temp, got %s", config.HomeAssistant.IndoorTempID)
+	}
+	if config.S3.FlushInterval != 5*time.Minute {
+		t.Errorf("expected s3.flush_interval=5m, got %v", config.S3.FlushInterval)
+	}
+	if config.S3.Region != "us-east-1" {
+		t.Errorf("expected s3.region to keep its default, got %s", config.S3.Region)
+	}
+	if config.Timezone != "America/New_York" {
+		t.Errorf("expected timezone to keep its default, got %s", config.Timezone)
+	}
+}
+
+func TestReadConfigSubwayStops(t *testing.T) {
+	filename := writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"subway_stops": [
+			{"id": "L03S", "label": "L to Brooklyn"},
+			{"id": "R20N", "routes": ["Q"], "walk_time": "6m"}
+		]
+	}`)
+
+	config, err := redmaple.ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []redmaple.SubwayStopConfig{
+		{ID: "L03S", Label: "L to Brooklyn"},
+		{ID: "R20N", Routes: []subway.TrainLine{subway.QTrain}, WalkTime: 6 * time.Minute},
+	}
+	if !reflect.DeepEqual(config.SubwayStops, want) {
+		t.Errorf("expected subway_stops=%v, got %v", want, config.SubwayStops)
+	}
+}
+
+func TestLoadConfigSubwayStopsFromEnv(t *testing.T) {
+	t.Setenv("SUBWAY_STOPS", "L03S@4m30s,R20N:N+Q:Union Sq: uptown,G29N::Metropolitan")
+
+	config := redmaple.LoadConfig()
+	want := []redmaple.SubwayStopConfig{
+		{ID: "L03S", WalkTime: 4*time.Minute + 30*time.Second},
+		{ID: "R20N", Routes: []subway.TrainLine{subway.NTrain, subway.QTrain}, Label: "Union Sq: uptown"},
+		{ID: "G29N", Label: "Metropolitan"},
+	}
+	if !reflect.DeepEqual(config.SubwayStops, want) {
+		t.Errorf("expected SUBWAY_STOPS=%v, got %v", want, config.SubwayStops)
+	}
+}
+
+func TestReadConfigInvalidWalkTime(t *testing.T) {
+	filename := writeConfigFile(t, `{"vendor_dir": "../../vendored", "subway_stops": [{"id": "L03S", "walk_time": "-2m"}]}`)
+
+	_, err := redmaple.ReadConfig(filename)
+	if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+		t.Errorf("expected the negative walk time to be reported, got %v", err)
+	}
+
+	t.Setenv("SUBWAY_STOPS", "L03S@soon")
+	_, err = redmaple.ReadConfig(filename)
+	if err == nil || !strings.Contains(err.Error(), `invalid walk time "soon"`) {
+		t.Errorf("expected the invalid SUBWAY_STOPS walk time to be reported, got %v", err)
+	}
+}
+
+func TestReadConfigEnvOverridesFile(t *testing.T) {
+	filename := writeConfigFile(t, `{"port": 8080, "vendor_dir": "../../vendored"}`)
+	t.Setenv("PORT", "9090")
+
+	config, err := redmaple.ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Port != 9090 {
+		t.Errorf("expected PORT=9090 from env, got %d", config.Port)
+	}
+}
+
+func TestReadConfigReportsEveryInvalidField(t *testing.T) {
+	filename := writeConfigFile(t, `{"vendor_dir": "../../vendored", "timezone": "Mars/Olympus_Mons"}`)
+	t.Setenv("PORT", "abc")
+	t.Setenv("EXPORT_INTERVAL", "5 minutes")
+	t.Setenv("WEATHER_LOC", "40.75")
+	t.Setenv("SUBWAY_STOPS", "L03S,X99N,R20N:Z9")
+	t.Setenv("ELEVATOR_OUTAGES_URL", "mta.info")
+	t.Setenv("SUBWAY_RECORD_RETENTION", "-1h")
+
+	_, err := redmaple.ReadConfig(filename)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"PORT", "EXPORT_INTERVAL", "timezone", "weather_location", "X99N", "Z9", "elevator_outages_url", "subway_record_retention"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "L03S") {
+		t.Errorf("expected known stop L03S to be accepted, got %v", err)
+	}
+}
+
+func TestReadConfigUnknownField(t *testing.T) {
+	for field, body := range map[string]string{
+		"prot":         `{"vendor_dir": "../../vendored", "prot": 8080}`,
+		"stale_afterr": `{"vendor_dir": "../../vendored", "health": {"stale_afterr": "1m"}}`,
+	} {
+		t.Run(field, func(t *testing.T) {
+			filename := writeConfigFile(t, body)
+			_, err := redmaple.ReadConfig(filename)
+			if err == nil {
+				t.Fatal("expected error for unknown field, got nil")
+			}
+			if !strings.Contains(err.Error(), `unknown field "`+field+`"`) {
+				t.Errorf("expected error to name the unknown field, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadConfigSubwayReplay(t *testing.T) {
+	filename := writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"subway_record_dir": "recordings",
+		"subway_replay_dir": "`+t.TempDir()+`"
+	}`)
+	_, err := redmaple.ReadConfig(filename)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"cannot record while replaying", "subway_replay_dir: no feed snapshots"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
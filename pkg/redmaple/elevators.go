@@ -0,0 +1,81 @@
+package redmaple
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	elevators "github.com/mpoegel/red-maple/pkg/elevators"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+)
+
+// getOutages returns the elevator and escalator outages, falling back to the
+// last known good outages if the feed is failing. It returns none if outages
+// are disabled or have never been read, since they only add to the subway data.
+func (s *Server) getOutages(ctx context.Context) []elevators.Outage {
+	if s.elevatorCli == nil {
+		return nil
+	}
+	outages, _, err := fallback.Fetch(ctx, s.fallback, "elevators", "outages", s.elevatorCli.GetOutages)
+	if err != nil {
+		slog.Warn("failed to get elevator outages", "err", err)
+		return nil
+	}
+	return outages
+}
+
+// StationAccessibility lists the outages at the station of stopID as of now,
+// which also sets the time zone they are shown in.
+func StationAccessibility(outages []elevators.Outage, stopID string, now time.Time) api.StationAccessibility {
+	res := api.StationAccessibility{Outages: []api.EquipmentOutage{}}
+	for _, outage := range elevators.AtStop(outages, stopID) {
+		if !outage.EstimatedReturn.IsZero() && !now.Before(outage.EstimatedReturn) {
+			continue
+		}
+		upcoming := outage.IsUpcoming(now)
+		equipment := api.EquipmentOutage{
+			Equipment:  outage.Equipment,
+			Type:       "elevator",
+			Serving:    outage.Serving,
+			IsADA:      outage.IsADA,
+			IsUpcoming: upcoming,
+			Start:      outage.Start.In(now.Location()).Format("Mon Jan 2 3:04 PM"),
+			Reason:     outage.Reason,
+		}
+		if outage.Type == elevators.Escalator {
+			equipment.Type = "escalator"
+		}
+		if !outage.EstimatedReturn.IsZero() {
+			equipment.Until = outage.EstimatedReturn.In(now.Location()).Format("Mon Jan 2 3:04 PM")
+		}
+		res.Outages = append(res.Outages, equipment)
+
+		switch {
+		case upcoming:
+			res.HasUpcomingOutage = true
+		case outage.IsADA && outage.Type == elevators.Elevator:
+			res.HasOutage, res.IsInaccessible = true, true
+		default:
+			res.HasOutage = true
+		}
+	}
+	return res
+}
+
+// MarkOutages flags the stations on the diagram of a line that have outages
+// as of now.
+func MarkOutages(sections []api.SubwaySection, outages []elevators.Outage, now time.Time) {
+	if len(outages) == 0 {
+		return
+	}
+	for _, section := range sections {
+		for _, branch := range section.Branches {
+			for i, segment := range branch.Segments {
+				if segment.IsStation {
+					branch.Segments[i].StationAccessibility = StationAccessibility(outages, segment.StationID, now)
+				}
+			}
+		}
+	}
+}
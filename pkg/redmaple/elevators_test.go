@@ -0,0 +1,174 @@
+package redmaple_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	elevators "github.com/mpoegel/red-maple/pkg/elevators"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
+)
+
+func TestStationAccessibility(t *testing.T) {
+	tz, _ := time.LoadLocation("America/New_York")
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, tz)
+	outages := []elevators.Outage{
+		{Equipment: "EL222", Type: elevators.Elevator, StopIDs: []string{"635", "L03", "R20"}, IsADA: true,
+			Start: now.Add(-time.Hour), EstimatedReturn: time.Date(2026, 10, 17, 17, 0, 0, 0, tz)},
+		{Equipment: "ES311", Type: elevators.Escalator, StopIDs: []string{"L03"}, Start: now.Add(-time.Hour)},
+		{Equipment: "EL411", Type: elevators.Elevator, StopIDs: []string{"L08"}, IsADA: true, Start: now.Add(time.Hour)},
+		{Equipment: "EL100", Type: elevators.Elevator, StopIDs: []string{"G29"}, IsADA: true,
+			Start: now.Add(-2 * time.Hour), EstimatedReturn: now.Add(-time.Hour)},
+	}
+
+	got := redmaple.StationAccessibility(outages, "L03N", now)
+	if !got.HasOutage || !got.IsInaccessible || got.HasUpcomingOutage || len(got.Outages) != 2 {
+		t.Errorf("expected an accessible elevator and an escalator out at L03, got %+v", got)
+	}
+	if got.Outages[0].Type != "elevator" || got.Outages[0].Until != "Sat Oct 17 5:00 PM" || got.Outages[1].Type != "escalator" {
+		t.Errorf("unexpected outages at L03: %+v", got.Outages)
+	}
+
+	got = redmaple.StationAccessibility(outages[1:], "L03S", now)
+	if !got.HasOutage || got.IsInaccessible {
+		t.Errorf("expected an escalator outage to leave L03 accessible, got %+v", got)
+	}
+
+	got = redmaple.StationAccessibility(outages, "L08N", now)
+	if got.HasOutage || !got.HasUpcomingOutage || !got.Outages[0].IsUpcoming {
+		t.Errorf("expected an upcoming outage at L08, got %+v", got)
+	}
+
+	got = redmaple.StationAccessibility(outages, "G29N", now)
+	if got.HasOutage || len(got.Outages) != 0 {
+		t.Errorf("expected the elevator at G29 to be back in service, got %+v", got)
+	}
+}
+
+func TestMarkOutages(t *testing.T) {
+	now := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	sections := []api.SubwaySection{{Branches: []api.SubwayBranch{{Segments: []api.SubwaySegment{
+		{},
+		{IsStation: true, StationID: "L03"},
+		{},
+		{IsStation: true, StationID: "L05"},
+	}}}}}
+	outages := []elevators.Outage{{Equipment: "EL222", Type: elevators.Elevator, StopIDs: []string{"L03"}, Start: now.Add(-time.Hour)}}
+
+	redmaple.MarkOutages(sections, outages, now)
+	segments := sections[0].Branches[0].Segments
+	if !segments[1].HasOutage || len(segments[1].Outages) != 1 {
+		t.Errorf("expected an outage at L03, got %+v", segments[1])
+	}
+	if segments[0].HasOutage || segments[3].HasOutage {
+		t.Errorf("expected only L03 to be marked, got %+v", segments)
+	}
+}
+
+// TestSubwayOutages shows an elevator outage from the ENE feeds on the tile of
+// a stop at the same station, and keeps showing the trains when the feeds
+// fail.
+func TestSubwayOutages(t *testing.T) {
+	recordedAt := time.Now().Add(-time.Minute)
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{{
+			Id: proto.String("L-trip"),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{TripId: proto.String("L-trip"), RouteId: proto.String("L")},
+				StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
+					{StopId: proto.String("L03N"), Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(recordedAt.Add(5 * time.Minute).Unix())}},
+				},
+			},
+		}},
+	}
+	body, _ := proto.Marshal(feed)
+	dir := t.TempDir()
+	if err := subway.NewFeedRecorder(dir).Record("https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-l", body, recordedAt); err != nil {
+		t.Fatalf("Record error: %v", err)
+	}
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	outageStart := time.Now().Add(-time.Hour).In(newYork).Format("01/02/2006 03:04:05 PM")
+	fixtures := map[string]string{
+		"/nyct/nyct_ene.json": fmt.Sprintf(`[{"station": "14 St-Union Sq", "trainno": "L/N/Q/R/W/4/5/6", "equipment": "EL222",
+			"equipmenttype": "EL", "serving": "L platform to mezzanine", "ADA": "Y", "outagedate": %q,
+			"estimatedreturntoservice": "", "reason": "Repair", "isupcomingoutage": "N", "ismaintenanceoutage": "N"}]`, outageStart),
+		"/nyct/nyct_ene_upcoming.json":   `[]`,
+		"/nyct/nyct_ene_equipments.json": `[{"station": "14 St-Union Sq", "equipmentno": "EL222", "elevatorsgtfsstopid": "635/L03/R20"}]`,
+	}
+	failing := false
+	eneServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(fixtures[r.URL.Path]))
+	}))
+	defer eneServer.Close()
+
+	config := newTestConfig()
+	config.SubwayReplayDir = dir
+	config.SubwayStops = []redmaple.SubwayStopConfig{{ID: "L03N"}}
+	config.ElevatorOutagesURL = eneServer.URL
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	getTile := func() api.SubwayPartial {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subway", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		tile := api.SubwayPartial{}
+		if err := json.NewDecoder(rec.Body).Decode(&tile); err != nil {
+			t.Fatalf("failed to decode subway tile: %v", err)
+		}
+		return tile
+	}
+
+	tile := getTile()
+	if len(tile.Stops) != 1 || !tile.Stops[0].IsInaccessible || len(tile.Stops[0].Outages) != 1 {
+		t.Fatalf("expected the elevator outage at Union Sq, got %+v", tile.Stops)
+	}
+	if got := tile.Stops[0].Outages[0]; got.Equipment != "EL222" || got.Serving != "L platform to mezzanine" {
+		t.Errorf("unexpected outage: %+v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x/subway", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `class="outage-badge inaccessible" title="elevator L platform to mezzanine out"`) {
+		t.Errorf("expected the outage on the tile, got %s", body)
+	}
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x/subwayline?line=L", nil))
+	if body := rec.Body.String(); strings.Count(body, "outage-badge inaccessible") != 1 {
+		t.Errorf("expected the outage at Union Sq on the line, got %s", body)
+	}
+
+	// a new server has no outages to fall back on
+	failing = true
+	server, err = redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux = http.NewServeMux()
+	server.LoadRoutes(mux)
+	tile = getTile()
+	if len(tile.Stops) != 1 || !tile.Stops[0].HasTrains || tile.Stops[0].HasOutage {
+		t.Errorf("expected the trains without outages when the feeds fail, got %+v", tile.Stops)
+	}
+}
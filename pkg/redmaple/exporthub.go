@@ -2,13 +2,24 @@ package redmaple
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 )
 
+var exportProviderFailures = metrics.NewCounterVec("redmaple_export_provider_failures_total",
+	"Data providers that failed during an export.")
+
 type ExportHub struct {
+	mu sync.RWMutex
+	// exportMu is held by Run for the whole of an export so that Retire can
+	// wait for it to let go of displaced exporters.
+	exportMu  sync.Mutex
 	interval  time.Duration
 	exporters []api.DataExporter
 	providers []api.ProviderFunc
@@ -23,13 +34,53 @@ func NewExportHub(interval time.Duration) *ExportHub {
 }
 
 func (e *ExportHub) AddExporter(exporter api.DataExporter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.exporters = append(e.exporters, exporter)
 }
 
 func (e *ExportHub) AddProvider(provider api.ProviderFunc) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.providers = append(e.providers, provider)
 }
 
+// Replace swaps in the interval, exporters and providers of other. It is safe
+// to call while Run is active; the new set takes effect from the next export.
+// The exporters that are no longer in use are returned so they can be passed
+// to Retire.
+func (e *ExportHub) Replace(other *ExportHub) []api.DataExporter {
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	displaced := []api.DataExporter{}
+	for _, exporter := range e.exporters {
+		if !slices.Contains(other.exporters, exporter) {
+			displaced = append(displaced, exporter)
+		}
+	}
+	e.interval = other.interval
+	e.exporters = other.exporters
+	e.providers = other.providers
+	return displaced
+}
+
+// Retire closes the exporters returned by Replace that implement io.Closer. It
+// blocks until any export that started before the Replace has finished with
+// them.
+func (e *ExportHub) Retire(exporters []api.DataExporter) {
+	e.exportMu.Lock()
+	defer e.exportMu.Unlock()
+	for _, exporter := range exporters {
+		if closer, ok := exporter.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				slog.Warn("failed to close retired exporter", "err", err)
+			}
+		}
+	}
+}
+
 func (e *ExportHub) Run(ctx context.Context) {
 	timer := time.NewTimer(0)
 	for {
@@ -37,21 +88,28 @@ func (e *ExportHub) Run(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-timer.C:
+			e.exportMu.Lock()
+			e.mu.RLock()
+			interval, exporters, providers := e.interval, e.exporters, e.providers
+			e.mu.RUnlock()
+
 			points := []*api.DataPoint{}
-			for _, provider := range e.providers {
+			for _, provider := range providers {
 				data, err := provider(ctx)
 				if err != nil {
 					slog.Warn("data provider failed", "err", err)
+					exportProviderFailures.Inc()
 					continue
 				}
 				points = append(points, data)
 			}
-			for _, exporter := range e.exporters {
+			for _, exporter := range exporters {
 				if err := exporter.Export(ctx, points); err != nil {
 					slog.Warn("data export failed", "err", err)
 				}
 			}
-			timer = time.NewTimer(e.interval)
+			e.exportMu.Unlock()
+			timer = time.NewTimer(interval)
 		}
 	}
 }
@@ -0,0 +1,65 @@
+package redmaple
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	health "github.com/mpoegel/red-maple/pkg/health"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+// dependencies are the names of the upstreams that the server may depend on.
+var dependencies = []string{"weather", "subway", "citibike", "homeassistant", "nycdata", "s3", "bustime", "elevators"}
+
+// newHTTPClient returns an HTTP client whose requests to upstream are recorded
+// in the metrics and health tracker.
+func newHTTPClient(upstream string) *http.Client {
+	return &http.Client{
+		Transport: health.Default.Transport(upstream, metrics.InstrumentTransport(upstream, nil)),
+	}
+}
+
+// configuredDependencies returns the dependencies that the config makes use of.
+func (c Config) configuredDependencies() []string {
+	deps := []string{"weather", "subway", "citibike"}
+	if c.HomeAssistant.APIKey != "" {
+		deps = append(deps, "homeassistant")
+	}
+	deps = append(deps, "nycdata")
+	if c.BusTimeAPIKey != "" {
+		deps = append(deps, "bustime")
+	}
+	if c.ElevatorOutagesURL != "" {
+		deps = append(deps, "elevators")
+	}
+	deps = append(deps, c.transitNames()...)
+	if c.S3.Enabled {
+		deps = append(deps, "s3")
+	}
+	return deps
+}
+
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthJSON(w, http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+// HandleReadyz reports the status of each configured dependency. It responds
+// with 503 only when a critical dependency is down.
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := health.Default.Check(s.config.configuredDependencies(), s.config.Health.Critical, s.config.Health.StaleAfter)
+	code := http.StatusOK
+	if report.Status == health.StatusUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	writeHealthJSON(w, code, report)
+}
+
+func writeHealthJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write health report", "err", err)
+	}
+}
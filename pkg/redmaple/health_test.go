@@ -0,0 +1,48 @@
+package redmaple_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	health "github.com/mpoegel/red-maple/pkg/health"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func TestReadyzStatus(t *testing.T) {
+	config := newTestConfig()
+	config.Health.Critical = []string{"weather"}
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	readyz := func() (int, health.Report) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var report health.Report
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return rec.Code, report
+	}
+
+	health.Default.Failure("citibike", errors.New("connection refused"))
+	code, report := readyz()
+	if code != http.StatusOK || report.Status != health.StatusDegraded {
+		t.Errorf("expected 200 degraded when citibike is down, got %d %s", code, report.Status)
+	}
+	if _, ok := report.Dependencies["s3"]; ok {
+		t.Error("expected s3 to be left out when it is not enabled")
+	}
+
+	health.Default.Failure("weather", errors.New("connection refused"))
+	code, report = readyz()
+	if code != http.StatusServiceUnavailable || report.Status != health.StatusUnavailable {
+		t.Errorf("expected 503 unavailable when weather is down, got %d %s", code, report.Status)
+	}
+}
@@ -0,0 +1,159 @@
+package redmaple
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+)
+
+// DefaultLayout is the layout served at / when no ?layout= is given.
+const DefaultLayout = "default"
+
+type Layout struct {
+	Tiles []TileConfig `json:"tiles"`
+}
+
+type TileConfig struct {
+	Name string `json:"name"`
+	// Span is the number of grid columns the tile takes up, 1 or 2.
+	Span int `json:"span"`
+	// Refresh overrides how often the tile is reloaded.
+	Refresh time.Duration `json:"refresh"`
+}
+
+// UnmarshalJSON accepts durations in the config file as strings such as "30s".
+func (t *TileConfig) UnmarshalJSON(b []byte) error {
+	type tileConfig TileConfig
+	aux := struct {
+		*tileConfig
+		Refresh *jsonDuration `json:"refresh"`
+	}{tileConfig: (*tileConfig)(t), Refresh: (*jsonDuration)(&t.Refresh)}
+	return decodeStrict(b, &aux)
+}
+
+func defaultLayouts() map[string]Layout {
+	tiles := []TileConfig{}
+	for _, name := range []string{"weather", "indoor", "subway", "outdoor", "citibike", "sunrise", "datetime", "navigation"} {
+		tiles = append(tiles, TileConfig{Name: name, Span: 1})
+	}
+	return map[string]Layout{DefaultLayout: {Tiles: tiles}}
+}
+
+// parseLayout parses the DASHBOARD_LAYOUT syntax, a comma-separated list of
+// name[:refresh[:span]] entries such as "weather:5m,subway:30s:2,datetime".
+func parseLayout(s string) (Layout, error) {
+	layout := Layout{Tiles: []TileConfig{}}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) > 3 {
+			return layout, fmt.Errorf("invalid tile %q", entry)
+		}
+		tile := TileConfig{Name: parts[0], Span: 1}
+		if len(parts) > 1 && parts[1] != "" {
+			refresh, err := time.ParseDuration(parts[1])
+			if err != nil {
+				return layout, fmt.Errorf("invalid refresh for tile %q: %w", entry, err)
+			}
+			tile.Refresh = refresh
+		}
+		if len(parts) > 2 {
+			span, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return layout, fmt.Errorf("invalid span for tile %q: %w", entry, err)
+			}
+			tile.Span = span
+		}
+		layout.Tiles = append(layout.Tiles, tile)
+	}
+	return layout, nil
+}
+
+func (c Config) validateLayouts() error {
+	errs := []error{}
+	names := append(tileNames(), c.transitNames()...)
+	if _, ok := c.Layouts[DefaultLayout]; !ok {
+		errs = append(errs, fmt.Errorf("missing %q layout", DefaultLayout))
+	}
+	for name, layout := range c.Layouts {
+		for _, tile := range layout.Tiles {
+			if !slices.Contains(names, tile.Name) {
+				errs = append(errs, fmt.Errorf("%s: unknown tile %q", name, tile.Name))
+			}
+			if tile.Span != 0 && tile.Span != 1 && tile.Span != 2 {
+				errs = append(errs, fmt.Errorf("%s: tile %q span %d must be 1 or 2", name, tile.Name, tile.Span))
+			}
+			if tile.Refresh < 0 {
+				errs = append(errs, fmt.Errorf("%s: tile %q refresh %v must not be negative", name, tile.Name, tile.Refresh))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dashboard resolves a layout from the config into the tiles to render.
+func (s *Server) dashboard(layout Layout) api.Dashboard {
+	dashboard := api.Dashboard{Tiles: []api.DashboardTile{}}
+	for _, tc := range layout.Tiles {
+		tile, ok := s.tiles[tc.Name]
+		if !ok {
+			continue
+		}
+		refresh := tile.Refresh()
+		if tc.Refresh > 0 {
+			refresh = tc.Refresh
+		}
+		dt := api.DashboardTile{
+			Name:    tc.Name,
+			Partial: "/x/" + tc.Name,
+			Link:    tile.Link(),
+			Trigger: "load",
+			Span:    max(tc.Span, 1),
+		}
+		if refresh > 0 {
+			dt.Trigger += ", every " + htmxInterval(refresh)
+		}
+		dashboard.Tiles = append(dashboard.Tiles, dt)
+	}
+	return dashboard
+}
+
+// htmxInterval formats d in the interval syntax of hx-trigger.
+func htmxInterval(d time.Duration) string {
+	switch {
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	case d%time.Second == 0:
+		return fmt.Sprintf("%ds", d/time.Second)
+	default:
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+}
+
+// layoutNames returns the names of the configured layouts, sorted.
+func (c Config) layoutNames() []string {
+	names := []string{}
+	for name := range c.Layouts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *Server) HandleIndex(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("layout")
+	if name == "" {
+		name = DefaultLayout
+	}
+	layout, ok := s.config.Layouts[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown layout %q, expected one of %s", name, strings.Join(s.config.layoutNames(), ", ")), http.StatusNotFound)
+		return
+	}
+	s.executeTemplate(w, "Index", s.dashboard(layout))
+}
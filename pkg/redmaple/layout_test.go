@@ -0,0 +1,86 @@
+package redmaple_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func TestReadConfigLayouts(t *testing.T) {
+	filename := writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"layouts": {
+			"kitchen": {"tiles": [{"name": "subway", "span": 2, "refresh": "30s"}, {"name": "datetime"}]}
+		}
+	}`)
+	t.Setenv("DASHBOARD_LAYOUT", "weather:5m,citibike::2")
+
+	config, err := redmaple.ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	kitchen := config.Layouts["kitchen"].Tiles
+	if len(kitchen) != 2 || kitchen[0].Name != "subway" || kitchen[0].Span != 2 || kitchen[0].Refresh != 30*time.Second {
+		t.Errorf("unexpected kitchen layout: %+v", kitchen)
+	}
+	def := config.Layouts[redmaple.DefaultLayout].Tiles
+	if len(def) != 2 || def[0].Refresh != 5*time.Minute || def[1].Span != 2 {
+		t.Errorf("unexpected default layout from DASHBOARD_LAYOUT: %+v", def)
+	}
+}
+
+func TestReadConfigInvalidLayout(t *testing.T) {
+	filename := writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"layouts": {"hallway": {"tiles": [{"name": "radar"}, {"name": "weather", "span": 3}]}}
+	}`)
+
+	_, err := redmaple.ReadConfig(filename)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{`"radar"`, "span 3"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestHandleIndexLayout(t *testing.T) {
+	config := newTestConfig()
+	config.Layouts["hallway"] = redmaple.Layout{Tiles: []redmaple.TileConfig{
+		{Name: "subway", Span: 2, Refresh: 30 * time.Second},
+		{Name: "navigation"},
+	}}
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?layout=hallway", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`hx-get="/x/subway" hx-trigger="load, every 30s"`, "grid-span-2", `hx-get="/x/navigation" hx-trigger="load"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected page to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "/x/weather") {
+		t.Error("expected weather tile to be left out of the hallway layout")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?layout=garage", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown layout, got %d", rec.Code)
+	}
+}
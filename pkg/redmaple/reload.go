@@ -0,0 +1,90 @@
+package redmaple
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Reload validates config, rebuilds the clients and export providers affected
+// by it, and swaps them in while the HTTP server keeps serving. If config is
+// invalid the running config is left in place and the error is returned.
+func (s *Server) Reload(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	prev := s.active.Load()
+	if config.Port != prev.config.Port {
+		slog.Warn("port change requires a restart", "port", prev.config.Port, "newPort", config.Port)
+	}
+
+	next, err := buildServer(config, prev)
+	if err != nil {
+		return err
+	}
+	displaced := s.exportHub.Replace(next.exportHub)
+	next.exportHub = s.exportHub
+	s.active.Store(next)
+
+	// A previous s3 client is only closed once the export in flight, which may
+	// still hold it, has finished.
+	s.exportHub.Retire(displaced)
+	return nil
+}
+
+// WatchConfig re-reads the config from filename and reloads the server every
+// time a signal arrives on sig. If pollInterval is positive, the file is also
+// checked for changes at that interval. Rejected configs are logged and the
+// previous config stays in place.
+func (s *Server) WatchConfig(ctx context.Context, filename string, pollInterval time.Duration, sig <-chan os.Signal) {
+	var poll <-chan time.Time
+	if pollInterval > 0 && filename != "" {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	lastModified := modTime(filename)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			slog.Info("reloading config", "file", filename)
+		case <-poll:
+			modified := modTime(filename)
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			slog.Info("config file changed, reloading", "file", filename)
+		}
+
+		config, err := ReadConfig(filename)
+		if err != nil {
+			slog.Error("rejected config reload", "error", err)
+			continue
+		}
+		if err := s.Reload(config); err != nil {
+			slog.Error("rejected config reload", "error", err)
+			continue
+		}
+		slog.Info("config reloaded")
+	}
+}
+
+func modTime(filename string) time.Time {
+	if filename == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
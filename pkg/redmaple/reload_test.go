@@ -0,0 +1,114 @@
+package redmaple_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+func newTestConfig() redmaple.Config {
+	config := redmaple.DefaultConfig()
+	config.StaticDir = "../../static"
+	config.VendorDir = "../../vendored"
+	return config
+}
+
+func TestReloadSwapsConfig(t *testing.T) {
+	server, err := redmaple.NewServer(newTestConfig())
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+
+	next := newTestConfig()
+	next.SubwayStops = []redmaple.SubwayStopConfig{{ID: "L08N"}}
+	next.CitibikeStations = []string{"W 4 St & 7 Ave S"}
+	if err := server.Reload(next); err != nil {
+		t.Fatalf("Reload error: %v", err)
+	}
+
+	got := server.Config()
+	if len(got.SubwayStops) != 1 || got.SubwayStops[0].ID != "L08N" {
+		t.Errorf("expected SubwayStops=L08N, got %v", got.SubwayStops)
+	}
+	if len(got.CitibikeStations) != 1 || got.CitibikeStations[0] != "W 4 St & 7 Ave S" {
+		t.Errorf("expected reloaded citibike stations, got %v", got.CitibikeStations)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	server, err := redmaple.NewServer(newTestConfig())
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+
+	next := newTestConfig()
+	next.SubwayStops = []redmaple.SubwayStopConfig{{ID: "Z99N"}}
+	next.WeatherLocation = "nowhere"
+	if err := server.Reload(next); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	got := server.Config()
+	if len(got.SubwayStops) != 2 || got.SubwayStops[0].ID != "L03S" {
+		t.Errorf("expected previous SubwayStops to stay in place, got %v", got.SubwayStops)
+	}
+	if got.WeatherLocation != "40.75261,-73.97728" {
+		t.Errorf("expected previous WeatherLocation to stay in place, got %s", got.WeatherLocation)
+	}
+}
+
+type blockingExporter struct {
+	started chan struct{}
+	release chan struct{}
+	closed  atomic.Bool
+}
+
+func (b *blockingExporter) Export(ctx context.Context, dataPoints []*api.DataPoint) error {
+	close(b.started)
+	<-b.release
+	if b.closed.Load() {
+		panic("export on closed exporter")
+	}
+	return nil
+}
+
+func (b *blockingExporter) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func TestExportHubRetireWaitsForExport(t *testing.T) {
+	old := &blockingExporter{started: make(chan struct{}), release: make(chan struct{})}
+	hub := redmaple.NewExportHub(time.Hour)
+	hub.AddExporter(old)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go hub.Run(ctx)
+	<-old.started
+
+	displaced := hub.Replace(redmaple.NewExportHub(time.Hour))
+	if len(displaced) != 1 || displaced[0] != old {
+		t.Fatalf("expected the old exporter to be displaced, got %v", displaced)
+	}
+	retired := make(chan struct{})
+	go func() {
+		hub.Retire(displaced)
+		close(retired)
+	}()
+
+	select {
+	case <-retired:
+		t.Fatal("exporter retired while an export was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(old.release)
+	<-retired
+	if !old.closed.Load() {
+		t.Error("expected the displaced exporter to be closed")
+	}
+}
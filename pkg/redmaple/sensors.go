@@ -1,6 +1,9 @@
 package redmaple
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math"
 	"net/http"
@@ -9,32 +12,37 @@ import (
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
 	homeassistant "github.com/mpoegel/red-maple/pkg/homeassistant"
 )
 
-func (s *Server) HandleIndoor(w http.ResponseWriter, r *http.Request) {
+// getDeviceState returns the state of a Home Assistant device, falling back to
+// the last known good state if Home Assistant is failing.
+func (s *Server) getDeviceState(ctx context.Context, deviceID string) (*homeassistant.DeviceState, api.Freshness, error) {
+	getState := func(ctx context.Context) (*homeassistant.DeviceState, error) {
+		return s.haClient.GetDeviceState(ctx, deviceID)
+	}
+	state, freshness, err := fallback.Fetch(ctx, s.fallback, "homeassistant", deviceID, getState)
+	return state, freshness.In(s.tz), err
+}
+
+func (s *Server) fetchIndoor(r *http.Request) (any, error) {
 	lastTempData := s.haClient.DeviceCache(s.config.HomeAssistant.IndoorTempID)
-	sensorTempData, err := s.haClient.GetDeviceState(r.Context(), s.config.HomeAssistant.IndoorTempID)
+	sensorTempData, tempFreshness, err := s.getDeviceState(r.Context(), s.config.HomeAssistant.IndoorTempID)
 	if err != nil {
-		slog.Error("failed to get indoor temperature sensor", "err", err, "device", s.config.HomeAssistant.IndoorTempID)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("indoor temperature sensor %s: %w", s.config.HomeAssistant.IndoorTempID, err)
 	}
 	lastHumidData := s.haClient.DeviceCache(s.config.HomeAssistant.IndoorTempID)
-	sensorHumidData, err := s.haClient.GetDeviceState(r.Context(), s.config.HomeAssistant.IndoorHumidityID)
+	sensorHumidData, humidFreshness, err := s.getDeviceState(r.Context(), s.config.HomeAssistant.IndoorHumidityID)
 	if err != nil {
-		slog.Error("failed to get indoor humidity sensor", "err", err, "device", s.config.HomeAssistant.IndoorHumidityID)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("indoor humidity sensor %s: %w", s.config.HomeAssistant.IndoorHumidityID, err)
 	}
 	slog.Debug("got indoor sensor update", "temp", sensorTempData, "humidity", sensorHumidData)
 
 	currTemp, err1 := strconv.ParseFloat(sensorTempData.State, 64)
 	currHumid, err2 := strconv.ParseFloat(sensorHumidData.State, 64)
 	if err1 != nil || err2 != nil {
-		slog.Error("indoor sensor returned invalid state", "err", err, "temp", sensorTempData.State, "humidity", sensorHumidData.State)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("indoor sensor returned invalid state: %w", errors.Join(err1, err2))
 	}
 	lastTemp := 0.0
 	lastHumid := 0.0
@@ -48,6 +56,7 @@ func (s *Server) HandleIndoor(w http.ResponseWriter, r *http.Request) {
 	intTemp, fracTemp := math.Modf(currTemp)
 	intHumid, fracHumid := math.Modf(currHumid)
 	data := api.IndoorPartial{
+		Freshness:            tempFreshness.Merge(humidFreshness),
 		IntegerTemp:          int(intTemp),
 		FractionalTemp:       int(math.Floor(fracTemp * 100)),
 		IntegerHumidity:      int(intHumid),
@@ -60,32 +69,26 @@ func (s *Server) HandleIndoor(w http.ResponseWriter, r *http.Request) {
 	} else if data.IntegerHumidity >= 40 {
 		data.HumidityLevel = 1
 	}
-	s.executeTemplate(w, "Indoor", data)
+	return data, nil
 }
 
-func (s *Server) HandleOutdoor(w http.ResponseWriter, r *http.Request) {
+func (s *Server) fetchOutdoor(r *http.Request) (any, error) {
 	lastTempData := s.haClient.DeviceCache(s.config.HomeAssistant.IndoorTempID)
-	sensorTempData, err := s.haClient.GetDeviceState(r.Context(), s.config.HomeAssistant.OutdoorTempID)
+	sensorTempData, tempFreshness, err := s.getDeviceState(r.Context(), s.config.HomeAssistant.OutdoorTempID)
 	if err != nil {
-		slog.Error("failed to get outdoor temperature sensor", "err", err, "device", s.config.HomeAssistant.OutdoorTempID)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("outdoor temperature sensor %s: %w", s.config.HomeAssistant.OutdoorTempID, err)
 	}
 	lastHumidData := s.haClient.DeviceCache(s.config.HomeAssistant.IndoorTempID)
-	sensorHumidData, err := s.haClient.GetDeviceState(r.Context(), s.config.HomeAssistant.OutdoorHumidityID)
+	sensorHumidData, humidFreshness, err := s.getDeviceState(r.Context(), s.config.HomeAssistant.OutdoorHumidityID)
 	if err != nil {
-		slog.Error("failed to get outdoor humidity sensor", "err", err, "device", s.config.HomeAssistant.OutdoorHumidityID)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("outdoor humidity sensor %s: %w", s.config.HomeAssistant.OutdoorHumidityID, err)
 	}
 	slog.Debug("got outdoor sensor update", "temp", sensorTempData, "humidity", sensorHumidData)
 
 	currTemp, err1 := strconv.ParseFloat(sensorTempData.State, 64)
 	currHumid, err2 := strconv.ParseFloat(sensorHumidData.State, 64)
 	if err1 != nil || err2 != nil {
-		slog.Error("indoor sensor returned invalid state", "err", err, "temp", sensorTempData.State, "humidity", sensorHumidData.State)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("outdoor sensor returned invalid state: %w", errors.Join(err1, err2))
 	}
 	lastTemp := 0.0
 	lastHumid := 0.0
@@ -99,6 +102,7 @@ func (s *Server) HandleOutdoor(w http.ResponseWriter, r *http.Request) {
 	intTemp, fracTemp := math.Modf(currTemp)
 	intHumid, fracHumid := math.Modf(currHumid)
 	data := api.OutdoorPartial{
+		Freshness:            tempFreshness.Merge(humidFreshness),
 		IntegerTemp:          int(intTemp),
 		FractionalTemp:       int(math.Floor(fracTemp * 100)),
 		IntegerHumidity:      int(intHumid),
@@ -111,7 +115,7 @@ func (s *Server) HandleOutdoor(w http.ResponseWriter, r *http.Request) {
 	} else if data.IntegerHumidity >= 40 {
 		data.HumidityLevel = 1
 	}
-	s.executeTemplate(w, "Outdoor", data)
+	return data, nil
 }
 
 func (s *Server) HandleOutdoorFull(w http.ResponseWriter, r *http.Request) {
@@ -233,7 +237,7 @@ func (s *Server) HandleSensorHistory(w http.ResponseWriter, r *http.Request, reg
 
 	slog.Debug("history", "region", region, "data", dataPayload)
 
-	s.executeTemplate(w, region+"History", dataPayload)
+	s.render(w, r, region+"History", dataPayload)
 }
 
 func CompactToBucketsFromDevice(history []homeassistant.DeviceHistory, days int) []Bucket {
@@ -2,43 +2,88 @@ package redmaple
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"path"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	bustime "github.com/mpoegel/red-maple/pkg/bustime"
 	citibike "github.com/mpoegel/red-maple/pkg/citibike"
+	elevators "github.com/mpoegel/red-maple/pkg/elevators"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 	ha "github.com/mpoegel/red-maple/pkg/homeassistant"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 	nycdata "github.com/mpoegel/red-maple/pkg/nycdata"
 	s3 "github.com/mpoegel/red-maple/pkg/s3"
 	subway "github.com/mpoegel/red-maple/pkg/subway"
+	transit "github.com/mpoegel/red-maple/pkg/transit"
 	weather "github.com/mpoegel/red-maple/pkg/weather"
 )
 
 type Server struct {
 	s      http.Server
+	mux    *http.ServeMux
 	config Config
 	tz     *time.Location
 	wg     sync.WaitGroup
 
-	citibike   citibike.Client
-	subwayCli  subway.Client
-	weatherCli weather.Client
-	haClient   ha.Client
-	nycClient  nycdata.Client
+	citibike  citibike.Client
+	subwayCli subway.Client
+	busCli    bustime.Client
+	// elevatorCli is nil if elevator outages are disabled.
+	elevatorCli elevators.Client
+	weatherCli  weather.Client
+	haClient    ha.Client
+	nycClient   nycdata.Client
+	s3Client    *s3.Client
+	transit     map[string]transit.Client
 
+	// fallback holds the last known good upstream data and is kept across
+	// reloads.
+	fallback *fallback.Cache
+	// feeds polls the subway feeds and is kept across reloads.
+	feeds *gtfsrt.FeedManager
+	// subwayNow is the time the subway feeds are at, which is the time in
+	// the recording when replaying one.
+	subwayNow func() time.Time
+	tiles     map[string]Tile
 	exportHub *ExportHub
 	importer  api.Importer
+	templates atomic.Pointer[template.Template]
+
+	// active is the server currently handling requests; it is replaced on
+	// every successful Reload.
+	active   atomic.Pointer[Server]
+	reloadMu sync.Mutex
 }
 
 func NewServer(config Config) (*Server, error) {
+	s, err := buildServer(config, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.s = http.Server{
+		Addr:         fmt.Sprintf("0.0.0.0:%d", config.Port),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		Handler:      http.HandlerFunc(s.serveActive),
+	}
+	s.active.Store(s)
+	return s, nil
+}
+
+// buildServer creates the clients, export hub and routes for config. Clients
+// whose settings are unchanged from prev are reused so that their caches
+// survive a reload.
+func buildServer(config Config, prev *Server) (*Server, error) {
 	mux := http.NewServeMux()
 
 	tz, err := time.LoadLocation(config.Timezone)
@@ -46,41 +91,110 @@ func NewServer(config Config) (*Server, error) {
 		return nil, err
 	}
 
-	subwayCli, err := subway.NewClient(config.VendorDir)
+	plate, err := parseTemplates(config.staticFS())
 	if err != nil {
 		return nil, err
 	}
 
-	weatherCoords := strings.Split(config.WeatherLocation, ",")
-	if len(weatherCoords) != 2 {
-		return nil, errors.New("invalid weather coordinates")
+	s := Server{
+		mux:       mux,
+		config:    config,
+		tz:        tz,
+		wg:        sync.WaitGroup{},
+		exportHub: NewExportHub(config.ExportInterval),
 	}
-	weatherLat, err1 := strconv.ParseFloat(weatherCoords[0], 64)
-	weatherLon, err2 := strconv.ParseFloat(weatherCoords[1], 64)
-	if err1 != nil || err2 != nil {
-		return nil, errors.Join(err1, err2)
+	s.templates.Store(plate)
+
+	if prev != nil {
+		s.fallback = prev.fallback
+	} else {
+		s.fallback = fallback.NewCache()
 	}
 
-	s := Server{
-		s: http.Server{
-			Addr:         fmt.Sprintf("0.0.0.0:%d", config.Port),
-			ReadTimeout:  10 * time.Second,
-			WriteTimeout: 10 * time.Second,
-			Handler:      mux,
-		},
-		config:     config,
-		tz:         tz,
-		wg:         sync.WaitGroup{},
-		citibike:   citibike.NewClient(),
-		subwayCli:  subwayCli,
-		weatherCli: weather.NewClient(weatherLat, weatherLon, config.WeatherAPIKey),
-		haClient:   ha.NewClient(config.HomeAssistant.Endpoint, config.HomeAssistant.APIKey),
-		nycClient:  nycdata.NewClient(nycdata.WithAppToken(config.NycDataAppKey), nycdata.WithFilesystemCache(path.Join(config.CacheDir, "nycdata"))),
-		exportHub:  NewExportHub(config.ExportInterval),
-	}
-
-	if config.S3.Enabled {
-		client, err := s3.NewClient(
+	if prev != nil {
+		s.feeds, s.subwayNow = prev.feeds, prev.subwayNow
+		s.feeds.SetInterval(config.SubwayPollInterval)
+		if prev.config.SubwayRecordDir != config.SubwayRecordDir || prev.config.SubwayRecordRetention != config.SubwayRecordRetention || prev.config.SubwayReplayDir != config.SubwayReplayDir {
+			slog.Warn("changing the subway recording or replay requires a restart")
+		}
+	} else {
+		feeds, now, err := newFeedManager(config)
+		if err != nil {
+			return nil, err
+		}
+		s.feeds, s.subwayNow = feeds, now
+	}
+
+	if prev != nil && prev.config.VendorDir == config.VendorDir {
+		s.subwayCli = prev.subwayCli
+	} else {
+		subwayCli, err := subway.NewClientFromFS(config.vendorFS(),
+			subway.WithHTTPClient(newHTTPClient("subway")),
+			subway.WithFeedManager(s.feeds),
+			subway.WithClock(s.subwayNow),
+		)
+		if err != nil {
+			return nil, err
+		}
+		s.subwayCli = subwayCli
+	}
+
+	if prev != nil && prev.config.BusTimeAPIKey == config.BusTimeAPIKey {
+		s.busCli = prev.busCli
+	} else {
+		s.busCli = bustime.NewClient(config.BusTimeAPIKey, bustime.WithHTTPClient(newHTTPClient("bustime")))
+	}
+
+	if prev != nil && prev.config.ElevatorOutagesURL == config.ElevatorOutagesURL {
+		s.elevatorCli = prev.elevatorCli
+	} else if config.ElevatorOutagesURL != "" {
+		s.elevatorCli = elevators.NewClient(
+			elevators.WithBaseURL(config.ElevatorOutagesURL),
+			elevators.WithHTTPClient(newHTTPClient("elevators")),
+		)
+	}
+
+	if prev != nil && prev.config.WeatherLocation == config.WeatherLocation && prev.config.WeatherAPIKey == config.WeatherAPIKey {
+		s.weatherCli = prev.weatherCli
+	} else {
+		weatherLat, weatherLon, err := parseLatLon(config.WeatherLocation)
+		if err != nil {
+			return nil, err
+		}
+		s.weatherCli = weather.NewClient(weatherLat, weatherLon, config.WeatherAPIKey, weather.WithHTTPClient(newHTTPClient("weather")))
+	}
+
+	if prev != nil && prev.config.HomeAssistant.Endpoint == config.HomeAssistant.Endpoint && prev.config.HomeAssistant.APIKey == config.HomeAssistant.APIKey {
+		s.haClient = prev.haClient
+	} else {
+		s.haClient = ha.NewClient(config.HomeAssistant.Endpoint, config.HomeAssistant.APIKey, ha.WithHTTPClient(newHTTPClient("homeassistant")))
+	}
+
+	if prev != nil && prev.config.NycDataAppKey == config.NycDataAppKey && prev.config.CacheDir == config.CacheDir {
+		s.nycClient = prev.nycClient
+	} else {
+		s.nycClient = nycdata.NewClient(
+			nycdata.WithAppToken(config.NycDataAppKey),
+			nycdata.WithFilesystemCache(path.Join(config.CacheDir, "nycdata")),
+			nycdata.WithHTTPClient(newHTTPClient("nycdata")),
+		)
+	}
+
+	if prev != nil {
+		s.citibike = prev.citibike
+	} else {
+		s.citibike = citibike.NewClient(citibike.WithHTTPClient(newHTTPClient("citibike")))
+	}
+
+	s.transit, err = newTransitClients(config, prev)
+	if err != nil {
+		return nil, err
+	}
+
+	if prev != nil && prev.config.S3 == config.S3 {
+		s.s3Client = prev.s3Client
+	} else if config.S3.Enabled {
+		s.s3Client, err = s3.NewClient(
 			s3.WithBucket(config.S3.Bucket),
 			s3.WithCredentials(config.S3.AccessKey, config.S3.SecretKey),
 			s3.WithEndpoint(config.S3.Endpoint),
@@ -88,13 +202,17 @@ func NewServer(config Config) (*Server, error) {
 			s3.WithFlushInterval(config.S3.FlushInterval),
 			s3.WithRegion(config.S3.Region),
 			s3.WithRetentionDays(config.S3.RetentionDays),
+			s3.WithHTTPClient(newHTTPClient("s3")),
 		)
 		if err != nil {
 			return nil, err
 		}
-		s.exportHub.AddExporter(client)
-		s.importer = client
 	}
+	if s.s3Client != nil {
+		s.exportHub.AddExporter(s.s3Client)
+		s.importer = s.s3Client
+	}
+
 	s.exportHub.AddProvider(s.haClient.GetProvider(
 		s.config.HomeAssistant.IndoorTempID,
 		s.config.HomeAssistant.IndoorHumidityID,
@@ -103,12 +221,61 @@ func NewServer(config Config) (*Server, error) {
 	for _, stationName := range s.config.CitibikeStations {
 		s.exportHub.AddProvider(s.citibike.GetProvider(stationName))
 	}
+	for _, stop := range s.config.SubwayStops {
+		s.exportHub.AddProvider(s.subwayCli.GetHeadwayProvider(stop.ID, stop.Routes))
+	}
+
+	s.tiles = s.newTiles()
+	for _, agency := range config.Transit {
+		s.tiles[agency.Name] = s.newTransitTile(agency)
+	}
+	for _, name := range tileNames() {
+		if provider := s.tiles[name].Provider(); provider != nil {
+			s.exportHub.AddProvider(provider)
+		}
+	}
 
 	s.LoadRoutes(mux)
 
 	return &s, nil
 }
 
+func (s *Server) serveActive(w http.ResponseWriter, r *http.Request) {
+	s.active.Load().mux.ServeHTTP(w, r)
+}
+
+// Config returns the config the server is currently running with.
+func (s *Server) Config() Config {
+	return s.active.Load().config
+}
+
+// partials are the fixed routes under /x/ and /api/v1/ that are not tiles.
+var partials = []struct {
+	path    string
+	handler func(s *Server, w http.ResponseWriter, r *http.Request)
+}{
+	{"bikes/bridges", (*Server).HandleBikeBridges},
+	{"subwayline", (*Server).HandleSubwayLine},
+	{"subway/stations", (*Server).HandleSubwayStations},
+	{"subway/history", (*Server).HandleSubwayHistory},
+	{"indoor/history", (*Server).HandleIndoorHistory},
+	{"outdoor/history", (*Server).HandleOutdoorHistory},
+	{"sundial", (*Server).HandleSundial},
+	{"forecast", (*Server).HandleForecastFull},
+	{"aqi", (*Server).HandleAqiPartial},
+	{"sunrises", (*Server).HandleSunrises},
+}
+
+// isPartialPath reports whether name is taken by one of the fixed partials.
+func isPartialPath(name string) bool {
+	for _, partial := range partials {
+		if partial.path == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) LoadRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /{$}", s.HandleIndex)
 	mux.HandleFunc("GET /outdoor", s.HandleOutdoorFull)
@@ -117,28 +284,39 @@ func (s *Server) LoadRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /sunrise", s.HandleSunriseFull)
 	mux.HandleFunc("GET /bikes", s.HandleBikesFull)
 	mux.HandleFunc("GET /bikes/history", s.HandleCitiBikeHistory)
-	mux.HandleFunc("GET /x/bikes/bridges", s.HandleBikeBridges)
+	mux.HandleFunc("GET /api/v1/bikes/history", s.HandleCitiBikeHistory)
 	mux.HandleFunc("GET /weather", s.HandleWeatherFull)
-	mux.HandleFunc("GET /x/datetime", s.HandleDatetime)
-	mux.HandleFunc("GET /x/citibike", s.HandleCitibike)
-	mux.HandleFunc("GET /x/subway", s.HandleSubway)
-	mux.HandleFunc("GET /x/subwayline", s.HandleSubwayLine)
-	mux.HandleFunc("GET /x/weather", s.HandleWeather)
-	mux.HandleFunc("GET /x/indoor", s.HandleIndoor)
-	mux.HandleFunc("GET /x/indoor/history", s.HandleIndoorHistory)
-	mux.HandleFunc("GET /x/outdoor", s.HandleOutdoor)
-	mux.HandleFunc("GET /x/outdoor/history", s.HandleOutdoorHistory)
-	mux.HandleFunc("GET /x/sunrise", s.HandleSunrise)
-	mux.HandleFunc("GET /x/sundial", s.HandleSundial)
-	mux.HandleFunc("GET /x/forecast", s.HandleForecastFull)
-	mux.HandleFunc("GET /x/aqi", s.HandleAqiPartial)
-	mux.HandleFunc("GET /x/sunrises", s.HandleSunrises)
-
-	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.config.StaticDir))))
-
-	mux.Handle("GET /vendor/departure-mono/", http.StripPrefix("/vendor/departure-mono/", http.FileServer(http.Dir(s.config.VendorDir+"/departure-mono"))))
-	mux.Handle("GET /vendor/htmx/", http.StripPrefix("/vendor/htmx/", http.FileServer(http.Dir(s.config.VendorDir+"/htmx"))))
-	mux.Handle("GET /vendor/weather-icons/", http.StripPrefix("/vendor/weather-icons/", http.FileServer(http.Dir(s.config.VendorDir+"/weather-icons"))))
+
+	// every partial is also served as JSON under /api/v1/
+	for _, partial := range partials {
+		handler := func(w http.ResponseWriter, r *http.Request) {
+			partial.handler(s, w, r)
+		}
+		mux.HandleFunc("GET /x/"+partial.path, handler)
+		mux.HandleFunc("GET /api/v1/"+partial.path, handler)
+	}
+	for name, tile := range s.tiles {
+		handler := s.handleTile(name, tile)
+		mux.HandleFunc("GET /x/"+name, handler)
+		mux.HandleFunc("GET /api/v1/"+name, handler)
+	}
+
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.HandleFunc("GET /healthz", s.HandleHealthz)
+	mux.HandleFunc("GET /readyz", s.HandleReadyz)
+
+	mux.Handle("GET /static/", http.StripPrefix("/static/", http.FileServerFS(s.config.staticFS())))
+
+	vendorFS := s.config.vendorFS()
+	for _, dir := range []string{"departure-mono", "htmx", "weather-icons"} {
+		sub, err := fs.Sub(vendorFS, dir)
+		if err != nil {
+			slog.Error("invalid vendor dir", "dir", dir, "error", err)
+			continue
+		}
+		prefix := "/vendor/" + dir + "/"
+		mux.Handle("GET "+prefix, http.StripPrefix(prefix, http.FileServerFS(sub)))
+	}
 }
 
 func (s *Server) Start(ctx context.Context) error {
@@ -146,6 +324,9 @@ func (s *Server) Start(ctx context.Context) error {
 	s.wg.Go(func() {
 		s.exportHub.Run(ctx)
 	})
+	s.wg.Go(func() {
+		s.feeds.Run(ctx)
+	})
 
 	// start the HTTP server
 	slog.Info("listening", "addr", s.s.Addr)
@@ -162,11 +343,7 @@ func (s *Server) Stop(ctx context.Context) {
 	s.s.Shutdown(ctx)
 }
 
-func (s *Server) HandleIndex(w http.ResponseWriter, r *http.Request) {
-	s.executeTemplate(w, "Index", struct{}{})
-}
-
-func (s *Server) HandleDatetime(w http.ResponseWriter, r *http.Request) {
+func (s *Server) fetchDatetime(r *http.Request) (any, error) {
 	now := time.Now().In(s.tz)
 	AMorPM := "AM"
 	hour := now.Hour()
@@ -176,7 +353,7 @@ func (s *Server) HandleDatetime(w http.ResponseWriter, r *http.Request) {
 	if hour > 13 {
 		hour -= 12
 	}
-	s.executeTemplate(w, "Datetime", api.DatetimePartial{
+	return api.DatetimePartial{
 		Timestamp: fmt.Sprintf("%02d:%02d", hour, now.Minute()),
 		AMOrPM:    AMorPM,
 		Seconds:   fmt.Sprintf("%02d", now.Second()),
@@ -186,33 +363,5 @@ func (s *Server) HandleDatetime(w http.ResponseWriter, r *http.Request) {
 			now.Day(),
 			now.Year(),
 		),
-	})
-}
-
-func (s *Server) loadTemplates(w http.ResponseWriter) *template.Template {
-	plate, err := template.ParseGlob(path.Join(s.config.StaticDir, "pages/*.html"))
-	if err != nil {
-		slog.Error("template html parse failure", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return nil
-	}
-	plate, err = plate.ParseGlob(path.Join(s.config.StaticDir, "partials/*.html"))
-	if err != nil {
-		slog.Error("template snippets parse failure", "error", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return nil
-	}
-	return plate
-}
-
-func (s *Server) executeTemplate(w http.ResponseWriter, name string, data any) {
-	// TODO optimize template loading
-	plate := s.loadTemplates(w)
-	if plate == nil {
-		return
-	}
-	if err := plate.ExecuteTemplate(w, name, data); err != nil {
-		slog.Error("template execution failure", "name", name, "error", err, "data", data)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	}, nil
 }
@@ -1,7 +1,10 @@
 package redmaple
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"slices"
 	"strconv"
@@ -9,57 +12,142 @@ import (
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 	subway "github.com/mpoegel/red-maple/pkg/subway"
 )
 
-func (s *Server) HandleSubway(w http.ResponseWriter, r *http.Request) {
-	data := api.SubwayPartial{}
-	stops := strings.Split(s.config.SubwayStops, ",")
+type subwayTrips struct {
+	updates []*subway.StopUpdate
+	alerts  []subway.ServiceAlert
+}
 
-	// TODO cache response and count down
-	resp, alerts, err := s.subwayCli.GetTripsAtStop(r.Context(), stops[0])
-	if err != nil {
-		slog.Error("failed to get subway station status", "err", err, "stopID", stops[0])
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
-	}
-	if len(resp) == 0 {
-		slog.Warn("no trips found", "stop", stops[0])
-	} else {
-		data.First.StopName = resp[0].Stop.Name
-		data.First.Destination = resp[0].Destination.Name
-		data.First.NextTrainIn = MinutesUntilArrival(*resp[0].Arrival.Time, s.tz)
-		data.First.FurtherTrains = []int{
-			MinutesUntilArrival(*resp[1].Arrival.Time, s.tz),
-			MinutesUntilArrival(*resp[2].Arrival.Time, s.tz),
+type subwayTrains struct {
+	trains []subway.TrainUpdate
+	alerts []subway.ServiceAlert
+}
+
+// newFeedManager creates the FeedManager of the subway feeds and returns the
+// time the feeds are at. It records every download if SubwayRecordDir is set,
+// or serves the recording in SubwayReplayDir instead of the MTA feeds.
+func newFeedManager(config Config) (*gtfsrt.FeedManager, func() time.Time, error) {
+	opts := []gtfsrt.FeedManagerOption{gtfsrt.WithPollInterval(config.SubwayPollInterval)}
+	if config.SubwayReplayDir != "" {
+		replay, err := subway.OpenFeedReplay(config.SubwayReplayDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("subway replay: %w", err)
 		}
+		slog.Info("replaying subway feeds", "dir", config.SubwayReplayDir, "from", replay.Now())
+		return gtfsrt.NewFeedManager("subway", &http.Client{Transport: replay}, opts...), replay.Now, nil
 	}
-	data.First.TrainLine = string(subway.StopIdToLine(stops[0]))
-	data.First.HasIssues = len(alerts) > 0
-
-	resp, alerts, err = s.subwayCli.GetTripsAtStop(r.Context(), stops[1])
-	if err != nil {
-		slog.Error("failed to get subway station status", "err", err, "stopID", stops[1])
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+	if config.SubwayRecordDir != "" {
+		slog.Info("recording subway feeds", "dir", config.SubwayRecordDir, "retention", config.SubwayRecordRetention)
+		recorder := subway.NewFeedRecorder(config.SubwayRecordDir, subway.WithRecordRetention(config.SubwayRecordRetention))
+		opts = append(opts, gtfsrt.WithFeedRecorder(recorder))
 	}
-	if len(resp) == 0 {
-		slog.Warn("no trips found", "stop", stops[1])
-	} else {
-		data.Second.StopName = resp[0].Stop.Name
-		data.Second.Destination = resp[0].Destination.Name
-		data.Second.NextTrainIn = MinutesUntilArrival(*resp[0].Arrival.Time, s.tz)
-		data.Second.FurtherTrains = []int{
-			MinutesUntilArrival(*resp[1].Arrival.Time, s.tz),
-			MinutesUntilArrival(*resp[2].Arrival.Time, s.tz),
+	return gtfsrt.NewFeedManager("subway", newHTTPClient("subway"), opts...), time.Now, nil
+}
+
+// getTripsAtStop returns the upcoming trips at stopID, falling back to the
+// last known good trips if the feed is failing.
+func (s *Server) getTripsAtStop(ctx context.Context, stopID string) ([]*subway.StopUpdate, []subway.ServiceAlert, api.Freshness, error) {
+	trips, freshness, err := fallback.Fetch(ctx, s.fallback, "subway", "stop@"+stopID, func(ctx context.Context) (subwayTrips, error) {
+		updates, alerts, err := s.subwayCli.GetTripsAtStop(ctx, stopID)
+		return subwayTrips{updates, alerts}, err
+	})
+	return trips.updates, trips.alerts, freshness.In(s.tz), err
+}
+
+func (s *Server) fetchSubway(r *http.Request) (any, error) {
+	data := api.SubwayPartial{Stops: []api.SubwayUpdate{}}
+	now := s.subwayNow()
+	outages := s.getOutages(r.Context())
+
+	for _, stop := range s.config.SubwayStops {
+		updates, alerts, freshness, err := s.getTripsAtStop(r.Context(), stop.ID)
+		if err != nil {
+			// the other stops are still worth showing
+			slog.Warn("failed to get subway trips", "stop", stop.ID, "err", err)
+			update := SummarizeTrips(stop, nil, now)
+			update.IsUnavailable = true
+			data.Stops = append(data.Stops, update)
+			continue
 		}
+		update := SummarizeTrips(stop, updates, now)
+		if len(updates) == 0 {
+			slog.Warn("no trips found", "stop", stop.ID)
+		}
+		if len(stop.Routes) > 0 {
+			alerts = subway.FilterAlerts(alerts, stop.Routes, stop.ID, now)
+		}
+		update.HasIssues = len(alerts) > 0
+		// the outage feeds are live even when replaying the subway feeds
+		update.StationAccessibility = StationAccessibility(outages, stop.ID, time.Now().In(s.tz))
+		data.Stops = append(data.Stops, update)
+		data.Freshness = data.Freshness.Merge(freshness)
 	}
-	data.Second.TrainLine = string(subway.StopIdToLine(stops[1]))
-	data.Second.HasIssues = len(alerts) > 0
 
 	slog.Debug("prepared subway partial", "data", data)
 
-	s.executeTemplate(w, "Subway", data)
+	return data, nil
+}
+
+// SummarizeTrips turns the upcoming trips at a configured stop into the next
+// train and the minutes until each one after it, skipping trains on routes
+// the stop is not configured for and trains that have already left. Each train
+// is marked by whether it can be caught given the walk to the stop.
+func SummarizeTrips(stop SubwayStopConfig, updates []*subway.StopUpdate, now time.Time) api.SubwayUpdate {
+	res := api.SubwayUpdate{
+		StopID:        stop.ID,
+		StopName:      stop.Label,
+		FurtherTrains: []int{},
+		WalkMinutes:   int(stop.WalkTime.Minutes()),
+		Trains:        []api.SubwayTrain{},
+	}
+	for _, update := range updates {
+		if len(stop.Routes) > 0 && !slices.Contains(stop.Routes, update.Line) {
+			continue
+		}
+		arrival := update.ArrivalTime()
+		if arrival < now.Unix() {
+			continue
+		}
+		untilArrival := time.Unix(arrival, 0).Sub(now)
+		minutes := int(untilArrival.Minutes())
+		status := CatchStatus(untilArrival, stop.WalkTime)
+		res.Trains = append(res.Trains, api.SubwayTrain{Minutes: minutes, Status: status})
+		if !res.HasCatchable && status != api.TrainMissed {
+			res.HasCatchable = true
+			res.LeaveIn = int((untilArrival - stop.WalkTime).Minutes())
+		}
+		if res.HasTrains {
+			res.FurtherTrains = append(res.FurtherTrains, minutes)
+			continue
+		}
+		res.HasTrains = true
+		res.NextTrainIn = minutes
+		res.Destination = update.Destination.Name
+		res.TrainLine = string(update.Line)
+		res.TrainID = update.TrainID
+		res.IsUnassigned = update.TrainID != "" && !update.IsAssigned
+		res.Track = update.Track()
+		res.IsRerouted = update.IsRerouted()
+		res.Delay = delayMinutes(update.Delay)
+		if res.StopName == "" {
+			res.StopName = update.Stop.Name
+		}
+	}
+	if res.TrainLine == "" || res.TrainLine == string(subway.UnknownTrain) {
+		if len(stop.Routes) > 0 {
+			res.TrainLine = string(stop.Routes[0])
+		} else {
+			res.TrainLine = string(subway.StopIdToLine(stop.ID))
+		}
+	}
+	if res.StopName == "" {
+		res.StopName = stop.ID
+	}
+	return res
 }
 
 func (s *Server) HandleSubwayFull(w http.ResponseWriter, r *http.Request) {
@@ -79,86 +167,358 @@ func (s *Server) HandleSubwayLine(w http.ResponseWriter, r *http.Request) {
 	if line == subway.UnknownTrain {
 		line = subway.LTrain
 	}
-	allStops, err := s.subwayCli.GetStopsOnLine(r.Context(), line)
+	sections, err := s.subwayCli.GetLineDiagram(r.Context(), line)
 	if err != nil {
 		slog.Error("failed to get stops", "err", err, "train", line)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
-	trains, alerts, err := s.subwayCli.GetTrains(r.Context(), line)
+	lineTrains, freshness, err := fallback.Fetch(r.Context(), s.fallback, "subway", "line@"+string(line), func(ctx context.Context) (subwayTrains, error) {
+		trains, alerts, err := s.subwayCli.GetTrains(ctx, line)
+		return subwayTrains{trains, alerts}, err
+	})
+	trains, alerts := lineTrains.trains, lineTrains.alerts
 	if err != nil {
 		slog.Error("failed to get trains", "err", err, "train", line)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 	data := api.SubwayLine{
-		Segments: []api.SubwaySegment{},
-		Alerts:   []string{},
+		Freshness: freshness.In(s.tz),
+		Sections:  LineSections(sections, trains),
+		Alerts:    []api.SubwayAlert{},
+	}
+	MarkOutages(data.Sections, s.getOutages(r.Context()), time.Now().In(s.tz))
+
+	for _, alert := range alerts {
+		data.Alerts = append(data.Alerts, SubwayAlert(alert, s.subwayNow().In(s.tz)))
+	}
+
+	s.render(w, r, "SubwayLine", data)
+}
+
+const (
+	defaultStationResults = 10
+	maxStationResults     = 100
+)
+
+// HandleSubwayStations searches the stations by name with ?q=, or lists the
+// nearest ones to ?near=lat,lon, which defaults to the weather location.
+func (s *Server) HandleSubwayStations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := defaultStationResults
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = min(l, maxStationResults)
 	}
 
-	stations := []subway.SubwayStop{}
-	for _, stop := range allStops {
-		if stop.LocationType == subway.RootStationType {
-			stations = append(stations, stop)
+	data := api.SubwayStations{Stations: []api.SubwayStation{}}
+	var stations []subway.Station
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		data.Query = q
+		stations = s.subwayCli.SearchStations(q, limit)
+	} else {
+		data.Near = query.Get("near")
+		if data.Near == "" {
+			data.Near = s.config.WeatherLocation
 		}
+		lat, lon, err := parseLatLon(data.Near)
+		if err != nil {
+			slog.Debug("invalid station search location", "near", data.Near, "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stations = s.subwayCli.NearestStations(lat, lon, limit)
 	}
-	slices.SortFunc(stations, func(a, b subway.SubwayStop) int {
-		idA, _ := strconv.Atoi(a.ID[1:])
-		idB, _ := strconv.Atoi(b.ID[1:])
-		if idA < idB {
-			return -1
-		} else if idA > idB {
-			return 1
-		} else {
-			return 0
+
+	for _, station := range stations {
+		routes := []string{}
+		for _, route := range station.Routes {
+			routes = append(routes, string(route))
 		}
+		data.Stations = append(data.Stations, api.SubwayStation{
+			ID:             station.ID,
+			Name:           station.Name,
+			Routes:         routes,
+			NorthStopID:    station.NorthStopID,
+			SouthStopID:    station.SouthStopID,
+			Latitude:       station.Latitude,
+			Longitude:      station.Longitude,
+			DistanceMeters: int(math.Round(station.Distance)),
+		})
+	}
+	s.render(w, r, "SubwayStations", data)
+}
+
+// HandleSubwayHistory graphs the headways recorded at a configured stop by
+// hour of day over the last ?days=1, 7 or 30 days. ?kind=predicted graphs the
+// predicted headways instead of the observed ones.
+func (s *Server) HandleSubwayHistory(w http.ResponseWriter, r *http.Request) {
+	if s.importer == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if len(s.config.SubwayStops) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	stop := s.config.SubwayStops[0]
+	if i := slices.IndexFunc(s.config.SubwayStops, func(c SubwayStopConfig) bool { return c.ID == query.Get("stop") }); i >= 0 {
+		stop = s.config.SubwayStops[i]
+	}
+	days := 1
+	if d, err := strconv.Atoi(query.Get("days")); err == nil && (d == 7 || d == 30) {
+		days = d
+	}
+	kind := query.Get("kind")
+	if kind != "predicted" {
+		kind = "observed"
+	}
+
+	history, err := s.subwayCli.GetHeadwayHistory(r.Context(), s.importer, stop.ID, stop.Routes, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		slog.Error("failed to get headway history", "err", err, "stop", stop.ID, "days", days)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	buckets := HeadwaysByHour(history, kind, s.tz)
+	slog.Debug("subway history", "stop", stop.ID, "buckets", buckets)
+
+	maxY := 0
+	for _, b := range buckets {
+		maxY = max(maxY, b.Max)
+	}
+	data := []api.GraphPoint{}
+	yDiff := max(1, maxY)
+	for _, b := range buckets {
+		bottom := int(200.0 / float64(yDiff) * float64(b.Min))
+		data = append(data, api.GraphPoint{
+			Min:   bottom,
+			Max:   int(200.0/float64(yDiff)*float64(b.Max)) - bottom,
+			Width: 200.0 / float64(len(buckets)),
+		})
+	}
+
+	stops := []api.SubwayStopSelection{}
+	for _, c := range s.config.SubwayStops {
+		name := c.Label
+		if name == "" {
+			name = c.ID
+		}
+		stops = append(stops, api.SubwayStopSelection{
+			ID:         c.ID,
+			Name:       name,
+			Days:       days,
+			Kind:       kind,
+			IsSelected: c.ID == stop.ID,
+		})
+	}
+
+	s.render(w, r, "SubwayHistory", api.SubwayHistory{
+		Days:      days,
+		Stop:      stop.ID,
+		Kind:      kind,
+		MaxY:      maxY,
+		MinY:      0,
+		Data:      data,
+		StartTime: "12AM",
+		EndTime:   "11PM",
+		Stops:     stops,
 	})
+}
 
-	nextStopHasTrainApproaching := false
-	for _, station := range stations {
-		approachingSegment := api.SubwaySegment{}
-		stationSegment := api.SubwaySegment{
-			IsStation:      true,
-			StationName:    station.Name,
-			NoServiceNorth: (station.AreTrainsStopping & subway.TrainsStoppingNorth) == 0,
-			NoServiceSouth: (station.AreTrainsStopping & subway.TrainsStoppingSouth) == 0,
+// HeadwaysByHour buckets the observed or predicted headways by the hour of day
+// in tz they were recorded at, with the shortest and longest headway in
+// minutes of each hour. Hours without headways are left empty.
+func HeadwaysByHour(history []subway.HeadwayRecord, kind string, tz *time.Location) []Bucket {
+	buckets := make([]Bucket, 24)
+	for i := range buckets {
+		buckets[i].Min = -1
+	}
+	for _, h := range history {
+		headway := h.ObservedHeadway
+		if kind == "predicted" {
+			headway = h.PredictedHeadway
+		}
+		if headway <= 0 {
+			continue
 		}
+		minutes := int(headway.Minutes())
+		b := &buckets[h.Stamp.In(tz).Hour()]
+		if b.Min == -1 {
+			b.Min, b.Max = minutes, minutes
+			continue
+		}
+		b.Min = min(b.Min, minutes)
+		b.Max = max(b.Max, minutes)
+	}
+	for i := range buckets {
+		if buckets[i].Min == -1 {
+			buckets[i] = Bucket{}
+		}
+	}
+	return buckets
+}
 
-		if nextStopHasTrainApproaching {
-			approachingSegment.HasTrainNorth = true
-			nextStopHasTrainApproaching = false
+// LineSections places trains on the diagram of a line. The tracks of each
+// station are marked if a train is stopped there, and the tracks between two
+// stations if a train is on its way from one to the other. Northbound trains
+// run towards the start of each branch.
+func LineSections(sections []subway.LineSection, trains []subway.TrainUpdate) []api.SubwaySection {
+	res := []api.SubwaySection{}
+	for i, section := range sections {
+		// the tracks into a neighbouring section are drawn by its branches
+		// if it has more than one
+		var above, below *subway.SubwayStop
+		hasTop, hasBottom := true, true
+		if i > 0 {
+			prev := sections[i-1].Branches
+			hasTop = len(prev) == 1
+			if hasTop {
+				above = &prev[0][len(prev[0])-1]
+			}
+		}
+		if i < len(sections)-1 {
+			next := sections[i+1].Branches
+			hasBottom = len(next) == 1
+			if hasBottom {
+				below = &next[0][0]
+			}
 		}
 
-		// check for a train at or approaching this station
-		for _, train := range trains {
-			if strings.HasPrefix(train.NextStop.ID, station.ID) {
-				if strings.HasSuffix(train.NextStop.ID, "N") {
+		apiSection := api.SubwaySection{Branches: []api.SubwayBranch{}}
+		for j, branch := range section.Branches {
+			// trains whose trip is unknown are assumed to be on the first branch
+			passes := func(train subway.TrainUpdate, stationID string) bool {
+				if train.Stations == nil {
+					return j == 0
+				}
+				return slices.Contains(train.Stations, stationID)
+			}
+			segments := []api.SubwaySegment{}
+			if hasTop {
+				top := api.SubwaySegment{}
+				for _, train := range trains {
 					if train.IsAtStop {
-						stationSegment.HasTrainNorth = true
-					} else {
-						nextStopHasTrainApproaching = true
+						continue
 					}
-				} else if strings.HasSuffix(train.NextStop.ID, "S") {
-					if train.IsAtStop {
-						stationSegment.HasTrainSouth = true
-					} else {
-						approachingSegment.HasTrainSouth = true
+					switch nextStation, dir := trainPosition(train); {
+					case dir == "S" && nextStation == branch[0].ID:
+						markTrain(&top, "S", train)
+					case dir == "N" && above != nil && nextStation == above.ID && passes(train, branch[0].ID):
+						markTrain(&top, "N", train)
+					}
+				}
+				segments = append(segments, top)
+			}
+			for k, station := range branch {
+				stationSegment := api.SubwaySegment{
+					IsStation:      true,
+					StationID:      station.ID,
+					StationName:    station.Name,
+					NoServiceNorth: (station.AreTrainsStopping & subway.TrainsStoppingNorth) == 0,
+					NoServiceSouth: (station.AreTrainsStopping & subway.TrainsStoppingSouth) == 0,
+				}
+				between := api.SubwaySegment{}
+				for _, train := range trains {
+					nextStation, dir := trainPosition(train)
+					switch {
+					case train.IsAtStop && nextStation == station.ID:
+						markTrain(&stationSegment, dir, train)
+					case train.IsAtStop:
+					case dir == "N" && nextStation == station.ID:
+						markTrain(&between, "N", train)
+					case dir == "S" && k < len(branch)-1 && nextStation == branch[k+1].ID:
+						markTrain(&between, "S", train)
+					case dir == "S" && k == len(branch)-1 && below != nil && nextStation == below.ID && passes(train, station.ID):
+						markTrain(&between, "S", train)
 					}
 				}
+				segments = append(segments, stationSegment)
+				if k < len(branch)-1 || hasBottom {
+					segments = append(segments, between)
+				}
 			}
+			apiSection.Branches = append(apiSection.Branches, api.SubwayBranch{Segments: segments})
 		}
+		res = append(res, apiSection)
+	}
+	return res
+}
 
-		data.Segments = append(data.Segments, approachingSegment, stationSegment)
+// markTrain marks a train heading in dir on segment, along with how late it
+// is if it is the latest one there.
+func markTrain(segment *api.SubwaySegment, dir string, train subway.TrainUpdate) {
+	switch dir {
+	case "N":
+		segment.HasTrainNorth = true
+		segment.DelayNorth = max(segment.DelayNorth, delayMinutes(train.Delay))
+	case "S":
+		segment.HasTrainSouth = true
+		segment.DelaySouth = max(segment.DelaySouth, delayMinutes(train.Delay))
 	}
-	data.Segments = append(data.Segments, api.SubwaySegment{
-		HasTrainNorth: nextStopHasTrainApproaching,
-	})
+}
 
-	for _, alert := range alerts {
-		data.Alerts = append(data.Alerts, alert.DescriptionText.String())
+// delayMinutes rounds a delay in seconds towards zero, so that a train is
+// only late once it is a full minute behind.
+func delayMinutes(seconds int64) int {
+	return int(seconds / 60)
+}
+
+// trainPosition returns the parent station of the train's next stop and the
+// direction it is heading in, N or S.
+func trainPosition(train subway.TrainUpdate) (string, string) {
+	id := train.NextStop.ID
+	if strings.HasSuffix(id, "N") || strings.HasSuffix(id, "S") {
+		return id[:len(id)-1], id[len(id)-1:]
+	}
+	return id, ""
+}
+
+// SubwayAlert formats a service alert for display at now.
+func SubwayAlert(alert subway.ServiceAlert, now time.Time) api.SubwayAlert {
+	res := api.SubwayAlert{
+		Header:      alert.Header,
+		Description: alert.Description,
+		Routes:      []string{},
+	}
+	if alert.Effect != 0 && alert.Effect != gtfsrt.Alert_UNKNOWN_EFFECT {
+		res.Effect = enumText(alert.Effect.String())
+	}
+	if alert.Cause != 0 && alert.Cause != gtfsrt.Alert_UNKNOWN_CAUSE {
+		res.Cause = enumText(alert.Cause.String())
 	}
+	for _, route := range alert.Routes() {
+		res.Routes = append(res.Routes, string(route))
+	}
+	for _, period := range alert.ActivePeriods {
+		if !period.End.IsZero() && !now.Before(period.Start) && now.Before(period.End) {
+			res.Until = period.End.In(now.Location()).Format("Mon Jan 2 3:04 PM")
+			break
+		}
+	}
+	return res
+}
+
+// CatchStatus says whether a train arriving in untilArrival can be caught by
+// someone who needs walk to get to the stop. A train that leaves less than a
+// minute to spare needs them to leave now.
+func CatchStatus(untilArrival, walk time.Duration) api.TrainStatus {
+	switch spare := untilArrival - walk; {
+	case spare < 0:
+		return api.TrainMissed
+	case spare < time.Minute:
+		return api.TrainLeaveNow
+	default:
+		return api.TrainCatchable
+	}
+}
 
-	s.executeTemplate(w, "SubwayLine", data)
+// enumText turns an enum name such as SIGNIFICANT_DELAYS into "significant delays".
+func enumText(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", " "))
 }
 
 func MinutesUntilArrival(arrival int64, tz *time.Location) int {
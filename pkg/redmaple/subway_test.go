@@ -1,10 +1,18 @@
 package redmaple_test
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"testing"
 	"time"
 
+	api "github.com/mpoegel/red-maple/pkg/api"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
 )
 
 func TestMinutesUntilArrival(t *testing.T) {
@@ -68,3 +76,316 @@ func TestMinutesUntilArrival(t *testing.T) {
 		})
 	}
 }
+
+func stopUpdate(line subway.TrainLine, arrival time.Time, destination string) *subway.StopUpdate {
+	return &subway.StopUpdate{
+		Stop:        subway.SubwayStop{ID: "R20N", Name: "14 St-Union Sq"},
+		Line:        line,
+		Arrival:     &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival.Unix())},
+		Destination: subway.SubwayStop{Name: destination},
+	}
+}
+
+func TestSummarizeTrips(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	updates := []*subway.StopUpdate{
+		stopUpdate(subway.QTrain, now.Add(-1*time.Minute), "Departed"),
+		stopUpdate(subway.NTrain, now.Add(2*time.Minute), "Astoria"),
+		stopUpdate(subway.QTrain, now.Add(4*time.Minute), "96 St"),
+		stopUpdate(subway.QTrain, now.Add(9*time.Minute), "96 St"),
+		stopUpdate(subway.RTrain, now.Add(11*time.Minute), "Forest Hills"),
+		stopUpdate(subway.QTrain, now.Add(15*time.Minute), "96 St"),
+	}
+
+	got := redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "R20N", Routes: []subway.TrainLine{subway.QTrain}}, updates, now)
+	if !got.HasTrains || got.NextTrainIn != 4 || got.TrainLine != "Q" || got.Destination != "96 St" {
+		t.Errorf("expected the Q to 96 St in 4 minutes, got %+v", got)
+	}
+	if !slices.Equal(got.FurtherTrains, []int{9, 15}) {
+		t.Errorf("expected further Q trains in 9 and 15 minutes, got %v", got.FurtherTrains)
+	}
+	if got.StopName != "14 St-Union Sq" {
+		t.Errorf("expected the stop name, got %s", got.StopName)
+	}
+
+	got = redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "R20N", Label: "Uptown"}, updates[:2], now)
+	if got.NextTrainIn != 2 || got.TrainLine != "N" || len(got.FurtherTrains) != 0 || got.StopName != "Uptown" {
+		t.Errorf("expected only the N in 2 minutes at Uptown, got %+v", got)
+	}
+}
+
+func TestSummarizeTrips_NoTrains(t *testing.T) {
+	got := redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S"}, nil, time.Now())
+	if got.HasTrains {
+		t.Errorf("expected no trains, got %+v", got)
+	}
+	if got.TrainLine != "L" || got.StopName != "L03S" {
+		t.Errorf("expected the L at L03S, got %+v", got)
+	}
+
+	got = redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "901S"}, nil, time.Now())
+	if got.TrainLine != "GS" {
+		t.Errorf("expected the 42 St Shuttle at 901S, got %+v", got)
+	}
+}
+
+func TestSummarizeTrips_Nyct(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	update := stopUpdate(subway.SixTrain, now.Add(3*time.Minute), "Pelham Bay Park")
+	update.NyctTrip = subway.NyctTrip{TrainID: "06 1029+ BBR/PEL"}
+	update.NyctTrack = subway.NyctTrack{ScheduledTrack: "1", ActualTrack: "2"}
+
+	got := redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "635N"}, []*subway.StopUpdate{update}, now)
+	if got.TrainID != "06 1029+ BBR/PEL" || !got.IsUnassigned {
+		t.Errorf("expected an unassigned 06 1029+ BBR/PEL, got %+v", got)
+	}
+	if !got.IsRerouted || got.Track != "2" {
+		t.Errorf("expected a reroute to track 2, got %+v", got)
+	}
+}
+
+func TestSummarizeTrips_Delay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	late := stopUpdate(subway.LTrain, now.Add(7*time.Minute), "Canarsie")
+	late.ScheduledTime = now.Add(time.Minute).Unix()
+	late.Delay = 6*60 + 30
+
+	got := redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S"}, []*subway.StopUpdate{late}, now)
+	if got.Delay != 6 {
+		t.Errorf("expected the next train 6 minutes late, got %d", got.Delay)
+	}
+
+	early := stopUpdate(subway.LTrain, now.Add(2*time.Minute), "Canarsie")
+	early.Delay = -45
+	got = redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S"}, []*subway.StopUpdate{early}, now)
+	if got.Delay != 0 {
+		t.Errorf("expected less than a minute early to be on time, got %d", got.Delay)
+	}
+}
+
+func TestSummarizeTrips_WalkTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	updates := []*subway.StopUpdate{
+		stopUpdate(subway.LTrain, now.Add(2*time.Minute), "Canarsie"),
+		stopUpdate(subway.LTrain, now.Add(6*time.Minute+30*time.Second), "Canarsie"),
+		stopUpdate(subway.LTrain, now.Add(10*time.Minute), "Canarsie"),
+	}
+
+	got := redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S", WalkTime: 6 * time.Minute}, updates, now)
+	want := []api.SubwayTrain{
+		{Minutes: 2, Status: api.TrainMissed},
+		{Minutes: 6, Status: api.TrainLeaveNow},
+		{Minutes: 10, Status: api.TrainCatchable},
+	}
+	if !slices.Equal(got.Trains, want) {
+		t.Errorf("expected trains %v, got %v", want, got.Trains)
+	}
+	if got.WalkMinutes != 6 || !got.HasCatchable || got.LeaveIn != 0 {
+		t.Errorf("expected to leave now for the second train, got %+v", got)
+	}
+
+	got = redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S", WalkTime: 6 * time.Minute}, updates[2:], now)
+	if !got.HasCatchable || got.LeaveIn != 4 {
+		t.Errorf("expected to leave in 4 minutes, got %+v", got)
+	}
+
+	got = redmaple.SummarizeTrips(redmaple.SubwayStopConfig{ID: "L03S", WalkTime: 15 * time.Minute}, updates, now)
+	if got.HasCatchable {
+		t.Errorf("expected every train to be missed, got %+v", got)
+	}
+}
+
+func TestSubwayAlert(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, loc)
+	alert := subway.ServiceAlert{
+		Header: "L trains are delayed",
+		ActivePeriods: []subway.ActivePeriod{
+			{Start: now.Add(-time.Hour), End: now.Add(2 * time.Hour)},
+		},
+		Effect: gtfsrt.Alert_SIGNIFICANT_DELAYS,
+		InformedEntities: []subway.InformedEntity{
+			{RouteID: "L", Route: subway.LTrain},
+		},
+	}
+
+	got := redmaple.SubwayAlert(alert, now)
+	if got.Header != "L trains are delayed" || got.Effect != "significant delays" || got.Cause != "" {
+		t.Errorf("unexpected alert %+v", got)
+	}
+	if !slices.Equal(got.Routes, []string{"L"}) {
+		t.Errorf("expected the L, got %v", got.Routes)
+	}
+	if got.Until != "Mon Jan 1 10:00 AM" {
+		t.Errorf("expected the alert to last until 10 AM, got %q", got.Until)
+	}
+}
+
+func TestLineSections(t *testing.T) {
+	station := func(id string) subway.SubwayStop {
+		return subway.SubwayStop{ID: id, Name: id, AreTrainsStopping: subway.TrainsStoppingNorth | subway.TrainsStoppingSouth}
+	}
+	sections := []subway.LineSection{
+		{Branches: [][]subway.SubwayStop{{station("A06"), station("A61")}}},
+		{Branches: [][]subway.SubwayStop{
+			{station("A63"), station("A65")},
+			{station("H02"), station("H03")},
+		}},
+	}
+	lefferts := []string{"A06", "A61", "A63", "A65"}
+	farRockaway := []string{"A06", "A61", "H02", "H03"}
+	trains := []subway.TrainUpdate{
+		{NextStop: subway.SubwayStop{ID: "A06S"}, IsAtStop: true},
+		{NextStop: subway.SubwayStop{ID: "A61S"}, Stations: lefferts, Delay: 4 * 60},
+		{NextStop: subway.SubwayStop{ID: "A61N"}, Stations: lefferts},
+		{NextStop: subway.SubwayStop{ID: "H02S"}, Stations: farRockaway},
+	}
+
+	got := redmaple.LineSections(sections, trains)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 sections, got %d", len(got))
+	}
+
+	// the trunk has no tracks below its last station, they are drawn by the
+	// branches
+	trunk := got[0].Branches[0].Segments
+	if len(trunk) != 4 {
+		t.Fatalf("expected 4 trunk segments, got %d", len(trunk))
+	}
+	if !trunk[1].IsStation || !trunk[1].HasTrainSouth || trunk[1].HasTrainNorth {
+		t.Errorf("expected a southbound train stopped at A06, got %+v", trunk[1])
+	}
+	if !trunk[2].HasTrainSouth || trunk[2].HasTrainNorth || trunk[2].DelaySouth != 4 {
+		t.Errorf("expected a southbound train 4 minutes late between A06 and A61, got %+v", trunk[2])
+	}
+
+	if len(got[1].Branches) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(got[1].Branches))
+	}
+	leffertsTop := got[1].Branches[0].Segments[0]
+	if !leffertsTop.HasTrainNorth || leffertsTop.HasTrainSouth {
+		t.Errorf("expected a northbound train from the Lefferts branch, got %+v", leffertsTop)
+	}
+	rockawayTop := got[1].Branches[1].Segments[0]
+	if !rockawayTop.HasTrainSouth || rockawayTop.HasTrainNorth {
+		t.Errorf("expected a southbound train to the Far Rockaway branch, got %+v", rockawayTop)
+	}
+	if n := len(got[1].Branches[0].Segments); n != 5 {
+		t.Errorf("expected 5 segments on the Lefferts branch, got %d", n)
+	}
+}
+
+// TestSubwayReplay replays a recorded L train disruption: the tile and the
+// line page show the trains and alerts as they were when it was recorded.
+func TestSubwayReplay(t *testing.T) {
+	recordedAt := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id: proto.String("L-trip"),
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{TripId: proto.String("L-trip"), RouteId: proto.String("L")},
+					StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
+						{StopId: proto.String("L03N"), Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(recordedAt.Add(5 * time.Minute).Unix())}},
+						{StopId: proto.String("L02N"), Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(recordedAt.Add(7 * time.Minute).Unix())}},
+					},
+				},
+			},
+			{
+				Id: proto.String("L-vehicle"),
+				Vehicle: &gtfsrt.VehiclePosition{
+					Trip:   &gtfsrt.TripDescriptor{TripId: proto.String("L-trip"), RouteId: proto.String("L")},
+					StopId: proto.String("L03N"),
+				},
+			},
+			{
+				Id: proto.String("alert"),
+				Alert: &gtfsrt.Alert{
+					ActivePeriod:   []*gtfsrt.TimeRange{{Start: proto.Uint64(uint64(recordedAt.Add(-time.Hour).Unix())), End: proto.Uint64(uint64(recordedAt.Add(time.Hour).Unix()))}},
+					InformedEntity: []*gtfsrt.EntitySelector{{RouteId: proto.String("L")}},
+					HeaderText:     &gtfsrt.TranslatedString{Translation: []*gtfsrt.TranslatedString_Translation{{Text: proto.String("L trains are running with delays")}}},
+				},
+			},
+		},
+	}
+	body, _ := proto.Marshal(feed)
+	dir := t.TempDir()
+	if err := subway.NewFeedRecorder(dir).Record("https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-l", body, recordedAt); err != nil {
+		t.Fatalf("Record error: %v", err)
+	}
+
+	config := newTestConfig()
+	config.SubwayReplayDir = dir
+	// nothing was recorded from the A's feed
+	config.SubwayStops = []redmaple.SubwayStopConfig{{ID: "L03N"}, {ID: "A24N"}}
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subway", nil))
+	tile := api.SubwayPartial{}
+	if err := json.NewDecoder(rec.Body).Decode(&tile); err != nil {
+		t.Fatalf("failed to decode subway tile: %v", err)
+	}
+	// a moment has passed since the replay started at the recording
+	if len(tile.Stops) != 2 || tile.Stops[0].NextTrainIn != 4 || !tile.Stops[0].HasIssues {
+		t.Fatalf("expected the recorded train and alert, got %+v", tile.Stops)
+	}
+	if !tile.Stops[1].IsUnavailable || tile.Stops[1].HasTrains {
+		t.Errorf("expected the stop without a feed to be unavailable, got %+v", tile.Stops[1])
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/subwayline?line=L", nil))
+	line := api.SubwayLine{}
+	if err := json.NewDecoder(rec.Body).Decode(&line); err != nil {
+		t.Fatalf("failed to decode subway line: %v", err)
+	}
+	if len(line.Alerts) != 1 || line.Alerts[0].Header != "L trains are running with delays" {
+		t.Errorf("expected the recorded alert, got %+v", line.Alerts)
+	}
+	hasTrain := false
+	for _, section := range line.Sections {
+		for _, branch := range section.Branches {
+			hasTrain = hasTrain || slices.ContainsFunc(branch.Segments, func(s api.SubwaySegment) bool { return s.HasTrainNorth })
+		}
+	}
+	if !hasTrain {
+		t.Error("expected the recorded train on the line diagram")
+	}
+}
+
+func TestHeadwaysByHour(t *testing.T) {
+	tz, _ := time.LoadLocation("America/New_York")
+	at := func(hour, minute int) time.Time { return time.Date(2026, 10, 16, hour, minute, 0, 0, tz) }
+	history := []subway.HeadwayRecord{
+		{Stamp: at(8, 0), ObservedHeadway: 6 * time.Minute, PredictedHeadway: 5 * time.Minute},
+		{Stamp: at(8, 30), ObservedHeadway: 14*time.Minute + 30*time.Second, PredictedHeadway: 5 * time.Minute},
+		{Stamp: at(8, 45)},
+		{Stamp: at(23, 10), ObservedHeadway: 20 * time.Minute},
+	}
+
+	buckets := redmaple.HeadwaysByHour(history, "observed", tz)
+	if len(buckets) != 24 {
+		t.Fatalf("expected a bucket per hour, got %d", len(buckets))
+	}
+	if buckets[8] != (redmaple.Bucket{Min: 6, Max: 14}) {
+		t.Errorf("expected 6 to 14 minutes at 8AM, got %+v", buckets[8])
+	}
+	if buckets[23] != (redmaple.Bucket{Min: 20, Max: 20}) || buckets[12] != (redmaple.Bucket{}) {
+		t.Errorf("unexpected buckets: %+v", buckets)
+	}
+
+	buckets = redmaple.HeadwaysByHour(history, "predicted", tz)
+	if buckets[8] != (redmaple.Bucket{Min: 5, Max: 5}) || buckets[23] != (redmaple.Bucket{}) {
+		t.Errorf("unexpected predicted buckets: %+v", buckets)
+	}
+}
@@ -0,0 +1,122 @@
+package redmaple
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
+)
+
+var templateRenderErrors = metrics.NewCounterVec("redmaple_template_render_errors_total",
+	"Failures rendering a template or encoding its data.", "template")
+
+func parseTemplates(fsys fs.FS) (*template.Template, error) {
+	plate, err := template.ParseFS(fsys, "pages/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("template html parse failure: %w", err)
+	}
+	plate, err = plate.ParseFS(fsys, "partials/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("template snippets parse failure: %w", err)
+	}
+	return plate, nil
+}
+
+func (s *Server) executeTemplate(w http.ResponseWriter, name string, data any) {
+	plate := s.templates.Load()
+	if err := plate.ExecuteTemplate(w, name, data); err != nil {
+		slog.Error("template execution failure", "name", name, "error", err, "data", data)
+		templateRenderErrors.Inc(name)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// render writes data as JSON for requests under /api/ or that accept JSON,
+// and otherwise renders it with the named template.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	if !wantsJSON(r) {
+		s.executeTemplate(w, name, data)
+		return
+	}
+	// encode to a buffer first, so that a failure can still set the status
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(data); err != nil {
+		slog.Error("json encoding failure", "name", name, "error", err, "data", data)
+		templateRenderErrors.Inc(name)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
+
+func wantsJSON(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(strings.TrimSpace(accept), ";")
+		switch mediaType {
+		case "application/json":
+			return true
+		case "text/html":
+			return false
+		}
+	}
+	return false
+}
+
+// WatchTemplates re-parses the templates whenever a file under the static
+// directory changes, checking at the given interval. It is meant for
+// development; parse errors are logged and the previous templates are kept.
+func (s *Server) WatchTemplates(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastModified := latestModTime(s.Config().StaticDir)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		active := s.active.Load()
+		modified := latestModTime(active.config.StaticDir)
+		if !modified.After(lastModified) {
+			continue
+		}
+		lastModified = modified
+
+		plate, err := parseTemplates(active.config.staticFS())
+		if err != nil {
+			slog.Error("failed to reload templates", "error", err)
+			continue
+		}
+		active.templates.Store(plate)
+		slog.Info("reloaded templates", "dir", active.config.StaticDir)
+	}
+}
+
+func latestModTime(dir string) time.Time {
+	latest := time.Time{}
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
@@ -0,0 +1,156 @@
+package redmaple
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+)
+
+// Tile is a widget that can be placed on the dashboard. A tile registered as
+// name is served at /x/<name>, rendered with its template, and as JSON at
+// /api/v1/<name>.
+type Tile interface {
+	// Template is the name of the template that renders the data from Fetch.
+	// Templates for new tiles can be added under partials/ in STATIC_DIR.
+	Template() string
+	// Refresh is how often the dashboard reloads the tile, or 0 to only load
+	// it once.
+	Refresh() time.Duration
+	// Link is the page opened by clicking on the tile, or "" for none.
+	Link() string
+	Fetch(r *http.Request) (any, error)
+	// Provider returns data to export with the other data points, or nil.
+	Provider() api.ProviderFunc
+}
+
+// TileFactory creates a tile for a server. It is called every time the server
+// is built, including on reload, so the tile can use the server's config.
+type TileFactory func(s *Server) Tile
+
+var tileRegistry = struct {
+	mu        sync.RWMutex
+	factories map[string]TileFactory
+}{factories: map[string]TileFactory{}}
+
+// RegisterTile makes a tile available to layouts under name. Tiles must be
+// registered before the config is read, usually from init. It panics if name
+// is already taken by another tile or fixed route, or cannot be used as a
+// single URL path segment.
+func RegisterTile(name string, factory TileFactory) {
+	if name == "" || url.PathEscape(name) != name {
+		panic(fmt.Sprintf("tile %q: name must be usable in a URL path", name))
+	}
+	if isPartialPath(name) {
+		panic(fmt.Sprintf("tile %q: name is already used by a fixed route", name))
+	}
+	tileRegistry.mu.Lock()
+	defer tileRegistry.mu.Unlock()
+	if _, ok := tileRegistry.factories[name]; ok {
+		panic(fmt.Sprintf("tile %q: already registered", name))
+	}
+	tileRegistry.factories[name] = factory
+}
+
+// tileNames returns the names of the registered tiles, sorted.
+func tileNames() []string {
+	tileRegistry.mu.RLock()
+	defer tileRegistry.mu.RUnlock()
+	names := []string{}
+	for name := range tileRegistry.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (s *Server) newTiles() map[string]Tile {
+	tileRegistry.mu.RLock()
+	defer tileRegistry.mu.RUnlock()
+	tiles := map[string]Tile{}
+	for name, factory := range tileRegistry.factories {
+		tiles[name] = factory(s)
+	}
+	return tiles
+}
+
+func (s *Server) handleTile(name string, tile Tile) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := tile.Fetch(r)
+		if err != nil {
+			slog.Error("failed to fetch tile", "tile", name, "err", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		s.render(w, r, tile.Template(), data)
+	}
+}
+
+// FuncTile implements Tile with the values of its fields.
+type FuncTile struct {
+	TemplateName string
+	RefreshEvery time.Duration
+	LinkTo       string
+	FetchFunc    func(r *http.Request) (any, error)
+	ProviderFunc api.ProviderFunc
+}
+
+func (t *FuncTile) Template() string {
+	return t.TemplateName
+}
+
+func (t *FuncTile) Refresh() time.Duration {
+	return t.RefreshEvery
+}
+
+func (t *FuncTile) Link() string {
+	return t.LinkTo
+}
+
+func (t *FuncTile) Fetch(r *http.Request) (any, error) {
+	return t.FetchFunc(r)
+}
+
+func (t *FuncTile) Provider() api.ProviderFunc {
+	return t.ProviderFunc
+}
+
+var _ Tile = (*FuncTile)(nil)
+
+func init() {
+	RegisterTile("weather", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Forecast", RefreshEvery: 10 * time.Minute, LinkTo: "/weather", FetchFunc: s.fetchWeather}
+	})
+	RegisterTile("indoor", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Indoor", RefreshEvery: 1 * time.Minute, LinkTo: "/indoor", FetchFunc: s.fetchIndoor}
+	})
+	RegisterTile("outdoor", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Outdoor", RefreshEvery: 1 * time.Minute, LinkTo: "/outdoor", FetchFunc: s.fetchOutdoor}
+	})
+	RegisterTile("subway", func(s *Server) Tile {
+		// arrivals count down from the polled feeds, so refreshing is cheap
+		return &FuncTile{TemplateName: "Subway", RefreshEvery: 15 * time.Second, LinkTo: "/subway", FetchFunc: s.fetchSubway}
+	})
+	RegisterTile("bus", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Bus", RefreshEvery: 30 * time.Second, FetchFunc: s.fetchBus}
+	})
+	RegisterTile("citibike", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Citibike", RefreshEvery: 5 * time.Minute, LinkTo: "/bikes", FetchFunc: s.fetchCitibike}
+	})
+	RegisterTile("sunrise", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Sunrise", RefreshEvery: 60 * time.Minute, LinkTo: "/sunrise", FetchFunc: s.fetchSunrise}
+	})
+	RegisterTile("datetime", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Datetime", RefreshEvery: 1 * time.Second, FetchFunc: s.fetchDatetime}
+	})
+	RegisterTile("navigation", func(s *Server) Tile {
+		return &FuncTile{TemplateName: "Navigation", FetchFunc: func(r *http.Request) (any, error) {
+			return struct{}{}, nil
+		}}
+	})
+}
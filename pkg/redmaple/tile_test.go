@@ -0,0 +1,106 @@
+package redmaple_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+)
+
+type plantsPartial struct {
+	Thirsty []string `json:"thirsty"`
+}
+
+// registerTestTiles registers the tiles used by the tests once, since a name
+// can only be registered once per process.
+var registerTestTiles = sync.OnceFunc(func() {
+	redmaple.RegisterTile("plants", func(s *redmaple.Server) redmaple.Tile {
+		return &redmaple.FuncTile{
+			TemplateName: "Plants",
+			RefreshEvery: 30 * time.Minute,
+			FetchFunc: func(r *http.Request) (any, error) {
+				return plantsPartial{Thirsty: []string{"fern"}}, nil
+			},
+		}
+	})
+	redmaple.RegisterTile("broken", func(s *redmaple.Server) redmaple.Tile {
+		return &redmaple.FuncTile{
+			TemplateName: "Broken",
+			FetchFunc: func(r *http.Request) (any, error) {
+				return nil, errors.New("sensor offline")
+			},
+		}
+	})
+	redmaple.RegisterTile("unencodable", func(s *redmaple.Server) redmaple.Tile {
+		return &redmaple.FuncTile{
+			TemplateName: "Unencodable",
+			FetchFunc: func(r *http.Request) (any, error) {
+				return map[string]any{"moisture": math.NaN()}, nil
+			},
+		}
+	})
+})
+
+func TestRegisterTile(t *testing.T) {
+	registerTestTiles()
+
+	config := newTestConfig()
+	config.Layouts["plants"] = redmaple.Layout{Tiles: []redmaple.TileConfig{{Name: "plants"}, {Name: "datetime"}}}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("expected registered tile to be accepted in a layout, got %v", err)
+	}
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/plants", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var data plantsPartial
+	if err := json.Unmarshal(rec.Body.Bytes(), &data); err != nil || len(data.Thirsty) != 1 {
+		t.Errorf("unexpected tile data %q: %v", rec.Body.String(), err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/unencodable", nil))
+	if rec.Code != http.StatusInternalServerError || rec.Body.Len() != 0 {
+		t.Errorf("expected status 500 without a body for data that cannot be encoded, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x/broken", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503 for a failing tile, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/?layout=plants", nil))
+	if want := `hx-get="/x/plants" hx-trigger="load, every 30m"`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("expected page to contain %q", want)
+	}
+}
+
+func TestRegisterTileInvalidName(t *testing.T) {
+	for _, name := range []string{"", "GET plants", "plants/{id}", "subway", "sundial"} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected RegisterTile(%q) to panic", name)
+				}
+			}()
+			redmaple.RegisterTile(name, func(s *redmaple.Server) redmaple.Tile { return nil })
+		})
+	}
+}
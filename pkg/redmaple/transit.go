@@ -0,0 +1,164 @@
+package redmaple
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+	transit "github.com/mpoegel/red-maple/pkg/transit"
+)
+
+type transitTrips struct {
+	updates []*transit.StopUpdate
+	alerts  []transit.Alert
+}
+
+// newTransitClients creates a client for each configured agency, reusing the
+// clients of prev whose static data and feeds are unchanged. The configured
+// stops and routes are checked against the static data here rather than in
+// Validate, so that each GTFS zip is only parsed once.
+func newTransitClients(config Config, prev *Server) (map[string]transit.Client, error) {
+	clients := map[string]transit.Client{}
+	errs := []error{}
+	for _, agency := range config.Transit {
+		client, err := newTransitClient(config, agency, prev)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transit: %s: gtfs: %w", agency.Name, err))
+			continue
+		}
+		for _, stop := range agency.Stops {
+			if _, ok := client.GetStop(stop.ID); !ok {
+				errs = append(errs, fmt.Errorf("transit: %s: unknown stop %q", agency.Name, stop.ID))
+			}
+			for _, route := range stop.Routes {
+				if _, ok := client.GetRoute(route); !ok {
+					errs = append(errs, fmt.Errorf("transit: %s: %s: unknown route %q", agency.Name, stop.ID, route))
+				}
+			}
+		}
+		clients[agency.Name] = client
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return clients, nil
+}
+
+func newTransitClient(config Config, agency TransitConfig, prev *Server) (transit.Client, error) {
+	if prev != nil {
+		i := slices.IndexFunc(prev.config.Transit, func(t TransitConfig) bool { return t.Name == agency.Name })
+		if i >= 0 && prev.config.Transit[i].sameClient(agency) {
+			return prev.transit[agency.Name], nil
+		}
+	}
+	static, err := transit.OpenStatic(agency.GTFS)
+	if err != nil {
+		return nil, err
+	}
+	opts := []transit.Option{
+		transit.WithHTTPClient(newHTTPClient(agency.Name)),
+		transit.WithFeedURLs(agency.Feeds...),
+		transit.WithPollInterval(config.SubwayPollInterval),
+	}
+	if agency.APIKey != "" {
+		opts = append(opts, transit.WithAPIKey(agency.APIKeyHeader, agency.APIKey))
+	}
+	return transit.NewClient(static, opts...), nil
+}
+
+func (s *Server) newTransitTile(agency TransitConfig) Tile {
+	return &FuncTile{TemplateName: "Transit", RefreshEvery: 30 * time.Second, FetchFunc: func(r *http.Request) (any, error) {
+		return s.fetchTransit(r, agency)
+	}}
+}
+
+func (s *Server) fetchTransit(r *http.Request, agency TransitConfig) (any, error) {
+	client := s.transit[agency.Name]
+	data := api.TransitPartial{Agency: agency.Label, Stops: []api.TransitUpdate{}}
+	if data.Agency == "" {
+		data.Agency = agency.Name
+	}
+	now := time.Now()
+
+	for _, stop := range agency.Stops {
+		trips, freshness, err := fallback.Fetch(r.Context(), s.fallback, agency.Name, "stop@"+stop.ID, func(ctx context.Context) (transitTrips, error) {
+			updates, alerts, err := client.GetTripsAtStop(ctx, stop.ID)
+			return transitTrips{updates, alerts}, err
+		})
+		update := SummarizeTransitTrips(stop, trips.updates, now)
+		if update.StopName == "" {
+			update.StopName = stop.ID
+			if info, ok := client.GetStop(stop.ID); ok && info.Name != "" {
+				update.StopName = info.Name
+			}
+		}
+		if err != nil {
+			slog.Warn("failed to get trips", "agency", agency.Name, "stop", stop.ID, "err", err)
+			update.IsUnavailable = true
+			data.Stops = append(data.Stops, update)
+			continue
+		}
+		if len(trips.updates) == 0 {
+			slog.Warn("no trips found", "agency", agency.Name, "stop", stop.ID)
+		}
+		update.HasIssues = slices.ContainsFunc(trips.alerts, func(alert transit.Alert) bool {
+			return len(stop.Routes) == 0 || affectsRoutes(alert, stop.Routes)
+		})
+		data.Stops = append(data.Stops, update)
+		data.Freshness = data.Freshness.Merge(freshness.In(s.tz))
+	}
+
+	return data, nil
+}
+
+// affectsRoutes reports whether an alert that is already known to be about a
+// stop is about any of routeIDs there, rather than only about other routes.
+func affectsRoutes(alert transit.Alert, routeIDs []string) bool {
+	if len(alert.InformedEntities) == 0 {
+		return true
+	}
+	for _, entity := range alert.InformedEntities {
+		if entity.RouteID == "" || slices.Contains(routeIDs, entity.RouteID) {
+			return true
+		}
+	}
+	return false
+}
+
+// SummarizeTransitTrips turns the upcoming trips at a configured stop into the
+// next trip and the minutes until each one after it, skipping trips on routes
+// the stop is not configured for and trips that have already left. The stop
+// name is only set if the stop has a label.
+func SummarizeTransitTrips(stop TransitStopConfig, updates []*transit.StopUpdate, now time.Time) api.TransitUpdate {
+	res := api.TransitUpdate{
+		StopID:       stop.ID,
+		StopName:     stop.Label,
+		FurtherTrips: []int{},
+	}
+	for _, update := range updates {
+		if len(stop.Routes) > 0 && !slices.Contains(stop.Routes, update.Route.ID) {
+			continue
+		}
+		if update.Arrival < now.Unix() {
+			continue
+		}
+		minutes := int(time.Unix(update.Arrival, 0).Sub(now).Minutes())
+		if res.HasTrips {
+			res.FurtherTrips = append(res.FurtherTrips, minutes)
+			continue
+		}
+		res.HasTrips = true
+		res.NextTripIn = minutes
+		res.Route = update.Route.Name()
+		res.RouteColor = update.Route.Color
+		res.Headsign = update.Headsign
+		res.Delay = delayMinutes(update.Delay)
+	}
+	return res
+}
@@ -0,0 +1,229 @@
+package redmaple_test
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	redmaple "github.com/mpoegel/red-maple/pkg/redmaple"
+	transit "github.com/mpoegel/red-maple/pkg/transit"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// writeFerryGTFS writes a static GTFS zip of a ferry route with two landings
+// and returns its path.
+func writeFerryGTFS(t *testing.T) string {
+	t.Helper()
+	files := map[string]string{
+		"stops.txt": "stop_id,stop_name,stop_lat,stop_lon\n" +
+			"87,Wall St/Pier 11,40.703161,-74.005095\n" +
+			"20,DUMBO/Fulton Ferry,40.703830,-73.994356\n",
+		"routes.txt": "route_id,route_short_name,route_long_name,route_color\n" +
+			"ER,ER,East River,00839C\n" +
+			"SB,SB,South Brooklyn,FFD100\n",
+		"trips.txt": "route_id,trip_id,trip_headsign\n" +
+			"ER,ER1,Long Island City\n" +
+			"SB,SB1,Bay Ridge\n",
+	}
+	path := filepath.Join(t.TempDir(), "ferry.zip")
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create zip: %v", err)
+	}
+	defer fp.Close()
+	archive := zip.NewWriter(fp)
+	for name, data := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+	return path
+}
+
+func TestReadConfigTransit(t *testing.T) {
+	gtfs := writeFerryGTFS(t)
+	filename := writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"transit": [{
+			"name": "ferry",
+			"label": "NYC Ferry",
+			"gtfs": "`+gtfs+`",
+			"feeds": ["http://redmaple.tree/ferry"],
+			"stops": [{"id": "87", "routes": ["ER"]}]
+		}],
+		"layouts": {"default": {"tiles": [{"name": "ferry"}, {"name": "datetime"}]}},
+		"health": {"critical": ["ferry"]}
+	}`)
+	config, err := redmaple.ReadConfig(filename)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(config.Transit) != 1 || config.Transit[0].Stops[0].Routes[0] != "ER" {
+		t.Errorf("unexpected transit config: %+v", config.Transit)
+	}
+
+	filename = writeConfigFile(t, `{
+		"vendor_dir": "../../vendored",
+		"transit": [
+			{"name": "subway", "gtfs": "`+gtfs+`", "feeds": ["http://redmaple.tree/ferry"]},
+			{"name": "ferry", "gtfs": "`+gtfs+`"},
+			{"name": "lirr", "feeds": ["http://redmaple.tree/lirr"], "api_key": "secret"},
+			{"name": "aqi", "gtfs": "`+gtfs+`", "feeds": ["http://redmaple.tree/aqi"]}
+		]
+	}`)
+	_, err = redmaple.ReadConfig(filename)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{"subway: name is already used", "ferry: at least one feed", "api_key_header", "lirr: gtfs is required", "aqi: name is already used"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestNewServerTransitStops(t *testing.T) {
+	gtfs := writeFerryGTFS(t)
+	config := newTestConfig()
+	config.Transit = []redmaple.TransitConfig{
+		{Name: "ferry", GTFS: gtfs, Feeds: []string{"http://redmaple.tree/ferry"}, Stops: []redmaple.TransitStopConfig{{ID: "99"}, {ID: "20", Routes: []string{"XX"}}}},
+		{Name: "lirr", GTFS: "missing.zip", Feeds: []string{"http://redmaple.tree/lirr"}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	_, err := redmaple.NewServer(config)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	for _, want := range []string{`ferry: unknown stop "99"`, `unknown route "XX"`, "lirr: gtfs"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestTransitTile(t *testing.T) {
+	now := time.Now()
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{{
+			Id: proto.String("ER1"),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{TripId: proto.String("ER1"), RouteId: proto.String("ER")},
+				StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{{
+					StopId:    proto.String("87"),
+					Departure: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(now.Add(7*time.Minute + 30*time.Second).Unix())},
+				}},
+			},
+		}},
+	}
+	apiKeys := make(chan string, 1)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		select {
+		case apiKeys <- r.Header.Get("apikey"):
+		default:
+		}
+		body, _ := proto.Marshal(feed)
+		w.Write(body)
+	}))
+	defer feedServer.Close()
+
+	config := newTestConfig()
+	config.Transit = []redmaple.TransitConfig{{
+		Name:         "ferry",
+		GTFS:         writeFerryGTFS(t),
+		Feeds:        []string{feedServer.URL},
+		APIKeyHeader: "apikey",
+		APIKey:       "secret",
+		Stops:        []redmaple.TransitStopConfig{{ID: "87"}},
+	}, {
+		Name:  "closed",
+		GTFS:  writeFerryGTFS(t),
+		Feeds: []string{feedServer.URL + "/missing"},
+		Stops: []redmaple.TransitStopConfig{{ID: "20"}},
+	}}
+	server, err := redmaple.NewServer(config)
+	if err != nil {
+		t.Fatalf("NewServer error: %v", err)
+	}
+	mux := http.NewServeMux()
+	server.LoadRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ferry", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	data := api.TransitPartial{}
+	if err := json.NewDecoder(rec.Body).Decode(&data); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if data.Agency != "ferry" || len(data.Stops) != 1 {
+		t.Fatalf("unexpected tile data: %+v", data)
+	}
+	got := data.Stops[0]
+	if got.StopName != "Wall St/Pier 11" || got.Route != "ER" || got.RouteColor != "00839C" || got.Headsign != "Long Island City" || got.NextTripIn != 7 {
+		t.Errorf("unexpected stop: %+v", got)
+	}
+	if key := <-apiKeys; key != "secret" {
+		t.Errorf("expected the API key header, got %q", key)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x/ferry", nil))
+	if !strings.Contains(rec.Body.String(), "Long Island City") {
+		t.Errorf("expected the rendered tile to show the headsign, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/x/closed", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "DUMBO/Fulton Ferry") || !strings.Contains(rec.Body.String(), "unavailable") {
+		t.Errorf("expected the failing stop to be shown as unavailable, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSummarizeTransitTrips(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	eastRiver := transit.Route{ID: "ER", ShortName: "ER", Color: "00839C"}
+	southBrooklyn := transit.Route{ID: "SB", ShortName: "SB"}
+	updates := []*transit.StopUpdate{
+		{Route: eastRiver, Headsign: "Long Island City", Arrival: now.Unix() - 60},
+		{Route: southBrooklyn, Headsign: "Bay Ridge", Arrival: now.Unix() + 120},
+		{Route: eastRiver, Headsign: "Long Island City", Arrival: now.Unix() + 300, Delay: 180},
+		{Route: eastRiver, Headsign: "Long Island City", Arrival: now.Unix() + 1500},
+	}
+
+	got := redmaple.SummarizeTransitTrips(redmaple.TransitStopConfig{ID: "87", Label: "Pier 11", Routes: []string{"ER"}}, updates, now)
+	if !got.HasTrips || got.NextTripIn != 5 || got.Route != "ER" || got.Delay != 3 {
+		t.Errorf("unexpected next trip: %+v", got)
+	}
+	if got.StopName != "Pier 11" {
+		t.Errorf("expected the label as the stop name, got %q", got.StopName)
+	}
+	if len(got.FurtherTrips) != 1 || got.FurtherTrips[0] != 25 {
+		t.Errorf("expected further trips [25], got %v", got.FurtherTrips)
+	}
+
+	got = redmaple.SummarizeTransitTrips(redmaple.TransitStopConfig{ID: "87"}, updates, now)
+	if got.Route != "SB" || got.Headsign != "Bay Ridge" || got.NextTripIn != 2 {
+		t.Errorf("expected the South Brooklyn trip first without a route filter, got %+v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package redmaple
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"math"
@@ -9,21 +10,33 @@ import (
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	fallback "github.com/mpoegel/red-maple/pkg/fallback"
+	weather "github.com/mpoegel/red-maple/pkg/weather"
 )
 
 const (
 	CentimetersToInches = 0.393701
 )
 
-func (s *Server) HandleWeather(w http.ResponseWriter, r *http.Request) {
-	weatherData, err := s.weatherCli.GetWeather(r.Context())
+// getWeather returns the weather, falling back to the last known good data if
+// the API is failing.
+func (s *Server) getWeather(ctx context.Context) (*weather.WeatherData, api.Freshness, error) {
+	data, freshness, err := fallback.Fetch(ctx, s.fallback, "weather", "weather@"+s.config.WeatherLocation, s.weatherCli.GetWeather)
+	return data, freshness.In(s.tz), err
+}
+
+func (s *Server) getPollution(ctx context.Context) (*weather.PollutionData, api.Freshness, error) {
+	data, freshness, err := fallback.Fetch(ctx, s.fallback, "weather", "pollution@"+s.config.WeatherLocation, s.weatherCli.GetPollution)
+	return data, freshness.In(s.tz), err
+}
+
+func (s *Server) fetchWeather(r *http.Request) (any, error) {
+	weatherData, freshness, err := s.getWeather(r.Context())
 	if err != nil {
-		slog.Error("failed to get weather data", "err", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("weather data: %w", err)
 	}
 
-	partialData := api.WeatherPartial{}
+	partialData := api.WeatherPartial{Freshness: freshness}
 	partialData.CurrentWeatherIcon = weatherData.Current.Description[0].ID
 	partialData.TodayHighTemp = int(weatherData.Daily[0].Temperature.Max)
 	partialData.TodayLowTemp = int(weatherData.Daily[0].Temperature.Min)
@@ -49,15 +62,13 @@ func (s *Server) HandleWeather(w http.ResponseWriter, r *http.Request) {
 	}
 	slog.Debug("prepared weather partial", "data", partialData)
 
-	s.executeTemplate(w, "Forecast", partialData)
+	return partialData, nil
 }
 
-func (s *Server) HandleSunrise(w http.ResponseWriter, r *http.Request) {
-	weatherData, err := s.weatherCli.GetWeather(r.Context())
+func (s *Server) fetchSunrise(r *http.Request) (any, error) {
+	weatherData, freshness, err := s.getWeather(r.Context())
 	if err != nil {
-		slog.Error("failed to get weather data", "err", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("weather data: %w", err)
 	}
 
 	sunriseTime := time.Unix(int64(weatherData.Current.Sunrise), 0).In(s.tz)
@@ -68,12 +79,11 @@ func (s *Server) HandleSunrise(w http.ResponseWriter, r *http.Request) {
 		MoonPhaseIcon: MoonPhaseToIcon(int(weatherData.Daily[0].MoonPhase * 28)),
 	}
 
-	pollutionData, err := s.weatherCli.GetPollution(r.Context())
+	pollutionData, pollutionFreshness, err := s.getPollution(r.Context())
 	if err != nil {
-		slog.Error("failed to get pollution data", "err", err)
-		w.WriteHeader(http.StatusServiceUnavailable)
-		return
+		return nil, fmt.Errorf("pollution data: %w", err)
 	}
+	partialData.Freshness = freshness.Merge(pollutionFreshness)
 
 	co := pollutionData.Data[0].Components.CarbonMonoxide
 	no2 := pollutionData.Data[0].Components.NitrogenDioxide
@@ -103,7 +113,7 @@ func (s *Server) HandleSunrise(w http.ResponseWriter, r *http.Request) {
 	}
 	slog.Debug("prepared sunrise partial", "data", partialData)
 
-	s.executeTemplate(w, "Sunrise", partialData)
+	return partialData, nil
 }
 
 func (s *Server) HandleWeatherFull(w http.ResponseWriter, r *http.Request) {
@@ -115,7 +125,7 @@ func (s *Server) HandleSunriseFull(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) HandleSundial(w http.ResponseWriter, r *http.Request) {
-	weatherData, err := s.weatherCli.GetWeather(r.Context())
+	weatherData, freshness, err := s.getWeather(r.Context())
 	if err != nil {
 		slog.Error("failed to get weather data", "err", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -129,7 +139,7 @@ func (s *Server) HandleSundial(w http.ResponseWriter, r *http.Request) {
 	yesterdaySunset := sunset.AddDate(0, 0, -1)
 	now := time.Now()
 
-	data := api.SundialPartial{}
+	data := api.SundialPartial{Freshness: freshness}
 	if now.After(sunrise) && now.Before(sunset) {
 		// sun is up
 		// progress / daylight = x / 180
@@ -157,11 +167,11 @@ func (s *Server) HandleSundial(w http.ResponseWriter, r *http.Request) {
 		data.Color = "#FF5A36"
 	}
 
-	s.executeTemplate(w, "Sundial", data)
+	s.render(w, r, "Sundial", data)
 }
 
 func (s *Server) HandleForecastFull(w http.ResponseWriter, r *http.Request) {
-	weatherData, err := s.weatherCli.GetWeather(r.Context())
+	weatherData, freshness, err := s.getWeather(r.Context())
 	if err != nil {
 		slog.Error("failed to get weather data", "err", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -169,9 +179,10 @@ func (s *Server) HandleForecastFull(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := api.WeatherFull{
-		Hourly: []api.HourlyWeather{},
-		Daily:  []api.DailyWeather{},
-		Alerts: []api.WeatherAlert{},
+		Freshness: freshness,
+		Hourly:    []api.HourlyWeather{},
+		Daily:     []api.DailyWeather{},
+		Alerts:    []api.WeatherAlert{},
 	}
 
 	for i, hour := range weatherData.Hourly {
@@ -244,11 +255,11 @@ func (s *Server) HandleForecastFull(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	s.executeTemplate(w, "FullForecast", data)
+	s.render(w, r, "FullForecast", data)
 }
 
 func (s *Server) HandleAqiPartial(w http.ResponseWriter, r *http.Request) {
-	pollutionData, err := s.weatherCli.GetPollution(r.Context())
+	pollutionData, pollutionFreshness, err := s.getPollution(r.Context())
 	if err != nil {
 		slog.Error("failed to get weather data", "err", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -262,6 +273,7 @@ func (s *Server) HandleAqiPartial(w http.ResponseWriter, r *http.Request) {
 	pm10 := pollutionData.Data[0].Components.Particulates10
 
 	data := api.AqiPartial{
+		Freshness:       pollutionFreshness,
 		CarbonMonoxide:  CalculateAQI(co/1.15/1000, co_con_breakpoints),
 		Ozone:           CalculateAQI(o3/1.96/1000, o3_con_breakpoints),
 		Particulates2_5: CalculateAQI(pm25, pm25_con_breakpoints),
@@ -279,18 +291,19 @@ func (s *Server) HandleAqiPartial(w http.ResponseWriter, r *http.Request) {
 	)
 
 	slog.Info("pollution", "data", data, "raw", pollutionData.Data[0].Components)
-	s.executeTemplate(w, "AQI", data)
+	s.render(w, r, "AQI", data)
 }
 
 func (s *Server) HandleSunrises(w http.ResponseWriter, r *http.Request) {
-	weatherData, err := s.weatherCli.GetWeather(r.Context())
+	weatherData, freshness, err := s.getWeather(r.Context())
 	if err != nil {
 		slog.Error("failed to get weather data", "err", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 	data := api.SunriseForecast{
-		Forecast: []api.SunForecast{},
+		Freshness: freshness,
+		Forecast:  []api.SunForecast{},
 	}
 	for i, day := range weatherData.Daily {
 		sunrise := time.Unix(int64(day.Sunrise), 0).In(s.tz)
@@ -306,7 +319,7 @@ func (s *Server) HandleSunrises(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
-	s.executeTemplate(w, "SunriseForecast", data)
+	s.render(w, r, "SunriseForecast", data)
 }
 
 var (
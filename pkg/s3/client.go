@@ -16,11 +16,19 @@ import (
 	"time"
 
 	api "github.com/mpoegel/red-maple/pkg/api"
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 )
 
 var _ api.DataExporter = (*Client)(nil)
 var _ api.Importer = (*Client)(nil)
 
+var (
+	flushPoints = metrics.NewHistogramVec("redmaple_s3_flush_points",
+		"Number of data points written per flush to S3.", []float64{1, 5, 10, 25, 50, 100, 250, 500})
+	flushDuration = metrics.NewHistogramVec("redmaple_s3_flush_duration_seconds",
+		"Time taken to flush buffered data points to S3.", metrics.DefaultBuckets)
+)
+
 // Client is an S3-based time series data store that stores data in JSON Lines format.
 // It implements both the api.DataExporter and api.Importer interfaces.
 // Data is partitioned by table and hour: {bucket}/{table}/year/month/day/hour.jsonl
@@ -131,6 +139,12 @@ func (c *Client) flush(ctx context.Context) error {
 	c.buffer.flushed = time.Now()
 	c.mu.Unlock()
 
+	start := time.Now()
+	defer func() {
+		flushPoints.Observe(float64(len(points)))
+		flushDuration.Observe(time.Since(start).Seconds())
+	}()
+
 	grouped := make(map[string][]*api.DataPoint)
 	for _, p := range points {
 		key := c.getObjectKey(p.Stamp, p.Table)
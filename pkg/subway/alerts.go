@@ -0,0 +1,153 @@
+package subway
+
+import (
+	"slices"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+)
+
+// ServiceAlert is a GTFS-realtime alert about disrupted service.
+type ServiceAlert struct {
+	ID          string
+	Header      string
+	Description string
+	// ActivePeriods are the times the alert is in effect. An alert without
+	// any is always in effect.
+	ActivePeriods    []ActivePeriod
+	Effect           gtfsrt.Alert_Effect
+	Cause            gtfsrt.Alert_Cause
+	InformedEntities []InformedEntity
+}
+
+// ActivePeriod is a time range of an alert. A zero Start or End leaves that
+// side of the range open.
+type ActivePeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// InformedEntity is a route, stop or both that an alert is about. An entity
+// with neither applies to the whole system.
+type InformedEntity struct {
+	RouteID string
+	Route   TrainLine
+	StopID  string
+}
+
+// ParseAlert converts a feed entity's alert into a ServiceAlert.
+func ParseAlert(id string, alert *gtfsrt.Alert) ServiceAlert {
+	res := ServiceAlert{
+		ID:          id,
+		Header:      translation(alert.GetHeaderText()),
+		Description: translation(alert.GetDescriptionText()),
+		Effect:      alert.GetEffect(),
+		Cause:       alert.GetCause(),
+	}
+	for _, period := range alert.GetActivePeriod() {
+		ap := ActivePeriod{}
+		if period.Start != nil {
+			ap.Start = time.Unix(int64(period.GetStart()), 0)
+		}
+		if period.End != nil {
+			ap.End = time.Unix(int64(period.GetEnd()), 0)
+		}
+		res.ActivePeriods = append(res.ActivePeriods, ap)
+	}
+	for _, entity := range alert.GetInformedEntity() {
+		routeID := entity.GetRouteId()
+		if routeID == "" {
+			routeID = entity.GetTrip().GetRouteId()
+		}
+		ie := InformedEntity{RouteID: routeID, StopID: entity.GetStopId()}
+		if routeID != "" {
+			ie.Route = RouteToLine(routeID)
+		}
+		res.InformedEntities = append(res.InformedEntities, ie)
+	}
+	return res
+}
+
+// translation picks the English plain text of s, or the first translation if
+// there is no English one.
+func translation(s *gtfsrt.TranslatedString) string {
+	translations := s.GetTranslation()
+	for _, t := range translations {
+		if lang := t.GetLanguage(); lang == "" || lang == "en" {
+			return t.GetText()
+		}
+	}
+	if len(translations) > 0 {
+		return translations[0].GetText()
+	}
+	return ""
+}
+
+// IsActive reports whether the alert is in effect at t.
+func (a ServiceAlert) IsActive(t time.Time) bool {
+	if len(a.ActivePeriods) == 0 {
+		return true
+	}
+	for _, period := range a.ActivePeriods {
+		if (period.Start.IsZero() || !t.Before(period.Start)) && (period.End.IsZero() || t.Before(period.End)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Affects reports whether the alert is about any of routes at stopID. Stops
+// match their parent station and vice versa, so an alert about 635 affects
+// 635N. An empty stopID asks about the routes anywhere, which leaves out
+// alerts that only name a stop.
+func (a ServiceAlert) Affects(routes []TrainLine, stopID string) bool {
+	// alerts without informed entities are system-wide
+	if len(a.InformedEntities) == 0 {
+		return true
+	}
+	for _, entity := range a.InformedEntities {
+		switch {
+		case entity.RouteID == "" && entity.StopID == "":
+			return true
+		case entity.RouteID == "":
+			if stopID != "" && sameStation(entity.StopID, stopID) {
+				return true
+			}
+		case slices.Contains(routes, entity.Route):
+			if entity.StopID == "" || stopID == "" || sameStation(entity.StopID, stopID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Routes returns the lines the alert is about.
+func (a ServiceAlert) Routes() []TrainLine {
+	routes := []TrainLine{}
+	for _, entity := range a.InformedEntities {
+		if entity.RouteID != "" && entity.Route != UnknownTrain && !slices.Contains(routes, entity.Route) {
+			routes = append(routes, entity.Route)
+		}
+	}
+	slices.Sort(routes)
+	return routes
+}
+
+// sameStation reports whether a and b are the same stop, or one is a platform
+// of the other.
+func sameStation(a, b string) bool {
+	return a == b || parentStation(a) == b || parentStation(b) == a
+}
+
+// FilterAlerts returns the alerts that are active at t and affect any of
+// routes at stopID.
+func FilterAlerts(alerts []ServiceAlert, routes []TrainLine, stopID string, t time.Time) []ServiceAlert {
+	var res []ServiceAlert
+	for _, alert := range alerts {
+		if alert.IsActive(t) && alert.Affects(routes, stopID) {
+			res = append(res, alert)
+		}
+	}
+	return res
+}
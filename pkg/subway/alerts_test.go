@@ -0,0 +1,152 @@
+package subway_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
+)
+
+func translated(texts ...string) *gtfsrt.TranslatedString {
+	ts := &gtfsrt.TranslatedString{}
+	for i := 0; i < len(texts); i += 2 {
+		ts.Translation = append(ts.Translation, &gtfsrt.TranslatedString_Translation{
+			Language: proto.String(texts[i]),
+			Text:     proto.String(texts[i+1]),
+		})
+	}
+	return ts
+}
+
+func alertEntity(id string, start, end uint64, selectors ...*gtfsrt.EntitySelector) *gtfsrt.FeedEntity {
+	return &gtfsrt.FeedEntity{
+		Id: proto.String(id),
+		Alert: &gtfsrt.Alert{
+			ActivePeriod:    []*gtfsrt.TimeRange{{Start: proto.Uint64(start), End: proto.Uint64(end)}},
+			InformedEntity:  selectors,
+			Effect:          gtfsrt.Alert_SIGNIFICANT_DELAYS.Enum(),
+			HeaderText:      translated("en-html", "<p>Delays</p>", "en", "Delays on the "+id),
+			DescriptionText: translated("en", "Trains are running with delays."),
+		},
+	}
+}
+
+func TestParseAlert(t *testing.T) {
+	entity := alertEntity("L", 1000, 2000, &gtfsrt.EntitySelector{RouteId: proto.String("L")},
+		&gtfsrt.EntitySelector{Trip: &gtfsrt.TripDescriptor{RouteId: proto.String("6X")}, StopId: proto.String("635N")})
+
+	alert := subway.ParseAlert(entity.GetId(), entity.Alert)
+	if alert.Header != "Delays on the L" {
+		t.Errorf("expected the plain English header, got %q", alert.Header)
+	}
+	if alert.Description != "Trains are running with delays." {
+		t.Errorf("unexpected description %q", alert.Description)
+	}
+	if alert.Effect != gtfsrt.Alert_SIGNIFICANT_DELAYS || alert.Cause != gtfsrt.Alert_UNKNOWN_CAUSE {
+		t.Errorf("unexpected effect %v and cause %v", alert.Effect, alert.Cause)
+	}
+	if len(alert.ActivePeriods) != 1 || alert.ActivePeriods[0].Start.Unix() != 1000 || alert.ActivePeriods[0].End.Unix() != 2000 {
+		t.Errorf("unexpected active periods %v", alert.ActivePeriods)
+	}
+	if !slices.Equal(alert.Routes(), []subway.TrainLine{subway.SixTrain, subway.LTrain}) {
+		t.Errorf("expected the 6 and L, got %v", alert.Routes())
+	}
+}
+
+func TestServiceAlert_IsActive(t *testing.T) {
+	alert := subway.ServiceAlert{ActivePeriods: []subway.ActivePeriod{
+		{Start: time.Unix(1000, 0), End: time.Unix(2000, 0)},
+		{Start: time.Unix(3000, 0)},
+	}}
+	tests := map[int64]bool{999: false, 1000: true, 1999: true, 2000: false, 5000: true}
+	for at, want := range tests {
+		if got := alert.IsActive(time.Unix(at, 0)); got != want {
+			t.Errorf("IsActive(%d) = %v, want %v", at, got, want)
+		}
+	}
+	if !(subway.ServiceAlert{}).IsActive(time.Now()) {
+		t.Error("expected an alert without active periods to always be active")
+	}
+}
+
+func TestServiceAlert_Affects(t *testing.T) {
+	routeOnly := subway.ServiceAlert{InformedEntities: []subway.InformedEntity{{RouteID: "G", Route: subway.GTrain}}}
+	stopOnly := subway.ServiceAlert{InformedEntities: []subway.InformedEntity{{StopID: "635"}}}
+	both := subway.ServiceAlert{InformedEntities: []subway.InformedEntity{{RouteID: "L", Route: subway.LTrain, StopID: "L03S"}}}
+	systemWide := subway.ServiceAlert{}
+	// station IDs may end in N or S themselves
+	stationS := subway.ServiceAlert{InformedEntities: []subway.InformedEntity{{StopID: "A0S"}}}
+	stationA0 := subway.ServiceAlert{InformedEntities: []subway.InformedEntity{{StopID: "A0"}}}
+
+	tests := []struct {
+		name   string
+		alert  subway.ServiceAlert
+		routes []subway.TrainLine
+		stopID string
+		want   bool
+	}{
+		{"other route", routeOnly, []subway.TrainLine{subway.LTrain}, "L03S", false},
+		{"same route", routeOnly, []subway.TrainLine{subway.GTrain, subway.LTrain}, "L03S", true},
+		{"platform of station", stopOnly, []subway.TrainLine{subway.SixTrain}, "635N", true},
+		{"other station", stopOnly, []subway.TrainLine{subway.SixTrain}, "636N", false},
+		{"stop without stop ID", stopOnly, []subway.TrainLine{subway.SixTrain}, "", false},
+		{"route at stop", both, []subway.TrainLine{subway.LTrain}, "L03S", true},
+		{"route at other direction", both, []subway.TrainLine{subway.LTrain}, "L03N", false},
+		{"route at parent station", both, []subway.TrainLine{subway.LTrain}, "L03", true},
+		{"route anywhere", both, []subway.TrainLine{subway.LTrain}, "", true},
+		{"system-wide", systemWide, []subway.TrainLine{subway.LTrain}, "L03S", true},
+		{"platform of station ending in S", stationS, []subway.TrainLine{subway.ATrain}, "A0SN", true},
+		{"platform of station with a longer ID", stationA0, []subway.TrainLine{subway.ATrain}, "A0SN", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.alert.Affects(tt.routes, tt.stopID); got != tt.want {
+				t.Errorf("Affects(%v, %q) = %v, want %v", tt.routes, tt.stopID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTripsAtStop_FiltersAlerts(t *testing.T) {
+	feed := tripFeed("L", 1000, "L03N")
+	feed.Entity = append(feed.Entity,
+		alertEntity("L", 1000, 2000, &gtfsrt.EntitySelector{RouteId: proto.String("L")}),
+		alertEntity("G", 1000, 2000, &gtfsrt.EntitySelector{RouteId: proto.String("G")}),
+		alertEntity("L-expired", 100, 200, &gtfsrt.EntitySelector{RouteId: proto.String("L")}),
+	)
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{"http://redmaple.tree/feed": feed},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithClock(func() time.Time { return time.Unix(1500, 0) }),
+		subway.WithFeedURLs(map[subway.TrainLine]string{
+			subway.LTrain: "http://redmaple.tree/feed",
+			subway.GTrain: "http://redmaple.tree/feed",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	_, alerts, err := client.GetTripsAtStop(t.Context(), "L03N")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != "L" {
+		t.Errorf("expected only the active L alert, got %v", alerts)
+	}
+
+	_, alerts, err = client.GetTrains(t.Context(), subway.GTrain)
+	if err != nil {
+		t.Fatalf("GetTrains error: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].ID != "G" {
+		t.Errorf("expected only the G alert, got %v", alerts)
+	}
+}
@@ -0,0 +1,184 @@
+package subway
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gtfsDateLayout  = "20060102"
+	defaultTimezone = "America/New_York"
+)
+
+// service is a GTFS service_id, the days that a set of trips run on.
+type service struct {
+	// weekdays are indexed by time.Weekday.
+	weekdays [7]bool
+	// start and end are the first and last dates of the calendar.txt row, if
+	// there is one.
+	start, end string
+	// exceptions are the dates that calendar_dates.txt adds (true) or
+	// removes (false).
+	exceptions map[string]bool
+}
+
+type scheduledTrip struct {
+	tripID    string
+	serviceID string
+	stopTimes []scheduledStop
+	pattern   *Pattern
+}
+
+type scheduledStop struct {
+	stopID string
+	// arrival is in seconds after the start of the service day, and can be
+	// more than a day for trips running past midnight.
+	arrival int
+}
+
+// loadCalendar reads mta/calendar.txt and mta/calendar_dates.txt from fsys,
+// keyed by service ID. Either file may be missing.
+func loadCalendar(fsys fs.FS) (map[string]*service, error) {
+	services := map[string]*service{}
+	get := func(serviceID string) *service {
+		svc, ok := services[serviceID]
+		if !ok {
+			svc = &service{exceptions: map[string]bool{}}
+			services[serviceID] = svc
+		}
+		return svc
+	}
+
+	columns := []string{"service_id", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday", "start_date", "end_date"}
+	err := readCSV(fsys, "mta/calendar.txt", columns, func(row []string) error {
+		svc := get(row[0])
+		for i, runs := range row[1:8] {
+			svc.weekdays[(i+1)%7] = runs == "1"
+		}
+		svc.start, svc.end = row[8], row[9]
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	err = readCSV(fsys, "mta/calendar_dates.txt", []string{"service_id", "date", "exception_type"}, func(row []string) error {
+		switch row[2] {
+		case "1":
+			get(row[0]).exceptions[row[1]] = true
+		case "2":
+			get(row[0]).exceptions[row[1]] = false
+		default:
+			return fmt.Errorf("mta/calendar_dates.txt: service %s: invalid exception_type %q", row[0], row[2])
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return services, nil
+}
+
+// loadAgencyLocation returns the timezone of the schedule from mta/agency.txt,
+// or New York's if it is not set.
+func loadAgencyLocation(fsys fs.FS) *time.Location {
+	name := defaultTimezone
+	err := readCSV(fsys, "mta/agency.txt", []string{"agency_timezone"}, func(row []string) error {
+		if row[0] != "" {
+			name = row[0]
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("failed to read agency timezone", "err", err)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		slog.Warn("unknown agency timezone, using local time", "timezone", name, "err", err)
+		return time.Local
+	}
+	return loc
+}
+
+// parseGTFSTime parses a stop time such as 08:05:00 or 25:10:00 into seconds
+// after the start of the service day.
+func parseGTFSTime(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	seconds := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		seconds = seconds*60 + n
+	}
+	return seconds, nil
+}
+
+// runsOn reports whether the trips of serviceID run on date. Without a
+// calendar, every service runs every day.
+func (s *Schedule) runsOn(serviceID, date string) bool {
+	if len(s.services) == 0 {
+		return true
+	}
+	svc, ok := s.services[serviceID]
+	if !ok {
+		return false
+	}
+	if runs, ok := svc.exceptions[date]; ok {
+		return runs
+	}
+	if svc.start == "" || date < svc.start || date > svc.end {
+		return false
+	}
+	day, err := time.Parse(gtfsDateLayout, date)
+	if err != nil {
+		return false
+	}
+	return svc.weekdays[day.Weekday()]
+}
+
+// ServiceDate returns the date of t in the schedule's timezone, in the
+// YYYYMMDD form of the realtime trip start dates.
+func (s *Schedule) ServiceDate(t time.Time) string {
+	if s == nil {
+		return t.Format(gtfsDateLayout)
+	}
+	return t.In(s.loc).Format(gtfsDateLayout)
+}
+
+// ScheduledArrival returns when the trip with the given realtime trip ID,
+// starting on startDate, is scheduled to arrive at stopID. It is false if the
+// trip does not run that day or does not stop there.
+func (s *Schedule) ScheduledArrival(tripID, startDate, stopID string) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(gtfsDateLayout, startDate, s.loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for _, trip := range s.trips[realtimeTripID(tripID)] {
+		if !s.runsOn(trip.serviceID, startDate) {
+			continue
+		}
+		for _, stop := range trip.stopTimes {
+			if stop.stopID == stopID {
+				// service days start at noon minus 12 hours, which is not
+				// midnight on the days the clocks change
+				noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, s.loc)
+				return noon.Add(-12 * time.Hour).Add(time.Duration(stop.arrival) * time.Second), true
+			}
+		}
+		return time.Time{}, false
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,189 @@
+package subway_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// calendarFS has the same A trip on weekdays and on Saturdays, with the
+// Saturday schedule running on Thanksgiving instead of the weekday one.
+var calendarFS = fstest.MapFS{
+	"mta/stops.txt": &fstest.MapFile{Data: []byte("stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+		"A02,Inwood-207 St,40.868072,-73.919899,1,\n" +
+		"A02S,Inwood-207 St,40.868072,-73.919899,0,A02\n" +
+		"A03,Dyckman St,40.865491,-73.927271,1,\n" +
+		"A03S,Dyckman St,40.865491,-73.927271,0,A03\n")},
+	"mta/agency.txt": &fstest.MapFile{Data: []byte("agency_id,agency_name,agency_timezone\n" +
+		"MTA NYCT,MTA New York City Transit,America/New_York\n")},
+	"mta/routes.txt": &fstest.MapFile{Data: []byte("agency_id,route_id,route_short_name\nMTA NYCT,A,A\n")},
+	"mta/trips.txt": &fstest.MapFile{Data: []byte("route_id,trip_id,service_id\n" +
+		"A,ASP25GEN-A089-Weekday-00_000600_A..S03R,Weekday\n" +
+		"A,ASP25GEN-A089-Saturday-00_000600_A..S03R,Saturday\n" +
+		"A,ASP25GEN-A089-Weekday-00_144000_A..S03R,Weekday\n")},
+	"mta/stop_times.txt": &fstest.MapFile{Data: []byte("trip_id,stop_id,arrival_time,departure_time,stop_sequence\n" +
+		"ASP25GEN-A089-Weekday-00_000600_A..S03R,A02S,00:06:00,00:06:00,1\n" +
+		"ASP25GEN-A089-Weekday-00_000600_A..S03R,A03S,00:08:00,00:08:00,2\n" +
+		"ASP25GEN-A089-Saturday-00_000600_A..S03R,A02S,00:06:00,00:06:00,1\n" +
+		"ASP25GEN-A089-Saturday-00_000600_A..S03R,A03S,00:09:30,00:09:30,2\n" +
+		"ASP25GEN-A089-Weekday-00_144000_A..S03R,A02S,24:24:00,24:24:00,1\n" +
+		"ASP25GEN-A089-Weekday-00_144000_A..S03R,A03S,24:30:00,24:30:00,2\n")},
+	"mta/calendar.txt": &fstest.MapFile{Data: []byte("service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\n" +
+		"Weekday,1,1,1,1,1,0,0,20260101,20261231\n" +
+		"Saturday,0,0,0,0,0,1,0,20260101,20261231\n")},
+	"mta/calendar_dates.txt": &fstest.MapFile{Data: []byte("service_id,date,exception_type\n" +
+		"Weekday,20261126,2\n" +
+		"Saturday,20261126,1\n")},
+}
+
+func TestScheduledArrival(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	schedule, err := subway.LoadSchedule(calendarFS)
+	if err != nil {
+		t.Fatalf("LoadSchedule error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		tripID    string
+		startDate string
+		want      time.Time
+		ok        bool
+	}{
+		{"weekday", "000600_A..S03R", "20261015", time.Date(2026, 10, 15, 0, 8, 0, 0, loc), true},
+		{"saturday", "000600_A..S03R", "20261017", time.Date(2026, 10, 17, 0, 9, 30, 0, loc), true},
+		{"no service on sundays", "000600_A..S03R", "20261018", time.Time{}, false},
+		{"holiday runs the saturday schedule", "000600_A..S03R", "20261126", time.Date(2026, 11, 26, 0, 9, 30, 0, loc), true},
+		{"after the calendar ends", "000600_A..S03R", "20270104", time.Time{}, false},
+		{"past midnight", "144000_A..S03R", "20261015", time.Date(2026, 10, 16, 0, 30, 0, 0, loc), true},
+		{"unknown trip", "999999_A..S03R", "20261015", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := schedule.ScheduledArrival(tt.tripID, tt.startDate, "A03S")
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("ScheduledArrival = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestScheduledArrival_WithoutCalendar(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, file := range calendarFS {
+		if name != "mta/calendar.txt" && name != "mta/calendar_dates.txt" {
+			fsys[name] = file
+		}
+	}
+	schedule, err := subway.LoadSchedule(fsys)
+	if err != nil {
+		t.Fatalf("LoadSchedule error: %v", err)
+	}
+	// every service runs every day, so the first trip by static trip ID is used
+	got, ok := schedule.ScheduledArrival("000600_A..S03R", "20261018", "A03S")
+	if !ok {
+		t.Fatal("expected a scheduled arrival without a calendar")
+	}
+	if got.Hour() != 0 || got.Minute() != 9 {
+		t.Errorf("expected the Saturday trip, got %v", got)
+	}
+}
+
+func TestTripPattern_Service(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, file := range calendarFS {
+		fsys[name] = file
+	}
+	// the Saturday trip only stops at Inwood, so its pattern differs from the
+	// weekday one
+	fsys["mta/stop_times.txt"] = &fstest.MapFile{Data: []byte("trip_id,stop_id,arrival_time,departure_time,stop_sequence\n" +
+		"ASP25GEN-A089-Weekday-00_000600_A..S03R,A02S,00:06:00,00:06:00,1\n" +
+		"ASP25GEN-A089-Weekday-00_000600_A..S03R,A03S,00:08:00,00:08:00,2\n" +
+		"ASP25GEN-A089-Saturday-00_000600_A..S03R,A02S,00:06:00,00:06:00,1\n")}
+
+	// the pattern must not depend on the order the trips are loaded in
+	for range 10 {
+		schedule, err := subway.LoadSchedule(fsys)
+		if err != nil {
+			t.Fatalf("LoadSchedule error: %v", err)
+		}
+		tests := map[string][]string{
+			"20261015": {"A02", "A03"},
+			"20261017": {"A02"},
+			// neither runs, so the first by static trip ID is used
+			"20270104": {"A02"},
+		}
+		for date, want := range tests {
+			got := schedule.TripPattern("000600_A..S03R", date)
+			if got == nil || !slices.Equal(got.Stations, want) {
+				t.Errorf("TripPattern on %s = %v, want %v", date, got, want)
+			}
+		}
+	}
+}
+
+func TestGetTripsAtStop_Delay(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	scheduled := time.Date(2026, 10, 15, 0, 8, 0, 0, loc)
+	trip := func(tripID, startDate string, arrival time.Time) *gtfsrt.FeedEntity {
+		return &gtfsrt.FeedEntity{
+			Id: proto.String(tripID),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{
+					TripId:    proto.String(tripID),
+					RouteId:   proto.String("A"),
+					StartDate: proto.String(startDate),
+				},
+				StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{{
+					StopId:  proto.String("A03S"),
+					Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival.Unix())},
+				}},
+			},
+		}
+	}
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			trip("000600_A..S03R", "20261015", scheduled.Add(6*time.Minute)),
+			// trips added to the realtime feed are not in the schedule
+			trip("000800_A..S03R", "20261015", scheduled.Add(8*time.Minute)),
+		},
+	}
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{aFeedURL: feed}, calls: map[string]int{}}
+	client, err := subway.NewClientFromFS(calendarFS,
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.ATrain: aFeedURL}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	updates, _, err := client.GetTripsAtStop(t.Context(), "A03S")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	if updates[0].ScheduledTime != scheduled.Unix() {
+		t.Errorf("expected scheduled time %d, got %d", scheduled.Unix(), updates[0].ScheduledTime)
+	}
+	if updates[0].Delay != 360 {
+		t.Errorf("expected a delay of 360s, got %d", updates[0].Delay)
+	}
+	if updates[1].ScheduledTime != 0 || updates[1].Delay != 0 {
+		t.Errorf("expected no schedule for an added trip, got %d, %d", updates[1].ScheduledTime, updates[1].Delay)
+	}
+}
@@ -2,21 +2,25 @@ package subway
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
-	"path"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	proto "google.golang.org/protobuf/proto"
+	api "github.com/mpoegel/red-maple/pkg/api"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 )
 
-//go:generate protoc --proto_path=../../vendored/mta --go_opt=paths=source_relative --go_out=. ../../vendored/mta/nyct-subway.proto ../../vendored/mta/gtfs-realtime.proto
+//go:generate protoc --proto_path=../../vendored/mta --go_opt=paths=source_relative --go_out=. ../../vendored/mta/nyct-subway.proto
 
 const (
 	RootStationType string = "1"
@@ -45,21 +49,36 @@ var feedUrls = map[TrainLine]string{
 	FiveTrain:  "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
 	SixTrain:   "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
 	SevenTrain: "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
-	// TODO S train has 3 different feeds for the different segments
-	STrain: "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
+	// each shuttle is in the feed of the lines it connects to
+	GSTrain: "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs",
+	FSTrain: "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-bdfm",
+	HTrain:  "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
 }
 
 type Client interface {
-	GetFeed(ctx context.Context, line TrainLine) (*FeedMessage, error)
-	GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []*Alert, error)
-	GetTrains(ctx context.Context, line TrainLine) (trains []TrainUpdate, alerts []*Alert, err error)
+	GetFeed(ctx context.Context, line TrainLine) (*gtfsrt.FeedMessage, error)
+	GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []ServiceAlert, error)
+	GetTrains(ctx context.Context, line TrainLine) (trains []TrainUpdate, alerts []ServiceAlert, err error)
 	GetStopsOnLine(ctx context.Context, line TrainLine) (stops []SubwayStop, err error)
+	GetLineDiagram(ctx context.Context, line TrainLine) ([]LineSection, error)
+	LinesAtStop(stopID string) []TrainLine
+	SearchStations(query string, limit int) []Station
+	NearestStations(lat, lon float64, limit int) []Station
+	GetHeadwayProvider(stopID string, routes []TrainLine) api.ProviderFunc
+	GetHeadwayHistory(ctx context.Context, importer api.Importer, stopID string, routes []TrainLine, duration time.Duration) ([]HeadwayRecord, error)
 }
 
 type ClientImpl struct {
 	httpClient *http.Client
 	stopMap    map[string]SubwayStop
+	stopRoutes map[string][]TrainLine
+	schedule   *Schedule
 	feedURLs   map[TrainLine]string
+	feeds      *gtfsrt.FeedManager
+	now        func() time.Time
+
+	mu       sync.Mutex
+	trackers map[string]*headwayTracker
 }
 
 var _ Client = (*ClientImpl)(nil)
@@ -78,16 +97,75 @@ func WithStopMap(stopMap map[string]SubwayStop) Option {
 	}
 }
 
+// WithStopRoutes sets the lines serving each stop, as loaded by LoadStopRoutes.
+func WithStopRoutes(stopRoutes map[string][]TrainLine) Option {
+	return func(c *ClientImpl) {
+		c.stopRoutes = stopRoutes
+	}
+}
+
+// WithSchedule sets the static GTFS data, as loaded by LoadSchedule.
+func WithSchedule(schedule *Schedule) Option {
+	return func(c *ClientImpl) {
+		c.schedule = schedule
+		if schedule != nil {
+			c.stopRoutes = schedule.StopRoutes
+		}
+	}
+}
+
 func WithFeedURLs(urls map[TrainLine]string) Option {
 	return func(c *ClientImpl) {
 		c.feedURLs = urls
 	}
 }
 
+// WithFeedManager shares a FeedManager between clients, so that each feed is
+// only polled once.
+func WithFeedManager(feeds *gtfsrt.FeedManager) Option {
+	return func(c *ClientImpl) {
+		c.feeds = feeds
+	}
+}
+
+// WithClock sets the clock used to decide which alerts are active.
+func WithClock(now func() time.Time) Option {
+	return func(c *ClientImpl) {
+		c.now = now
+	}
+}
+
 func NewClient(dataDir string, opts ...Option) (*ClientImpl, error) {
+	return NewClientFromFS(os.DirFS(dataDir), opts...)
+}
+
+// NewClientFromFS creates a client using the mta/stops.txt found in fsys, and
+// the static GTFS routes, trips and stop times next to it if they are present.
+func NewClientFromFS(fsys fs.FS, opts ...Option) (*ClientImpl, error) {
+	stopMap, err := LoadStops(fsys)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := LoadSchedule(fsys)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("static GTFS schedule not found, guessing lines from stop IDs; fetch it with extra/fetch-mta-gtfs.sh", "err", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if schedule != nil {
+		opts = append([]Option{WithSchedule(schedule)}, opts...)
+	}
+	c, _ := NewClientWithOptions(opts...)
+	c.stopMap = stopMap
+	return c, nil
+}
+
+// LoadStops reads mta/stops.txt from fsys, keyed by stop ID.
+func LoadStops(fsys fs.FS) (map[string]SubwayStop, error) {
 	stopMap := map[string]SubwayStop{}
 
-	fp, err := os.Open(path.Join(dataDir, "mta/stops.txt"))
+	fp, err := fsys.Open("mta/stops.txt")
 	if err != nil {
 		return nil, err
 	}
@@ -116,10 +194,7 @@ func NewClient(dataDir string, opts ...Option) (*ClientImpl, error) {
 			AreTrainsStopping: 0,
 		}
 	}
-
-	c, _ := NewClientWithOptions(opts...)
-	c.stopMap = stopMap
-	return c, nil
+	return stopMap, nil
 }
 
 func NewClientWithOptions(opts ...Option) (*ClientImpl, error) {
@@ -127,59 +202,87 @@ func NewClientWithOptions(opts ...Option) (*ClientImpl, error) {
 		httpClient: http.DefaultClient,
 		feedURLs:   feedUrls,
 		stopMap:    map[string]SubwayStop{},
+		now:        time.Now,
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.feeds == nil {
+		c.feeds = gtfsrt.NewFeedManager("subway", c.httpClient)
+	}
 	return c, nil
 }
 
-func (c *ClientImpl) GetFeed(ctx context.Context, line TrainLine) (*FeedMessage, error) {
+func (c *ClientImpl) GetFeed(ctx context.Context, line TrainLine) (*gtfsrt.FeedMessage, error) {
 	slog.Debug("getting subway feed", "line", line)
-	url := c.feedURLs[line]
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+	url, ok := c.feedURLs[line]
+	if !ok {
+		return nil, fmt.Errorf("no feed for line %s", line)
 	}
+	return c.feeds.Get(ctx, url)
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// LinesAtStop returns the lines that stop at stopID, from the static GTFS data
+// if it was loaded and guessed from the stop ID otherwise.
+func (c *ClientImpl) LinesAtStop(stopID string) []TrainLine {
+	if c.stopRoutes != nil {
+		return c.stopRoutes[stopID]
 	}
+	return guessRoutes(stopID)
+}
 
-	defer resp.Body.Close()
-
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("HTTP error: %d", resp.StatusCode)
+// GetTripsAtStop returns the upcoming trips at stopID from every feed serving
+// it, ordered by arrival, and the active alerts about the stop or its lines.
+// Feeds that fail are skipped unless all of them do.
+func (c *ClientImpl) GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []ServiceAlert, error) {
+	urls := []string{}
+	for _, line := range c.LinesAtStop(stopID) {
+		if url, ok := c.feedURLs[line]; ok && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
 	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	if len(urls) == 0 {
+		return nil, nil, fmt.Errorf("no feed serves stop %s", stopID)
 	}
 
-	feed := &FeedMessage{}
-	if err := proto.Unmarshal(body, feed); err != nil {
-		return nil, err
+	res := []*StopUpdate{}
+	alerts := []ServiceAlert{}
+	errs := []error{}
+	for _, url := range urls {
+		feed, err := c.feeds.Get(ctx, url)
+		if err != nil {
+			slog.Warn("failed to get subway feed", "url", url, "stopID", stopID, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		updates, feedAlerts := c.tripsAtStop(feed, stopID)
+		res = append(res, updates...)
+		for _, alert := range feedAlerts {
+			// the same alert can be in more than one feed
+			if !slices.ContainsFunc(alerts, func(a ServiceAlert) bool { return a.ID != "" && a.ID == alert.ID }) {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+	if len(errs) == len(urls) {
+		return nil, nil, errors.Join(errs...)
 	}
 
-	return feed, nil
+	slices.SortStableFunc(res, func(a, b *StopUpdate) int {
+		return cmp.Compare(a.ArrivalTime(), b.ArrivalTime())
+	})
+	return res, FilterAlerts(alerts, c.LinesAtStop(stopID), stopID, c.now()), nil
 }
 
-func (c *ClientImpl) GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []*Alert, error) {
-	feed, err := c.GetFeed(ctx, StopIdToLine(stopID))
-	if err != nil {
-		return nil, nil, err
-	}
-
+func (c *ClientImpl) tripsAtStop(feed *gtfsrt.FeedMessage, stopID string) ([]*StopUpdate, []ServiceAlert) {
 	res := []*StopUpdate{}
-	alerts := []*Alert{}
+	alerts := []ServiceAlert{}
 	for _, entity := range feed.Entity {
 		if entity.IsDeleted != nil && *entity.IsDeleted {
 			continue
 		}
 		if entity.Alert != nil {
-			alerts = append(alerts, entity.Alert)
+			alerts = append(alerts, ParseAlert(entity.GetId(), entity.Alert))
 			slog.Debug("subway alert", "alert", entity.Alert)
 			continue
 		}
@@ -188,60 +291,117 @@ func (c *ClientImpl) GetTripsAtStop(ctx context.Context, stopID string) ([]*Stop
 		}
 		found := false
 		stopUpdate := &StopUpdate{
-			Stop: c.stopMap[stopID],
+			NyctTrip: nyctTrip(entity.TripUpdate.GetTrip()),
+			TripID:   entity.TripUpdate.GetTrip().GetTripId(),
+			Stop:     c.stopMap[stopID],
+			Line:     RouteToLine(entity.TripUpdate.GetTrip().GetRouteId()),
 		}
 		for _, stopTimeUpdate := range entity.TripUpdate.StopTimeUpdate {
-			if *stopTimeUpdate.StopId == stopID {
+			if stopTimeUpdate.GetStopId() == stopID {
 				found = true
 				stopUpdate.Arrival = stopTimeUpdate.Arrival
 				stopUpdate.Departure = stopTimeUpdate.Departure
+				stopUpdate.NyctTrack = nyctTrack(stopTimeUpdate)
 			}
 		}
 		if found {
 			lastIndex := len(entity.TripUpdate.StopTimeUpdate) - 1
-			stopUpdate.Destination = c.stopMap[*entity.TripUpdate.StopTimeUpdate[lastIndex].StopId]
+			stopUpdate.Destination = c.stopMap[entity.TripUpdate.StopTimeUpdate[lastIndex].GetStopId()]
+			stopUpdate.ScheduledTime, stopUpdate.Delay = c.delay(entity.TripUpdate.GetTrip(), stopID, stopUpdate.ArrivalTime())
 			res = append(res, stopUpdate)
-
 		}
 	}
+	return res, alerts
+}
+
+// delay compares the predicted arrival of trip at stopID to the schedule. It
+// returns the scheduled arrival and the delay in seconds, or zeros if the trip
+// is not in the schedule.
+func (c *ClientImpl) delay(trip *gtfsrt.TripDescriptor, stopID string, arrival int64) (int64, int64) {
+	if c.schedule == nil || arrival == 0 {
+		return 0, 0
+	}
+	scheduled, ok := c.schedule.ScheduledArrival(trip.GetTripId(), c.startDate(trip), stopID)
+	if !ok {
+		return 0, 0
+	}
+	return scheduled.Unix(), arrival - scheduled.Unix()
+}
 
-	return res, alerts, nil
+// startDate returns the service date that trip started on, which is today if
+// the feed does not say.
+func (c *ClientImpl) startDate(trip *gtfsrt.TripDescriptor) string {
+	if startDate := trip.GetStartDate(); startDate != "" {
+		return startDate
+	}
+	return c.schedule.ServiceDate(c.now())
 }
 
+// StopIdToLine returns the main line serving stopID, guessed from its ID.
 func StopIdToLine(stopID string) TrainLine {
-	switch stopID[0] {
-	case 'L':
-		return LTrain
-	case 'G':
-		return GTrain
-	default:
-		return UnknownTrain
+	if lines := guessRoutes(stopID); len(lines) > 0 {
+		return lines[0]
 	}
+	return UnknownTrain
 }
 
-func (c *ClientImpl) GetTrains(ctx context.Context, line TrainLine) (trains []TrainUpdate, alerts []*Alert, err error) {
+// GetTrains returns the trains on the feed of line and the active alerts about
+// line.
+func (c *ClientImpl) GetTrains(ctx context.Context, line TrainLine) (trains []TrainUpdate, alerts []ServiceAlert, err error) {
 	feed, err := c.GetFeed(ctx, line)
 	if err != nil {
 		return
 	}
 
+	// the tracks are only in the trip updates, which are separate entities
+	tripUpdates := map[string]*gtfsrt.TripUpdate{}
+	for _, entity := range feed.Entity {
+		if entity.TripUpdate != nil && entity.TripUpdate.GetTrip().GetTripId() != "" {
+			tripUpdates[entity.TripUpdate.GetTrip().GetTripId()] = entity.TripUpdate
+		}
+	}
+
 	for _, entity := range feed.Entity {
 		if entity.IsDeleted != nil && *entity.IsDeleted {
 			continue
 		}
 		if entity.Alert != nil {
-			alerts = append(alerts, entity.Alert)
+			alerts = append(alerts, ParseAlert(entity.GetId(), entity.Alert))
 			slog.Debug("subway alert", "alert", entity.Alert)
 			continue
 		}
 		if entity.Vehicle == nil {
 			continue
 		}
-		trains = append(trains, TrainUpdate{
+		// feeds are shared by several lines, e.g. the A, C and E
+		if routeID := entity.Vehicle.GetTrip().GetRouteId(); routeID != "" && RouteToLine(routeID) != line {
+			continue
+		}
+		train := TrainUpdate{
+			NyctTrip: nyctTrip(entity.Vehicle.GetTrip()),
+			TripID:   entity.Vehicle.GetTrip().GetTripId(),
 			NextStop: c.stopMap[entity.Vehicle.GetStopId()],
-			IsAtStop: entity.Vehicle.GetCurrentStatus() == VehiclePosition_STOPPED_AT,
-		})
+			IsAtStop: entity.Vehicle.GetCurrentStatus() == gtfsrt.VehiclePosition_STOPPED_AT,
+		}
+		if pattern := c.schedule.TripPattern(train.TripID, c.startDate(entity.Vehicle.GetTrip())); pattern != nil {
+			train.Stations = pattern.Stations
+		}
+		if tripUpdate, ok := tripUpdates[entity.Vehicle.GetTrip().GetTripId()]; ok {
+			for _, stopTimeUpdate := range tripUpdate.StopTimeUpdate {
+				if stopTimeUpdate.GetStopId() == entity.Vehicle.GetStopId() {
+					train.NyctTrack = nyctTrack(stopTimeUpdate)
+					arrival := stopTimeUpdate.GetArrival().GetTime()
+					if arrival == 0 {
+						arrival = stopTimeUpdate.GetDeparture().GetTime()
+					}
+					train.ScheduledTime, train.Delay = c.delay(tripUpdate.GetTrip(), stopTimeUpdate.GetStopId(), arrival)
+					break
+				}
+			}
+		}
+		trains = append(trains, train)
 	}
+	alerts = FilterAlerts(alerts, []TrainLine{line}, "", c.now())
 	return
 }
 
@@ -259,17 +419,22 @@ func (c *ClientImpl) GetStopsOnLine(ctx context.Context, line TrainLine) (stops
 		if entity.TripUpdate == nil {
 			continue
 		}
+		// feeds are shared by several lines, e.g. the A, C and E
+		if routeID := entity.TripUpdate.GetTrip().GetRouteId(); routeID != "" && RouteToLine(routeID) != line {
+			continue
+		}
 		for _, stopTimeUpdate := range entity.TripUpdate.StopTimeUpdate {
-			if strings.HasSuffix(*stopTimeUpdate.StopId, "N") {
-				trainsStopping[*stopTimeUpdate.StopId] |= TrainsStoppingNorth
-			} else if strings.HasSuffix(*stopTimeUpdate.StopId, "S") {
-				trainsStopping[*stopTimeUpdate.StopId] |= TrainsStoppingSouth
+			stopID := stopTimeUpdate.GetStopId()
+			if strings.HasSuffix(stopID, "N") {
+				trainsStopping[stopID] |= TrainsStoppingNorth
+			} else if strings.HasSuffix(stopID, "S") {
+				trainsStopping[stopID] |= TrainsStoppingSouth
 			}
 		}
 	}
 
 	for _, stop := range c.stopMap {
-		if stop.ID[0] == line[0] {
+		if c.servesLine(stop.ID, line) {
 			if !strings.HasSuffix(stop.ID, "N") && !strings.HasSuffix(stop.ID, "S") {
 				stop.AreTrainsStopping = trainsStopping[stop.ID+"N"] | trainsStopping[stop.ID+"S"]
 			} else {
@@ -280,3 +445,15 @@ func (c *ClientImpl) GetStopsOnLine(ctx context.Context, line TrainLine) (stops
 	}
 	return
 }
+
+func (c *ClientImpl) servesLine(stopID string, line TrainLine) bool {
+	if c.stopRoutes == nil {
+		// without the static GTFS data, only the stops named after the line
+		// and the known shuttle stations
+		if routes, ok := stationRoutes[parentStation(stopID)]; ok {
+			return slices.Contains(routes, line)
+		}
+		return !slices.Contains(Shuttles, line) && stopID[0] == line[0]
+	}
+	return slices.Contains(c.stopRoutes[stopID], line)
+}
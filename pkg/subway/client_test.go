@@ -2,10 +2,15 @@ package subway_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/fs"
 	"net/http"
+	"slices"
 	"testing"
+	"testing/fstest"
 
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 	subway "github.com/mpoegel/red-maple/pkg/subway"
 	proto "google.golang.org/protobuf/proto"
 )
@@ -41,7 +46,14 @@ func TestStopIdToLine(t *testing.T) {
 		{"L03S", subway.LTrain},
 		{"G01N", subway.GTrain},
 		{"G01S", subway.GTrain},
-		{"A03N", subway.UnknownTrain},
+		{"A03N", subway.ATrain},
+		{"101N", subway.OneTrain},
+		{"R16S", subway.RTrain},
+		{"901S", subway.GSTrain},
+		{"S03N", subway.FSTrain},
+		{"D26N", subway.BTrain},
+		{"H04S", subway.ATrain},
+		{"H14N", subway.HTrain},
 		{"unknown", subway.UnknownTrain},
 	}
 
@@ -56,15 +68,15 @@ func TestStopIdToLine(t *testing.T) {
 }
 
 func TestGetFeed_Success(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("trip1"),
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
 				},
@@ -167,21 +179,21 @@ func TestGetFeed_InvalidProtobuf(t *testing.T) {
 
 func TestGetTripsAtStop_Success(t *testing.T) {
 	stopID := "L03N"
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("trip1"),
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
-					StopTimeUpdate: []*subway.TripUpdate_StopTimeUpdate{
+					StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
 						{
 							StopId: proto.String(stopID),
-							Arrival: &subway.TripUpdate_StopTimeEvent{
+							Arrival: &gtfsrt.TripUpdate_StopTimeEvent{
 								Time: proto.Int64(1234567890),
 							},
 						},
@@ -233,18 +245,18 @@ func TestGetTripsAtStop_Success(t *testing.T) {
 
 func TestGetTripsAtStop_StopNotInMap(t *testing.T) {
 	stopID := "L03N"
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("trip1"),
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
-					StopTimeUpdate: []*subway.TripUpdate_StopTimeUpdate{
+					StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
 						{
 							StopId: proto.String(stopID),
 						},
@@ -287,11 +299,11 @@ func TestGetTripsAtStop_StopNotInMap(t *testing.T) {
 
 func TestGetTripsAtStop_NoTrips(t *testing.T) {
 	stopID := "L03N"
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{},
+		Entity: []*gtfsrt.FeedEntity{},
 	}
 	feedBytes, _ := proto.Marshal(feed)
 
@@ -325,29 +337,29 @@ func TestGetTripsAtStop_NoTrips(t *testing.T) {
 }
 
 func TestGetTrains_Success(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("vehicle1"),
-				Vehicle: &subway.VehiclePosition{
-					Trip: &subway.TripDescriptor{
+				Vehicle: &gtfsrt.VehiclePosition{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
 					StopId:        proto.String("L03N"),
-					CurrentStatus: subway.VehiclePosition_STOPPED_AT.Enum(),
+					CurrentStatus: gtfsrt.VehiclePosition_STOPPED_AT.Enum(),
 				},
 			},
 			{
 				Id: proto.String("vehicle2"),
-				Vehicle: &subway.VehiclePosition{
-					Trip: &subway.TripDescriptor{
+				Vehicle: &gtfsrt.VehiclePosition{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip2"),
 					},
 					StopId:        proto.String("L04N"),
-					CurrentStatus: subway.VehiclePosition_IN_TRANSIT_TO.Enum(),
+					CurrentStatus: gtfsrt.VehiclePosition_IN_TRANSIT_TO.Enum(),
 				},
 			},
 		},
@@ -394,11 +406,11 @@ func TestGetTrains_Success(t *testing.T) {
 }
 
 func TestGetTrains_Empty(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{},
+		Entity: []*gtfsrt.FeedEntity{},
 	}
 	feedBytes, _ := proto.Marshal(feed)
 
@@ -428,16 +440,16 @@ func TestGetTrains_Empty(t *testing.T) {
 }
 
 func TestGetTrains_Alerts(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("alert1"),
-				Alert: &subway.Alert{
-					HeaderText: &subway.TranslatedString{
-						Translation: []*subway.TranslatedString_Translation{
+				Alert: &gtfsrt.Alert{
+					HeaderText: &gtfsrt.TranslatedString{
+						Translation: []*gtfsrt.TranslatedString_Translation{
 							{Text: proto.String("Delay on L line")},
 						},
 					},
@@ -476,18 +488,18 @@ func TestGetTrains_Alerts(t *testing.T) {
 }
 
 func TestGetStopsOnLine_Success(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("trip1"),
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
-					StopTimeUpdate: []*subway.TripUpdate_StopTimeUpdate{
+					StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
 						{
 							StopId: proto.String("L03N"),
 						},
@@ -529,23 +541,76 @@ func TestGetStopsOnLine_Success(t *testing.T) {
 	}
 }
 
+func TestGetStopsOnLine_SharedFeed(t *testing.T) {
+	tripUpdate := func(routeID string, stopIDs ...string) *gtfsrt.FeedEntity {
+		updates := []*gtfsrt.TripUpdate_StopTimeUpdate{{}}
+		for _, stopID := range stopIDs {
+			updates = append(updates, &gtfsrt.TripUpdate_StopTimeUpdate{StopId: proto.String(stopID)})
+		}
+		return &gtfsrt.FeedEntity{
+			Id: proto.String(routeID),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip:           &gtfsrt.TripDescriptor{TripId: proto.String(routeID), RouteId: proto.String(routeID)},
+				StopTimeUpdate: updates,
+			},
+		}
+	}
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			tripUpdate("A", "A24N"),
+			tripUpdate("C", "A25N", "A24S"),
+		},
+	}
+	feedBytes, _ := proto.Marshal(feed)
+
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: &mockTransport{responseBody: feedBytes, statusCode: 200}}),
+		subway.WithStopMap(map[string]subway.SubwayStop{
+			"A24N": {ID: "A24N", Name: "59 St-Columbus Circle"},
+			"A24S": {ID: "A24S", Name: "59 St-Columbus Circle"},
+			"A25N": {ID: "A25N", Name: "50 St"},
+		}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{
+			subway.ATrain: "http://redmaple.tree/feed",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	stops, err := client.GetStopsOnLine(t.Context(), subway.ATrain)
+	if err != nil {
+		t.Fatalf("GetStopsOnLine error: %v", err)
+	}
+	want := map[string]int{"A24N": subway.TrainsStoppingNorth, "A24S": 0, "A25N": 0}
+	if len(stops) != len(want) {
+		t.Fatalf("expected %d A stops, got %d", len(want), len(stops))
+	}
+	for _, stop := range stops {
+		if stop.AreTrainsStopping != want[stop.ID] {
+			t.Errorf("%s: expected AreTrainsStopping=%d, got %d", stop.ID, want[stop.ID], stop.AreTrainsStopping)
+		}
+	}
+}
+
 func TestNewClientWithOptions_StopMap(t *testing.T) {
 	stopMap := map[string]subway.SubwayStop{
 		"L03N": {ID: "L03N", Name: "Test Station"},
 	}
 
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("trip1"),
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
-					StopTimeUpdate: []*subway.TripUpdate_StopTimeUpdate{
+					StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{
 						{
 							StopId: proto.String("L03N"),
 						},
@@ -583,16 +648,16 @@ func TestNewClientWithOptions_StopMap(t *testing.T) {
 }
 
 func TestGetTripsAtStop_Alert(t *testing.T) {
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id: proto.String("alert1"),
-				Alert: &subway.Alert{
-					HeaderText: &subway.TranslatedString{
-						Translation: []*subway.TranslatedString_Translation{
+				Alert: &gtfsrt.Alert{
+					HeaderText: &gtfsrt.TranslatedString{
+						Translation: []*gtfsrt.TranslatedString_Translation{
 							{Text: proto.String("Service change")},
 						},
 					},
@@ -633,16 +698,16 @@ func TestGetTripsAtStop_Alert(t *testing.T) {
 
 func TestGetTripsAtStop_DeletedEntity(t *testing.T) {
 	deleted := true
-	feed := &subway.FeedMessage{
-		Header: &subway.FeedHeader{
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{
 			GtfsRealtimeVersion: proto.String("2.0"),
 		},
-		Entity: []*subway.FeedEntity{
+		Entity: []*gtfsrt.FeedEntity{
 			{
 				Id:        proto.String("trip1"),
 				IsDeleted: &deleted,
-				TripUpdate: &subway.TripUpdate{
-					Trip: &subway.TripDescriptor{
+				TripUpdate: &gtfsrt.TripUpdate{
+					Trip: &gtfsrt.TripDescriptor{
 						TripId: proto.String("trip1"),
 					},
 				},
@@ -679,3 +744,298 @@ func TestGetTripsAtStop_DeletedEntity(t *testing.T) {
 		t.Errorf("expected 0 trips (deleted entity), got %d", len(trips))
 	}
 }
+
+func TestNewClientFromFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"mta/stops.txt": {Data: []byte("stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+			"L03,14 St-Union Sq,40.734789,-73.990730,1,\n" +
+			"L03S,14 St-Union Sq,40.734789,-73.990730,,L03\n")},
+	}
+
+	stops, err := subway.LoadStops(fsys)
+	if err != nil {
+		t.Fatalf("LoadStops error: %v", err)
+	}
+	if len(stops) != 2 {
+		t.Errorf("expected 2 stops, got %d", len(stops))
+	}
+	if stops["L03S"].ParentStation != "L03" {
+		t.Errorf("expected parent station L03, got %q", stops["L03S"].ParentStation)
+	}
+
+	if _, err := subway.NewClientFromFS(fstest.MapFS{}); err == nil {
+		t.Error("expected error for missing stops.txt, got nil")
+	}
+}
+
+// feedTransport serves a different feed for each URL.
+type feedTransport struct {
+	feeds map[string]*gtfsrt.FeedMessage
+	calls map[string]int
+}
+
+func (f *feedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls[req.URL.String()]++
+	feed, ok := f.feeds[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	body, err := proto.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func tripFeed(routeID string, arrival int64, stopIDs ...string) *gtfsrt.FeedMessage {
+	updates := []*gtfsrt.TripUpdate_StopTimeUpdate{}
+	for i, stopID := range stopIDs {
+		updates = append(updates, &gtfsrt.TripUpdate_StopTimeUpdate{
+			StopId:  proto.String(stopID),
+			Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival + int64(i)*60)},
+		})
+	}
+	return &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{{
+			Id: proto.String(routeID + "-trip"),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip:           &gtfsrt.TripDescriptor{TripId: proto.String(routeID + "-trip"), RouteId: proto.String(routeID)},
+				StopTimeUpdate: updates,
+			},
+		}},
+	}
+}
+
+var gtfsFS = fstest.MapFS{
+	"mta/stops.txt": &fstest.MapFile{Data: []byte("stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+		"635,14 St-Union Sq,40.734673,-73.989951,1,\n" +
+		"635N,14 St-Union Sq,40.734673,-73.989951,0,635\n" +
+		"L03,14 St-Union Sq,40.734789,-73.99073,1,\n" +
+		"L03N,14 St-Union Sq,40.734789,-73.99073,0,L03\n" +
+		"R20N,14 St-Union Sq,40.735736,-73.990568,0,R20\n")},
+	"mta/routes.txt": &fstest.MapFile{Data: []byte("\ufeffagency_id,route_id,route_short_name\n" +
+		"MTA NYCT,4,4\nMTA NYCT,6,6\nMTA NYCT,6X,6X\nMTA NYCT,L,L\nMTA NYCT,N,N\nMTA NYCT,R,R\n")},
+	"mta/trips.txt": &fstest.MapFile{Data: []byte("route_id,trip_id,service_id\n" +
+		"4,t4,Weekday\n6X,t6x,Weekday\nL,tl,Weekday\nN,tn,Weekday\nR,tr,Weekday\n")},
+	"mta/stop_times.txt": &fstest.MapFile{Data: []byte("trip_id,stop_id,arrival_time,stop_sequence\n" +
+		"t4,635N,08:00:00,1\nt6x,635N,08:01:00,1\ntl,L03N,08:02:00,1\ntn,R20N,08:03:00,1\ntr,R20N,08:04:00,1\n")},
+}
+
+func TestLoadStopRoutes(t *testing.T) {
+	stopRoutes, err := subway.LoadStopRoutes(gtfsFS)
+	if err != nil {
+		t.Fatalf("LoadStopRoutes error: %v", err)
+	}
+	tests := map[string][]subway.TrainLine{
+		"635N": {subway.FourTrain, subway.SixTrain},
+		"635":  {subway.FourTrain, subway.SixTrain},
+		"L03N": {subway.LTrain},
+		"R20":  {subway.NTrain, subway.RTrain},
+	}
+	for stopID, want := range tests {
+		if got := stopRoutes[stopID]; !slices.Equal(got, want) {
+			t.Errorf("stopRoutes[%s] = %v, want %v", stopID, got, want)
+		}
+	}
+}
+
+func TestLoadStopRoutes_StationEndingInDirection(t *testing.T) {
+	fsys := fstest.MapFS{
+		"mta/routes.txt":     &fstest.MapFile{Data: []byte("route_id\nL\n")},
+		"mta/trips.txt":      &fstest.MapFile{Data: []byte("route_id,trip_id,service_id\nL,tl,Weekday\n")},
+		"mta/stop_times.txt": &fstest.MapFile{Data: []byte("trip_id,stop_id,arrival_time,stop_sequence\ntl,L0SN,08:00:00,1\ntl,L1NS,08:02:00,2\n")},
+	}
+	stopRoutes, err := subway.LoadStopRoutes(fsys)
+	if err != nil {
+		t.Fatalf("LoadStopRoutes error: %v", err)
+	}
+	for _, stopID := range []string{"L0SN", "L0S", "L1NS", "L1N"} {
+		if got := stopRoutes[stopID]; !slices.Equal(got, []subway.TrainLine{subway.LTrain}) {
+			t.Errorf("stopRoutes[%s] = %v, want [L]", stopID, got)
+		}
+	}
+	for _, stopID := range []string{"L0", "L1"} {
+		if got, ok := stopRoutes[stopID]; ok {
+			t.Errorf("stopRoutes[%s] = %v, expected no station", stopID, got)
+		}
+	}
+}
+
+func TestLoadStopRoutes_Missing(t *testing.T) {
+	_, err := subway.LoadStopRoutes(fstest.MapFS{"mta/stops.txt": gtfsFS["mta/stops.txt"]})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestLinesAtStop_WithoutStaticGTFS(t *testing.T) {
+	client, err := subway.NewClientFromFS(fstest.MapFS{"mta/stops.txt": gtfsFS["mta/stops.txt"]})
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+	if got := client.LinesAtStop("L03N"); !slices.Equal(got, []subway.TrainLine{subway.LTrain}) {
+		t.Errorf("LinesAtStop(L03N) = %v", got)
+	}
+	if got := client.LinesAtStop("635N"); !slices.Contains(got, subway.SixTrain) {
+		t.Errorf("LinesAtStop(635N) = %v, expected the 6", got)
+	}
+}
+
+func TestGetTripsAtStop_SharedStation(t *testing.T) {
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{
+			"http://redmaple.tree/feed-123456": tripFeed("6X", 2000, "635N", "631N"),
+			"http://redmaple.tree/feed-nqrw":   tripFeed("N", 1000, "635N", "R17N"),
+		},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithStopMap(map[string]subway.SubwayStop{
+			"635N": {ID: "635N", Name: "14 St-Union Sq"},
+		}),
+		// the L feed is down, which should not hide the other trains
+		subway.WithStopRoutes(map[string][]subway.TrainLine{
+			"635N": {subway.FourTrain, subway.LTrain, subway.NTrain, subway.SixTrain},
+		}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{
+			subway.FourTrain: "http://redmaple.tree/feed-123456",
+			subway.SixTrain:  "http://redmaple.tree/feed-123456",
+			subway.NTrain:    "http://redmaple.tree/feed-nqrw",
+			subway.LTrain:    "http://redmaple.tree/feed-l",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	trips, _, err := client.GetTripsAtStop(t.Context(), "635N")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(trips) != 2 {
+		t.Fatalf("expected 2 trips, got %d", len(trips))
+	}
+	if trips[0].Line != subway.NTrain || trips[1].Line != subway.SixTrain {
+		t.Errorf("expected the N then the 6, got %s then %s", trips[0].Line, trips[1].Line)
+	}
+	if n := ft.calls["http://redmaple.tree/feed-123456"]; n != 1 {
+		t.Errorf("expected the 123456 feed to be fetched once, got %d", n)
+	}
+}
+
+func TestGetTripsAtStop_AllFeedsFail(t *testing.T) {
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{}, calls: map[string]int{}}
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{
+			subway.LTrain: "http://redmaple.tree/feed-l",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	if _, _, err := client.GetTripsAtStop(t.Context(), "L03N"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func nyctFeed() *gtfsrt.FeedMessage {
+	trip := &gtfsrt.TripDescriptor{TripId: proto.String("062950_6..N01R"), RouteId: proto.String("6")}
+	proto.SetExtension(trip, subway.E_NyctTripDescriptor, &subway.NyctTripDescriptor{
+		TrainId:    proto.String("06 1029+ BBR/PEL"),
+		IsAssigned: proto.Bool(true),
+		Direction:  subway.NyctTripDescriptor_NORTH.Enum(),
+	})
+	update := &gtfsrt.TripUpdate_StopTimeUpdate{
+		StopId:  proto.String("635N"),
+		Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(1000)},
+	}
+	proto.SetExtension(update, subway.E_NyctStopTimeUpdate, &subway.NyctStopTimeUpdate{
+		ScheduledTrack: proto.String("1"),
+		ActualTrack:    proto.String("2"),
+	})
+	return &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			{
+				Id:         proto.String("1"),
+				TripUpdate: &gtfsrt.TripUpdate{Trip: trip, StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{update}},
+			},
+			{
+				Id: proto.String("2"),
+				Vehicle: &gtfsrt.VehiclePosition{
+					Trip:          trip,
+					StopId:        proto.String("635N"),
+					CurrentStatus: gtfsrt.VehiclePosition_STOPPED_AT.Enum(),
+				},
+			},
+		},
+	}
+}
+
+func TestNyctExtensions(t *testing.T) {
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{"http://redmaple.tree/feed-123456": nyctFeed()},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithStopRoutes(map[string][]subway.TrainLine{"635N": {subway.SixTrain}}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.SixTrain: "http://redmaple.tree/feed-123456"}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	trips, _, err := client.GetTripsAtStop(t.Context(), "635N")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(trips) != 1 {
+		t.Fatalf("expected 1 trip, got %d", len(trips))
+	}
+	want := subway.NyctTrip{TrainID: "06 1029+ BBR/PEL", Direction: subway.NyctTripDescriptor_NORTH, IsAssigned: true}
+	if trips[0].NyctTrip != want {
+		t.Errorf("expected %+v, got %+v", want, trips[0].NyctTrip)
+	}
+	if !trips[0].IsRerouted() || trips[0].Track() != "2" {
+		t.Errorf("expected the trip to be rerouted to track 2, got %+v", trips[0].NyctTrack)
+	}
+
+	trains, _, err := client.GetTrains(t.Context(), subway.SixTrain)
+	if err != nil {
+		t.Fatalf("GetTrains error: %v", err)
+	}
+	if len(trains) != 1 {
+		t.Fatalf("expected 1 train, got %d", len(trains))
+	}
+	if trains[0].TrainID != want.TrainID || trains[0].ActualTrack != "2" || trains[0].ScheduledTrack != "1" {
+		t.Errorf("expected the train's ID and tracks, got %+v", trains[0])
+	}
+}
+
+func TestNyctExtensions_Missing(t *testing.T) {
+	feed := tripFeed("L", 1000, "L03N")
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{"http://redmaple.tree/feed-l": feed},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientWithOptions(
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.LTrain: "http://redmaple.tree/feed-l"}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientWithOptions error: %v", err)
+	}
+
+	trips, _, err := client.GetTripsAtStop(t.Context(), "L03N")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if trips[0].NyctTrip != (subway.NyctTrip{}) || trips[0].IsRerouted() || trips[0].Track() != "" {
+		t.Errorf("expected no NYCT data, got %+v", trips[0])
+	}
+}
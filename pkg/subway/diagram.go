@@ -0,0 +1,192 @@
+package subway
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LineSection is a stretch of a line diagram. A section with more than one
+// branch is where the line splits, e.g. the A to Lefferts Blvd and to Far
+// Rockaway, and its branches run side by side.
+type LineSection struct {
+	// Branches are the stations of each branch, ordered as a southbound train
+	// stops at them.
+	Branches [][]SubwayStop
+}
+
+// GetLineDiagram returns the stations of line in order, split into sections
+// where the line branches. Without the static GTFS stop sequences, it is a
+// single section ordered by stop ID.
+func (c *ClientImpl) GetLineDiagram(ctx context.Context, line TrainLine) ([]LineSection, error) {
+	stops, err := c.GetStopsOnLine(ctx, line)
+	if err != nil {
+		return nil, err
+	}
+	stations := map[string]SubwayStop{}
+	for _, stop := range stops {
+		if stop.LocationType == RootStationType {
+			stations[stop.ID] = stop
+		}
+	}
+
+	patterns := c.schedule.linePatterns(line)
+	if len(patterns) == 0 {
+		return []LineSection{{Branches: [][]SubwayStop{sortByStopID(stations)}}}, nil
+	}
+
+	sections := []LineSection{}
+	for _, section := range buildDiagram(patterns) {
+		ls := LineSection{Branches: [][]SubwayStop{}}
+		for _, branch := range section {
+			stops := []SubwayStop{}
+			for _, id := range branch {
+				if stop, ok := stations[id]; ok {
+					stops = append(stops, stop)
+				}
+			}
+			if len(stops) > 0 {
+				ls.Branches = append(ls.Branches, stops)
+			}
+		}
+		if len(ls.Branches) > 0 {
+			sections = append(sections, ls)
+		}
+	}
+	return sections, nil
+}
+
+func (s *Schedule) linePatterns(line TrainLine) []*Pattern {
+	if s == nil {
+		return nil
+	}
+	return s.Patterns[line]
+}
+
+// sortByStopID orders stations by the number in their ID, which follows the
+// line for stations that are named after it, such as L01 to L29.
+func sortByStopID(stations map[string]SubwayStop) []SubwayStop {
+	res := []SubwayStop{}
+	for _, station := range stations {
+		res = append(res, station)
+	}
+	slices.SortFunc(res, func(a, b SubwayStop) int {
+		idA, _ := strconv.Atoi(a.ID[1:])
+		idB, _ := strconv.Atoi(b.ID[1:])
+		if idA != idB {
+			return idA - idB
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return res
+}
+
+// buildDiagram lays out the stations of a line's patterns as sections of
+// branches. The most common pattern is the trunk. Stations that other patterns
+// stop at between two trunk stations are added to the trunk; where a pattern
+// starts or ends off the trunk, the trunk splits into branches at the first
+// point any pattern leaves it.
+func buildDiagram(patterns []*Pattern) [][][]string {
+	trunk := slices.Clone(patterns[0].Stations)
+	for _, pattern := range patterns[1:] {
+		trunk = mergeMiddle(trunk, pattern.Stations)
+	}
+
+	type divergence struct {
+		at       int
+		stations []string
+	}
+	heads, tails := []divergence{}, []divergence{}
+	for _, pattern := range patterns[1:] {
+		first, last := -1, -1
+		for i, station := range pattern.Stations {
+			if slices.Contains(trunk, station) {
+				if first < 0 {
+					first = i
+				}
+				last = i
+			}
+		}
+		if first < 0 {
+			// a pattern that never joins the trunk cannot be placed
+			continue
+		}
+		if first > 0 {
+			heads = append(heads, divergence{slices.Index(trunk, pattern.Stations[first]), pattern.Stations[:first]})
+		}
+		if last < len(pattern.Stations)-1 {
+			tails = append(tails, divergence{slices.Index(trunk, pattern.Stations[last]), pattern.Stations[last+1:]})
+		}
+	}
+
+	start, end := 0, len(trunk)-1
+	headBranches, tailBranches := [][]string{}, [][]string{}
+	if len(tails) > 0 {
+		end = slices.MinFunc(tails, func(a, b divergence) int { return a.at - b.at }).at
+		tailBranches = addBranch(tailBranches, trunk[end+1:])
+		for _, tail := range tails {
+			tailBranches = addBranch(tailBranches, slices.Concat(trunk[end+1:tail.at+1], tail.stations))
+		}
+	}
+	if len(heads) > 0 {
+		start = slices.MaxFunc(heads, func(a, b divergence) int { return a.at - b.at }).at
+		if start > end {
+			// the branches overlap, so only split at the tail
+			start = 0
+		} else {
+			headBranches = addBranch(headBranches, trunk[:start])
+			for _, head := range heads {
+				headBranches = addBranch(headBranches, slices.Concat(head.stations, trunk[head.at:start]))
+			}
+		}
+	}
+
+	sections := [][][]string{}
+	middle := trunk[start : end+1]
+	// a single branch is just more of the trunk
+	if len(headBranches) == 1 {
+		middle = slices.Concat(headBranches[0], middle)
+	} else if len(headBranches) > 1 {
+		sections = append(sections, headBranches)
+	}
+	if len(tailBranches) == 1 {
+		middle = slices.Concat(middle, tailBranches[0])
+	}
+	sections = append(sections, [][]string{middle})
+	if len(tailBranches) > 1 {
+		sections = append(sections, tailBranches)
+	}
+	return sections
+}
+
+// addBranch adds branch to branches unless it is empty or already there.
+func addBranch(branches [][]string, branch []string) [][]string {
+	if len(branch) == 0 || slices.ContainsFunc(branches, func(b []string) bool { return slices.Equal(b, branch) }) {
+		return branches
+	}
+	return append(branches, branch)
+}
+
+// mergeMiddle inserts the stations of pattern that lie between two stations
+// of trunk, such as local stops that the trunk's express trains skip.
+func mergeMiddle(trunk, pattern []string) []string {
+	prev := -1
+	pending := []string{}
+	for _, station := range pattern {
+		i := slices.Index(trunk, station)
+		if i < 0 {
+			if prev >= 0 {
+				pending = append(pending, station)
+			}
+			continue
+		}
+		if len(pending) > 0 && i > prev {
+			trunk = slices.Insert(trunk, prev+1, pending...)
+			i += len(pending)
+		}
+		pending = pending[:0]
+		prev = i
+	}
+	return trunk
+}
@@ -0,0 +1,203 @@
+package subway_test
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
+)
+
+const aFeedURL = "http://redmaple.tree/ace"
+
+// aLineFS models the A, which splits south of Rockaway Blvd (A61) into the
+// Lefferts Blvd (A63, A65) and Far Rockaway (H02, H03) branches. The most
+// common trips skip 145 St (A05), which only the Far Rockaway trips stop at.
+var aLineFS = fstest.MapFS{
+	"mta/stops.txt": &fstest.MapFile{Data: []byte("stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+		"A02,Inwood-207 St,40.868072,-73.919899,1,\n" +
+		"A03,Dyckman St,40.865491,-73.927271,1,\n" +
+		"A05,145 St,40.824783,-73.944216,1,\n" +
+		"A06,125 St,40.811109,-73.952343,1,\n" +
+		"A61,Rockaway Blvd,40.680429,-73.843853,1,\n" +
+		"A63,104 St,40.681711,-73.837683,1,\n" +
+		"A65,Ozone Park-Lefferts Blvd,40.685951,-73.825798,1,\n" +
+		"H02,Aqueduct Racetrack,40.672097,-73.835919,1,\n" +
+		"H03,Aqueduct-N Conduit Av,40.668234,-73.834058,1,\n")},
+	"mta/routes.txt": &fstest.MapFile{Data: []byte("agency_id,route_id,route_short_name\n" +
+		"MTA NYCT,A,A\nMTA NYCT,C,C\n")},
+	"mta/trips.txt": &fstest.MapFile{Data: []byte("route_id,trip_id,service_id\n" +
+		"A,ASP25GEN-A089-Weekday-00_000600_A..S03R,Weekday\n" +
+		"A,ASP25GEN-A089-Weekday-00_001200_A..S03R,Weekday\n" +
+		"A,ASP25GEN-A089-Weekday-00_001800_A..N03R,Weekday\n" +
+		"A,ASP25GEN-A089-Weekday-00_002400_A..S57R,Weekday\n")},
+	"mta/stop_times.txt": &fstest.MapFile{Data: []byte("trip_id,stop_id,arrival_time,stop_sequence\n" +
+		stopTimes("ASP25GEN-A089-Weekday-00_000600_A..S03R", "A02S", "A03S", "A06S", "A61S", "A63S", "A65S") +
+		stopTimes("ASP25GEN-A089-Weekday-00_001200_A..S03R", "A02S", "A03S", "A06S", "A61S", "A63S", "A65S") +
+		stopTimes("ASP25GEN-A089-Weekday-00_001800_A..N03R", "A65N", "A63N", "A61N", "A06N", "A03N", "A02N") +
+		stopTimes("ASP25GEN-A089-Weekday-00_002400_A..S57R", "A02S", "A03S", "A05S", "A06S", "A61S", "H02S", "H03S"))},
+}
+
+// stopTimes writes the stop_times.txt rows of a trip, listed out of order to
+// check that they are sorted by stop_sequence.
+func stopTimes(tripID string, stopIDs ...string) string {
+	rows := []string{}
+	for i, stopID := range stopIDs {
+		rows = append(rows, tripID+","+stopID+",08:00:00,"+string(rune('1'+i)))
+	}
+	slices.Reverse(rows)
+	return strings.Join(rows, "\n") + "\n"
+}
+
+func stationIDs(stops []subway.SubwayStop) []string {
+	ids := []string{}
+	for _, stop := range stops {
+		ids = append(ids, stop.ID)
+	}
+	return ids
+}
+
+func TestLoadSchedule_Patterns(t *testing.T) {
+	schedule, err := subway.LoadSchedule(aLineFS)
+	if err != nil {
+		t.Fatalf("LoadSchedule error: %v", err)
+	}
+
+	patterns := schedule.Patterns[subway.ATrain]
+	if len(patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(patterns))
+	}
+	// the northbound trip is reversed, so it shares the pattern of the
+	// southbound Lefferts trips
+	if patterns[0].Trips != 3 {
+		t.Errorf("expected 3 trips on the first pattern, got %d", patterns[0].Trips)
+	}
+	if want := []string{"A02", "A03", "A06", "A61", "A63", "A65"}; !slices.Equal(patterns[0].Stations, want) {
+		t.Errorf("first pattern = %v, want %v", patterns[0].Stations, want)
+	}
+
+	if got := schedule.TripPattern("001800_A..N03R", "20261015"); got != patterns[0] {
+		t.Errorf("TripPattern(001800_A..N03R) = %v, want %v", got, patterns[0])
+	}
+	if got := schedule.TripPattern("002400_A..S57R", "20261015"); got != patterns[1] {
+		t.Errorf("TripPattern(002400_A..S57R) = %v, want %v", got, patterns[1])
+	}
+	if got := schedule.TripPattern("999999_A..S03R", "20261015"); got != nil {
+		t.Errorf("expected no pattern for an unknown trip, got %v", got)
+	}
+}
+
+func TestGetLineDiagram_Branches(t *testing.T) {
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{aFeedURL: tripFeed("A", 1700000000, "A02S")},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientFromFS(aLineFS,
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.ATrain: aFeedURL}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	sections, err := client.GetLineDiagram(t.Context(), subway.ATrain)
+	if err != nil {
+		t.Fatalf("GetLineDiagram error: %v", err)
+	}
+	want := [][][]string{
+		{{"A02", "A03", "A05", "A06", "A61"}},
+		{{"A63", "A65"}, {"H02", "H03"}},
+	}
+	if len(sections) != len(want) {
+		t.Fatalf("expected %d sections, got %d", len(want), len(sections))
+	}
+	for i, section := range sections {
+		if len(section.Branches) != len(want[i]) {
+			t.Fatalf("section %d: expected %d branches, got %d", i, len(want[i]), len(section.Branches))
+		}
+		for j, branch := range section.Branches {
+			if got := stationIDs(branch); !slices.Equal(got, want[i][j]) {
+				t.Errorf("section %d branch %d = %v, want %v", i, j, got, want[i][j])
+			}
+		}
+	}
+	if sections[0].Branches[0][0].AreTrainsStopping&subway.TrainsStoppingSouth == 0 {
+		t.Error("expected southbound trains stopping at A02")
+	}
+}
+
+func TestGetLineDiagram_WithoutSchedule(t *testing.T) {
+	fsys := fstest.MapFS{"mta/stops.txt": &fstest.MapFile{Data: []byte(
+		"stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+			"L10,Atlantic Av,40.675345,-73.903097,1,\n" +
+			"L02,6 Av,40.737335,-73.996786,1,\n" +
+			"L01,8 Av,40.739777,-74.002578,1,\n" +
+			"L01N,8 Av,40.739777,-74.002578,0,L01\n")}}
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{"http://redmaple.tree/l": tripFeed("L", 1700000000, "L01N")},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientFromFS(fsys,
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.LTrain: "http://redmaple.tree/l"}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	sections, err := client.GetLineDiagram(t.Context(), subway.LTrain)
+	if err != nil {
+		t.Fatalf("GetLineDiagram error: %v", err)
+	}
+	if len(sections) != 1 || len(sections[0].Branches) != 1 {
+		t.Fatalf("expected a single unbranched section, got %v", sections)
+	}
+	if got, want := stationIDs(sections[0].Branches[0]), []string{"L01", "L02", "L10"}; !slices.Equal(got, want) {
+		t.Errorf("stations = %v, want %v", got, want)
+	}
+}
+
+func TestGetTrains_SharedFeed(t *testing.T) {
+	vehicle := func(tripID, routeID, stopID string) *gtfsrt.FeedEntity {
+		return &gtfsrt.FeedEntity{
+			Id: proto.String(tripID),
+			Vehicle: &gtfsrt.VehiclePosition{
+				Trip:   &gtfsrt.TripDescriptor{TripId: proto.String(tripID), RouteId: proto.String(routeID)},
+				StopId: proto.String(stopID),
+			},
+		}
+	}
+	feed := &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: []*gtfsrt.FeedEntity{
+			vehicle("002400_A..S57R", "A", "A06S"),
+			vehicle("003000_C..S04R", "C", "A06S"),
+		},
+	}
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{aFeedURL: feed}, calls: map[string]int{}}
+	client, err := subway.NewClientFromFS(aLineFS,
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.ATrain: aFeedURL, subway.CTrain: aFeedURL}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	trains, _, err := client.GetTrains(t.Context(), subway.ATrain)
+	if err != nil {
+		t.Fatalf("GetTrains error: %v", err)
+	}
+	if len(trains) != 1 {
+		t.Fatalf("expected 1 A train, got %d", len(trains))
+	}
+	if trains[0].TripID != "002400_A..S57R" {
+		t.Errorf("expected trip 002400_A..S57R, got %q", trains[0].TripID)
+	}
+	if want := []string{"A02", "A03", "A05", "A06", "A61", "H02", "H03"}; !slices.Equal(trains[0].Stations, want) {
+		t.Errorf("stations = %v, want %v", trains[0].Stations, want)
+	}
+}
@@ -0,0 +1,330 @@
+package subway
+
+import (
+	"cmp"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prefixRoutes guesses the routes serving a stop from the first character of
+// its ID, for when the static GTFS trips and stop times are not available. The
+// main route of the stops with that prefix comes first. It errs on the side of
+// including too many routes, since arrivals are filtered by stop ID anyway.
+var prefixRoutes = map[byte][]TrainLine{
+	'1': {OneTrain, TwoTrain, ThreeTrain},
+	'2': {TwoTrain, ThreeTrain, FourTrain, FiveTrain},
+	'3': {ThreeTrain, TwoTrain},
+	'4': {FourTrain, FiveTrain, SixTrain},
+	'5': {FiveTrain, TwoTrain},
+	'6': {SixTrain, FourTrain, FiveTrain},
+	'7': {SevenTrain},
+	'9': {GSTrain},
+	'A': {ATrain, CTrain, ETrain},
+	'B': {DTrain, BTrain, FTrain, QTrain},
+	'D': {BTrain, DTrain, FTrain, MTrain, QTrain},
+	'E': {ETrain},
+	'F': {FTrain, ETrain, GTrain, MTrain},
+	'G': {GTrain, ETrain, FTrain, MTrain, RTrain},
+	'H': {ATrain},
+	'J': {JTrain, ZTrain},
+	'L': {LTrain},
+	'M': {MTrain, JTrain, ZTrain},
+	'N': {NTrain, WTrain},
+	'Q': {QTrain},
+	'R': {RTrain, NTrain, QTrain, WTrain},
+}
+
+// stationRoutes are the routes serving the shuttle stations, whose lines do
+// not follow from the prefix of their stop IDs. The main route comes first.
+// The other S stops belong to the Staten Island Railway and are left unknown.
+var stationRoutes = map[string][]TrainLine{
+	"901": {GSTrain},
+	"902": {GSTrain},
+	"S01": {FSTrain},
+	"S03": {FSTrain},
+	"S04": {FSTrain},
+	"D26": {BTrain, QTrain, FSTrain},
+	"H04": {ATrain, HTrain},
+	"H12": {HTrain},
+	"H13": {HTrain},
+	"H14": {HTrain},
+	"H15": {HTrain},
+}
+
+// guessRoutes guesses the routes serving stopID from its ID.
+func guessRoutes(stopID string) []TrainLine {
+	if routes, ok := stationRoutes[parentStation(stopID)]; ok {
+		return routes
+	}
+	if stopID == "" {
+		return nil
+	}
+	return prefixRoutes[stopID[0]]
+}
+
+// RouteToLine maps a GTFS route_id to its train line. Express variants such as
+// 6X share the line of the local.
+func RouteToLine(routeID string) TrainLine {
+	return ParseTrainLine(strings.TrimSuffix(routeID, "X"))
+}
+
+// Schedule is the static GTFS data about which lines stop where and when.
+type Schedule struct {
+	// StopRoutes are the lines that stop at each stop, keyed by both the
+	// platform ID (e.g. 635N) and its parent station (635).
+	StopRoutes map[string][]TrainLine
+	// Patterns are the distinct sequences of stations that the trips of each
+	// line stop at, most common first.
+	Patterns map[TrainLine][]*Pattern
+	// trips are the scheduled trips keyed by realtime trip ID, sorted by
+	// static trip ID.
+	trips    map[string][]*scheduledTrip
+	services map[string]*service
+	loc      *time.Location
+}
+
+// Pattern is a sequence of parent station IDs, ordered as a southbound train
+// stops at them.
+type Pattern struct {
+	Stations []string
+	// Trips is the number of scheduled trips that follow the pattern.
+	Trips int
+}
+
+// TripPattern returns the pattern of the trip with the given realtime trip ID
+// running on date, or nil if the trip is not in the schedule. Several static
+// trips share a realtime trip ID, one per service; the first by static trip ID
+// that runs on date is picked, or the first of them all if none does.
+func (s *Schedule) TripPattern(tripID, date string) *Pattern {
+	if s == nil {
+		return nil
+	}
+	trips := s.trips[tripID]
+	if len(trips) == 0 {
+		return nil
+	}
+	for _, trip := range trips {
+		if s.runsOn(trip.serviceID, date) {
+			return trip.pattern
+		}
+	}
+	return trips[0].pattern
+}
+
+// realtimeTripID strips the static trip ID down to the form used by the
+// realtime feeds, e.g. AFA23GEN-1037-Sunday-00_000600_1..S03R to 000600_1..S03R.
+func realtimeTripID(tripID string) string {
+	parts := strings.Split(tripID, "_")
+	if len(parts) < 2 {
+		return tripID
+	}
+	return strings.Join(parts[len(parts)-2:], "_")
+}
+
+// parentStation strips the direction from a platform's stop ID, e.g. L03N to
+// L03. Only the last N or S is the direction; the station ID may end in one too.
+func parentStation(stopID string) string {
+	if strings.HasSuffix(stopID, "N") || strings.HasSuffix(stopID, "S") {
+		return stopID[:len(stopID)-1]
+	}
+	return stopID
+}
+
+// LoadSchedule reads mta/routes.txt, mta/trips.txt and mta/stop_times.txt from
+// fsys. It returns fs.ErrNotExist if the files are not present. The service
+// calendar in mta/calendar.txt and mta/calendar_dates.txt is optional; without
+// it every trip is assumed to run every day.
+func LoadSchedule(fsys fs.FS) (*Schedule, error) {
+	routes := map[string]TrainLine{}
+	err := readCSV(fsys, "mta/routes.txt", []string{"route_id"}, func(row []string) error {
+		if line := RouteToLine(row[0]); line != UnknownTrain {
+			routes[row[0]] = line
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tripLines := map[string]TrainLine{}
+	tripServices := map[string]string{}
+	err = readCSV(fsys, "mta/trips.txt", []string{"route_id", "trip_id", "service_id"}, func(row []string) error {
+		if line, ok := routes[row[0]]; ok {
+			tripLines[row[1]] = line
+			tripServices[row[1]] = row[2]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type stopTime struct {
+		sequence int
+		stopID   string
+		arrival  int
+	}
+	tripStops := map[string][]stopTime{}
+	err = readCSV(fsys, "mta/stop_times.txt", []string{"trip_id", "stop_id", "stop_sequence", "arrival_time"}, func(row []string) error {
+		if _, ok := tripLines[row[0]]; !ok {
+			return nil
+		}
+		sequence, err := strconv.Atoi(row[2])
+		if err != nil {
+			return fmt.Errorf("mta/stop_times.txt: trip %s: invalid stop_sequence %q", row[0], row[2])
+		}
+		// stops without a time are only in the trip for its pattern
+		arrival := -1
+		if strings.TrimSpace(row[3]) != "" {
+			if arrival, err = parseGTFSTime(row[3]); err != nil {
+				return fmt.Errorf("mta/stop_times.txt: trip %s: %w", row[0], err)
+			}
+		}
+		tripStops[row[0]] = append(tripStops[row[0]], stopTime{sequence, row[1], arrival})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := loadCalendar(fsys)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &Schedule{
+		StopRoutes: map[string][]TrainLine{},
+		Patterns:   map[TrainLine][]*Pattern{},
+		trips:      map[string][]*scheduledTrip{},
+		services:   services,
+		loc:        loadAgencyLocation(fsys),
+	}
+	addRoute := func(stopID string, line TrainLine) {
+		if !slices.Contains(schedule.StopRoutes[stopID], line) {
+			schedule.StopRoutes[stopID] = append(schedule.StopRoutes[stopID], line)
+		}
+	}
+	patterns := map[TrainLine]map[string]*Pattern{}
+	for tripID, stops := range tripStops {
+		line := tripLines[tripID]
+		slices.SortFunc(stops, func(a, b stopTime) int {
+			return cmp.Compare(a.sequence, b.sequence)
+		})
+		stations := make([]string, 0, len(stops))
+		trip := &scheduledTrip{tripID: tripID, serviceID: tripServices[tripID]}
+		for _, stop := range stops {
+			if stop.arrival >= 0 {
+				trip.stopTimes = append(trip.stopTimes, scheduledStop{stop.stopID, stop.arrival})
+			}
+			addRoute(stop.stopID, line)
+			parent := parentStation(stop.stopID)
+			if parent != stop.stopID {
+				addRoute(parent, line)
+			}
+			stations = append(stations, parent)
+		}
+		if strings.HasSuffix(stops[0].stopID, "N") {
+			slices.Reverse(stations)
+		}
+
+		key := strings.Join(stations, ",")
+		if patterns[line] == nil {
+			patterns[line] = map[string]*Pattern{}
+		}
+		pattern, ok := patterns[line][key]
+		if !ok {
+			pattern = &Pattern{Stations: stations}
+			patterns[line][key] = pattern
+		}
+		pattern.Trips++
+		trip.pattern = pattern
+		// the same realtime trip ID is used by each service, e.g. on weekdays
+		// and on Saturdays
+		schedule.trips[realtimeTripID(tripID)] = append(schedule.trips[realtimeTripID(tripID)], trip)
+	}
+
+	for _, trips := range schedule.trips {
+		slices.SortFunc(trips, func(a, b *scheduledTrip) int {
+			return strings.Compare(a.tripID, b.tripID)
+		})
+	}
+	for line, byKey := range patterns {
+		linePatterns := slices.Collect(maps.Values(byKey))
+		slices.SortFunc(linePatterns, func(a, b *Pattern) int {
+			if c := cmp.Compare(b.Trips, a.Trips); c != 0 {
+				return c
+			}
+			return slices.Compare(a.Stations, b.Stations)
+		})
+		schedule.Patterns[line] = linePatterns
+	}
+	for _, lines := range schedule.StopRoutes {
+		slices.Sort(lines)
+	}
+	return schedule, nil
+}
+
+// LoadStopRoutes returns the lines that stop at each stop from the static
+// GTFS data in fsys. See LoadSchedule.
+func LoadStopRoutes(fsys fs.FS) (map[string][]TrainLine, error) {
+	schedule, err := LoadSchedule(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return schedule.StopRoutes, nil
+}
+
+// readCSV calls fn with the named columns of each row of a GTFS file.
+func readCSV(fsys fs.FS, name string, columns []string, fn func(row []string) error) error {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	reader := csv.NewReader(fp)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	// some exports start with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = slices.Index(header, column)
+		if indexes[i] < 0 {
+			return fmt.Errorf("%s: missing column %s", name, column)
+		}
+	}
+
+	row := make([]string, len(columns))
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for i, index := range indexes {
+			if index >= len(record) {
+				return fmt.Errorf("%s: row is missing %s", name, columns[i])
+			}
+			row[i] = record[index]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
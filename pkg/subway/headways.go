@@ -0,0 +1,245 @@
+package subway
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+)
+
+const (
+	headwayTable = "subway"
+	routesTag    = api.DataTag("routes")
+	// predictedWindow is how far ahead predicted trains count towards the
+	// predicted headway.
+	predictedWindow = time.Hour
+	// arrivalSlack is how long before its predicted arrival a train that
+	// drops out of the feed is still taken to have arrived, rather than to
+	// have been cancelled or rerouted.
+	arrivalSlack = time.Minute
+)
+
+// HeadwayRecord is how often trains came and were expected at a stop at one
+// point in time.
+type HeadwayRecord struct {
+	Stamp  time.Time
+	StopID string
+	Routes []TrainLine
+	// NextArrival is how long until the next predicted train, or zero if none
+	// was predicted.
+	NextArrival time.Duration
+	// PredictedHeadway is the average gap between the trains predicted within
+	// the next hour, or zero if fewer than two were.
+	PredictedHeadway time.Duration
+	// ObservedHeadway is the longest gap between two trains that arrived since
+	// the previous record, or zero if none did.
+	ObservedHeadway time.Duration
+	// Arrivals is how many trains arrived since the previous record.
+	Arrivals int
+}
+
+// headwayTracker follows the trains predicted at a stop from one record to
+// the next to tell when each of them arrived.
+type headwayTracker struct {
+	mu sync.Mutex
+	// pending is the latest predicted arrival of each trip that has not
+	// arrived yet, and arrived the arrival of each trip that has.
+	pending     map[string]int64
+	arrived     map[string]int64
+	lastArrival int64
+}
+
+// observe updates the tracker with the trips predicted at now. It returns how
+// many trains arrived since the previous call and the gaps between them.
+func (t *headwayTracker) observe(updates []*StopUpdate, now time.Time) (int, []time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := map[string]bool{}
+	for _, update := range updates {
+		if _, ok := t.arrived[update.TripID]; ok || update.TripID == "" || update.ArrivalTime() == 0 {
+			continue
+		}
+		current[update.TripID] = true
+		t.pending[update.TripID] = update.ArrivalTime()
+	}
+
+	arrivals := []int64{}
+	for tripID, arrival := range t.pending {
+		// trains drop out of the feed once they have left the stop
+		if arrival > now.Unix() && current[tripID] {
+			continue
+		}
+		delete(t.pending, tripID)
+		if arrival <= now.Add(arrivalSlack).Unix() {
+			t.arrived[tripID] = arrival
+			arrivals = append(arrivals, arrival)
+		}
+	}
+	slices.Sort(arrivals)
+
+	gaps := []time.Duration{}
+	for _, arrival := range arrivals {
+		if t.lastArrival != 0 && arrival > t.lastArrival {
+			gaps = append(gaps, time.Duration(arrival-t.lastArrival)*time.Second)
+		}
+		t.lastArrival = max(t.lastArrival, arrival)
+	}
+	for tripID, arrival := range t.arrived {
+		if arrival < t.lastArrival-int64(predictedWindow.Seconds()) {
+			delete(t.arrived, tripID)
+		}
+	}
+	return len(arrivals), gaps
+}
+
+// reset forgets the last arrival, since trains may have arrived unseen while
+// the feed could not be read.
+func (t *headwayTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastArrival = 0
+}
+
+// tracker returns the tracker of stopID and routes, which is kept for as long
+// as the client so that the gaps carry over from one provider to the next.
+func (c *ClientImpl) tracker(stopID string, routes []TrainLine) *headwayTracker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := stopID + ":" + joinRoutes(routes)
+	if c.trackers == nil {
+		c.trackers = map[string]*headwayTracker{}
+	}
+	if _, ok := c.trackers[key]; !ok {
+		c.trackers[key] = &headwayTracker{pending: map[string]int64{}, arrived: map[string]int64{}}
+	}
+	return c.trackers[key]
+}
+
+// GetHeadwayProvider returns a provider that records the predicted and the
+// observed gaps between trains at stopID, only counting trains on routes if
+// any are given. The observed gaps are between the trains that arrived since
+// the provider was last called.
+func (c *ClientImpl) GetHeadwayProvider(stopID string, routes []TrainLine) api.ProviderFunc {
+	tracker := c.tracker(stopID, routes)
+	return func(ctx context.Context) (*api.DataPoint, error) {
+		updates, _, err := c.GetTripsAtStop(ctx, stopID)
+		if err != nil {
+			tracker.reset()
+			return nil, err
+		}
+		if len(routes) > 0 {
+			updates = slices.DeleteFunc(slices.Clone(updates), func(u *StopUpdate) bool {
+				return !slices.Contains(routes, u.Line)
+			})
+		}
+		now := c.now()
+		record := HeadwayRecord{Stamp: now, StopID: stopID, Routes: routes}
+
+		predicted := []int64{}
+		for _, update := range updates {
+			if arrival := update.ArrivalTime(); arrival >= now.Unix() && arrival <= now.Add(predictedWindow).Unix() {
+				predicted = append(predicted, arrival)
+			}
+		}
+		if len(predicted) > 0 {
+			record.NextArrival = time.Unix(predicted[0], 0).Sub(now)
+		}
+		if len(predicted) > 1 {
+			record.PredictedHeadway = time.Duration(predicted[len(predicted)-1]-predicted[0]) * time.Second / time.Duration(len(predicted)-1)
+		}
+
+		arrivals, gaps := tracker.observe(updates, now)
+		record.Arrivals = arrivals
+		if len(gaps) > 0 {
+			record.ObservedHeadway = slices.Max(gaps)
+		}
+		slog.Debug("subway headways", "stop", stopID, "record", record)
+
+		return record.dataPoint(), nil
+	}
+}
+
+func (r HeadwayRecord) dataPoint() *api.DataPoint {
+	fields := map[string]any{"arrivals": r.Arrivals}
+	if r.NextArrival > 0 {
+		fields["next_arrival"] = int(r.NextArrival.Seconds())
+	}
+	if r.PredictedHeadway > 0 {
+		fields["predicted_headway"] = int(r.PredictedHeadway.Seconds())
+	}
+	if r.ObservedHeadway > 0 {
+		fields["observed_headway"] = int(r.ObservedHeadway.Seconds())
+	}
+	return &api.DataPoint{
+		Table: headwayTable,
+		Tags: map[api.DataTag]string{
+			api.LocationTag: r.StopID,
+			routesTag:       joinRoutes(r.Routes),
+		},
+		Fields: fields,
+		Stamp:  r.Stamp,
+	}
+}
+
+// GetHeadwayHistory returns the headways recorded at stopID for routes within
+// the last duration, oldest first.
+func (c *ClientImpl) GetHeadwayHistory(ctx context.Context, importer api.Importer, stopID string, routes []TrainLine, duration time.Duration) ([]HeadwayRecord, error) {
+	rows, err := importer.QueryRange(ctx, headwayTable, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []HeadwayRecord{}
+	for _, row := range rows {
+		if row.Tags[api.LocationTag] != stopID || row.Tags[routesTag] != joinRoutes(routes) {
+			continue
+		}
+		results = append(results, HeadwayRecord{
+			Stamp:            row.Stamp,
+			StopID:           stopID,
+			Routes:           routes,
+			NextArrival:      fieldSeconds(row, "next_arrival"),
+			PredictedHeadway: fieldSeconds(row, "predicted_headway"),
+			ObservedHeadway:  fieldSeconds(row, "observed_headway"),
+			Arrivals:         int(fieldNumber(row, "arrivals")),
+		})
+	}
+	slices.SortFunc(results, func(a, b HeadwayRecord) int { return a.Stamp.Compare(b.Stamp) })
+	return results, nil
+}
+
+func fieldSeconds(row *api.DataPoint, name string) time.Duration {
+	return time.Duration(fieldNumber(row, name)) * time.Second
+}
+
+// fieldNumber reads a numeric field, which is an int when it was just recorded
+// and a float64 when it was read back from JSON.
+func fieldNumber(row *api.DataPoint, name string) int64 {
+	switch v := row.Fields[name].(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case nil:
+		return 0
+	default:
+		slog.Warn("unknown subway field type", "field", name, "type", fmt.Sprintf("%T", v))
+		return 0
+	}
+}
+
+func joinRoutes(routes []TrainLine) string {
+	names := []string{}
+	for _, route := range routes {
+		names = append(names, string(route))
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,119 @@
+package subway_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	api "github.com/mpoegel/red-maple/pkg/api"
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// arrivalsFeed is a feed of L trips arriving at L03N, by trip ID.
+func arrivalsFeed(arrivals map[string]int64) *gtfsrt.FeedMessage {
+	feed := &gtfsrt.FeedMessage{Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")}}
+	for tripID, arrival := range arrivals {
+		feed.Entity = append(feed.Entity, &gtfsrt.FeedEntity{
+			Id: proto.String(tripID),
+			TripUpdate: &gtfsrt.TripUpdate{
+				Trip: &gtfsrt.TripDescriptor{TripId: proto.String(tripID), RouteId: proto.String("L")},
+				StopTimeUpdate: []*gtfsrt.TripUpdate_StopTimeUpdate{{
+					StopId:  proto.String("L03N"),
+					Arrival: &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival)},
+				}},
+			},
+		})
+	}
+	return feed
+}
+
+// pointsImporter returns the same points for every query.
+type pointsImporter []*api.DataPoint
+
+func (p pointsImporter) QueryRange(ctx context.Context, table string, duration time.Duration) ([]*api.DataPoint, error) {
+	return p, nil
+}
+
+func TestGetHeadwayProvider(t *testing.T) {
+	now := time.Unix(1000, 0)
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{}, calls: map[string]int{}}
+	client, _ := subway.NewClientWithOptions(
+		subway.WithFeedManager(gtfsrt.NewFeedManager("subway", &http.Client{Transport: ft}, gtfsrt.WithPollInterval(0))),
+		subway.WithFeedURLs(map[subway.TrainLine]string{subway.LTrain: "http://redmaple.tree/feed-l"}),
+		subway.WithClock(func() time.Time { return now }),
+	)
+	provider := client.GetHeadwayProvider("L03N", []subway.TrainLine{subway.LTrain})
+
+	record := func(arrivals map[string]int64) map[string]any {
+		t.Helper()
+		ft.feeds["http://redmaple.tree/feed-l"] = arrivalsFeed(arrivals)
+		point, err := provider(t.Context())
+		if err != nil {
+			t.Fatalf("provider error: %v", err)
+		}
+		if point.Table != "subway" || point.Tags[api.LocationTag] != "L03N" || point.Tags["routes"] != "L" {
+			t.Errorf("unexpected data point: %+v", point)
+		}
+		return point.Fields
+	}
+
+	fields := record(map[string]int64{"A": 1060, "B": 1300, "C": 1600})
+	if fields["next_arrival"] != 60 || fields["predicted_headway"] != 270 || fields["arrivals"] != 0 {
+		t.Errorf("unexpected predictions: %v", fields)
+	}
+	if _, ok := fields["observed_headway"]; ok {
+		t.Errorf("expected no observed headway before any train arrived, got %v", fields)
+	}
+
+	// A has left the stop, and E will be cancelled
+	now = time.Unix(1120, 0)
+	fields = record(map[string]int64{"B": 1300, "C": 1600, "E": 3000})
+	if fields["arrivals"] != 1 {
+		t.Errorf("expected A to have arrived, got %v", fields)
+	}
+	if _, ok := fields["observed_headway"]; ok {
+		t.Errorf("expected no observed headway after the first train, got %v", fields)
+	}
+
+	now = time.Unix(1400, 0)
+	fields = record(map[string]int64{"B": 1300, "C": 1650, "D": 2000})
+	if fields["arrivals"] != 1 || fields["observed_headway"] != 240 {
+		t.Errorf("expected B to arrive 4 minutes after A, got %v", fields)
+	}
+
+	// B is still in the feed, but has already been counted
+	now = time.Unix(1700, 0)
+	fields = record(map[string]int64{"B": 1300, "D": 2000})
+	if fields["arrivals"] != 1 || fields["observed_headway"] != 350 {
+		t.Errorf("expected only C to arrive, got %v", fields)
+	}
+}
+
+func TestGetHeadwayHistory(t *testing.T) {
+	client, _ := subway.NewClientWithOptions()
+	importer := pointsImporter{
+		{Table: "subway", Tags: map[api.DataTag]string{api.LocationTag: "G29N", "routes": ""}, Stamp: time.Unix(2000, 0),
+			Fields: map[string]any{"arrivals": 2.0, "observed_headway": 720.0, "predicted_headway": 480.0}},
+		{Table: "subway", Tags: map[api.DataTag]string{api.LocationTag: "G29N", "routes": ""}, Stamp: time.Unix(1000, 0),
+			Fields: map[string]any{"arrivals": 0.0, "next_arrival": 90.0}},
+		{Table: "subway", Tags: map[api.DataTag]string{api.LocationTag: "L03N", "routes": ""}, Stamp: time.Unix(1000, 0),
+			Fields: map[string]any{"arrivals": 1.0}},
+	}
+
+	history, err := client.GetHeadwayHistory(t.Context(), importer, "G29N", nil, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("GetHeadwayHistory error: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 records at G29N, got %d", len(history))
+	}
+	if history[0].NextArrival != 90*time.Second || history[0].ObservedHeadway != 0 {
+		t.Errorf("unexpected first record: %+v", history[0])
+	}
+	if history[1].ObservedHeadway != 12*time.Minute || history[1].PredictedHeadway != 8*time.Minute || history[1].Arrivals != 2 {
+		t.Errorf("unexpected second record: %+v", history[1])
+	}
+}
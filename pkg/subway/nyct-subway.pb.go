@@ -7,6 +7,7 @@
 package subway
 
 import (
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
@@ -92,7 +93,7 @@ type TripReplacementPeriod struct {
 	RouteId *string `protobuf:"bytes,1,opt,name=route_id,json=routeId" json:"route_id,omitempty"`
 	// The start time is omitted, the end time is currently now + 30 minutes for
 	// all routes of the A division
-	ReplacementPeriod *TimeRange `protobuf:"bytes,2,opt,name=replacement_period,json=replacementPeriod" json:"replacement_period,omitempty"`
+	ReplacementPeriod *gtfsrt.TimeRange `protobuf:"bytes,2,opt,name=replacement_period,json=replacementPeriod" json:"replacement_period,omitempty"`
 }
 
 func (x *TripReplacementPeriod) Reset() {
@@ -132,7 +133,7 @@ func (x *TripReplacementPeriod) GetRouteId() string {
 	return ""
 }
 
-func (x *TripReplacementPeriod) GetReplacementPeriod() *TimeRange {
+func (x *TripReplacementPeriod) GetReplacementPeriod() *gtfsrt.TimeRange {
 	if x != nil {
 		return x.ReplacementPeriod
 	}
@@ -390,7 +391,7 @@ func (x *NyctStopTimeUpdate) GetActualTrack() string {
 
 var file_nyct_subway_proto_extTypes = []protoimpl.ExtensionInfo{
 	{
-		ExtendedType:  (*FeedHeader)(nil),
+		ExtendedType:  (*gtfsrt.FeedHeader)(nil),
 		ExtensionType: (*NyctFeedHeader)(nil),
 		Field:         1001,
 		Name:          "nyct_feed_header",
@@ -398,7 +399,7 @@ var file_nyct_subway_proto_extTypes = []protoimpl.ExtensionInfo{
 		Filename:      "nyct-subway.proto",
 	},
 	{
-		ExtendedType:  (*TripDescriptor)(nil),
+		ExtendedType:  (*gtfsrt.TripDescriptor)(nil),
 		ExtensionType: (*NyctTripDescriptor)(nil),
 		Field:         1001,
 		Name:          "nyct_trip_descriptor",
@@ -406,7 +407,7 @@ var file_nyct_subway_proto_extTypes = []protoimpl.ExtensionInfo{
 		Filename:      "nyct-subway.proto",
 	},
 	{
-		ExtendedType:  (*TripUpdate_StopTimeUpdate)(nil),
+		ExtendedType:  (*gtfsrt.TripUpdate_StopTimeUpdate)(nil),
 		ExtensionType: (*NyctStopTimeUpdate)(nil),
 		Field:         1001,
 		Name:          "nyct_stop_time_update",
@@ -415,19 +416,19 @@ var file_nyct_subway_proto_extTypes = []protoimpl.ExtensionInfo{
 	},
 }
 
-// Extension fields to FeedHeader.
+// Extension fields to gtfsrt.FeedHeader.
 var (
 	// optional NyctFeedHeader nyct_feed_header = 1001;
 	E_NyctFeedHeader = &file_nyct_subway_proto_extTypes[0]
 )
 
-// Extension fields to TripDescriptor.
+// Extension fields to gtfsrt.TripDescriptor.
 var (
 	// optional NyctTripDescriptor nyct_trip_descriptor = 1001;
 	E_NyctTripDescriptor = &file_nyct_subway_proto_extTypes[1]
 )
 
-// Extension fields to TripUpdate_StopTimeUpdate.
+// Extension fields to gtfsrt.TripUpdate_StopTimeUpdate.
 var (
 	// optional NyctStopTimeUpdate nyct_stop_time_update = 1001;
 	E_NyctStopTimeUpdate = &file_nyct_subway_proto_extTypes[2]
@@ -516,15 +517,15 @@ func file_nyct_subway_proto_rawDescGZIP() []byte {
 var file_nyct_subway_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_nyct_subway_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
 var file_nyct_subway_proto_goTypes = []any{
-	(NyctTripDescriptor_Direction)(0), // 0: NyctTripDescriptor.Direction
-	(*TripReplacementPeriod)(nil),     // 1: TripReplacementPeriod
-	(*NyctFeedHeader)(nil),            // 2: NyctFeedHeader
-	(*NyctTripDescriptor)(nil),        // 3: NyctTripDescriptor
-	(*NyctStopTimeUpdate)(nil),        // 4: NyctStopTimeUpdate
-	(*TimeRange)(nil),                 // 5: transit_realtime.TimeRange
-	(*FeedHeader)(nil),                // 6: transit_realtime.FeedHeader
-	(*TripDescriptor)(nil),            // 7: transit_realtime.TripDescriptor
-	(*TripUpdate_StopTimeUpdate)(nil), // 8: transit_realtime.TripUpdate.StopTimeUpdate
+	(NyctTripDescriptor_Direction)(0),        // 0: NyctTripDescriptor.Direction
+	(*TripReplacementPeriod)(nil),            // 1: TripReplacementPeriod
+	(*NyctFeedHeader)(nil),                   // 2: NyctFeedHeader
+	(*NyctTripDescriptor)(nil),               // 3: NyctTripDescriptor
+	(*NyctStopTimeUpdate)(nil),               // 4: NyctStopTimeUpdate
+	(*gtfsrt.TimeRange)(nil),                 // 5: transit_realtime.TimeRange
+	(*gtfsrt.FeedHeader)(nil),                // 6: transit_realtime.FeedHeader
+	(*gtfsrt.TripDescriptor)(nil),            // 7: transit_realtime.TripDescriptor
+	(*gtfsrt.TripUpdate_StopTimeUpdate)(nil), // 8: transit_realtime.TripUpdate.StopTimeUpdate
 }
 var file_nyct_subway_proto_depIdxs = []int32{
 	5, // 0: TripReplacementPeriod.replacement_period:type_name -> transit_realtime.TimeRange
@@ -548,7 +549,6 @@ func file_nyct_subway_proto_init() {
 	if File_nyct_subway_proto != nil {
 		return
 	}
-	file_gtfs_realtime_proto_init()
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
@@ -0,0 +1,63 @@
+package subway
+
+import (
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	proto "google.golang.org/protobuf/proto"
+)
+
+// NyctTrip is the NYCT extension of a trip, empty if the feed does not have it.
+type NyctTrip struct {
+	// TrainID identifies the physical train, e.g. "06 0123+ PEL/BBR".
+	TrainID string
+	// Direction is the direction the train is moving, or 0 if not given.
+	Direction NyctTripDescriptor_Direction
+	// IsAssigned is true once a train has been assigned to the trip. Trips
+	// that are not assigned yet are only scheduled and may not run.
+	IsAssigned bool
+}
+
+// NyctTrack is the NYCT extension of a stop time update.
+type NyctTrack struct {
+	// ScheduledTrack is the track the train is scheduled to stop at.
+	ScheduledTrack string
+	// ActualTrack is the track the train is using, if it is known.
+	ActualTrack string
+}
+
+// IsRerouted reports whether the train is using a track other than the one
+// it is scheduled for, e.g. running on the express track.
+func (t NyctTrack) IsRerouted() bool {
+	return t.ActualTrack != "" && t.ScheduledTrack != "" && t.ActualTrack != t.ScheduledTrack
+}
+
+// Track returns the actual track if it is known, and the scheduled track
+// otherwise.
+func (t NyctTrack) Track() string {
+	if t.ActualTrack != "" {
+		return t.ActualTrack
+	}
+	return t.ScheduledTrack
+}
+
+func nyctTrip(trip *gtfsrt.TripDescriptor) NyctTrip {
+	if trip == nil || !proto.HasExtension(trip, E_NyctTripDescriptor) {
+		return NyctTrip{}
+	}
+	ext, _ := proto.GetExtension(trip, E_NyctTripDescriptor).(*NyctTripDescriptor)
+	return NyctTrip{
+		TrainID:    ext.GetTrainId(),
+		Direction:  ext.GetDirection(),
+		IsAssigned: ext.GetIsAssigned(),
+	}
+}
+
+func nyctTrack(update *gtfsrt.TripUpdate_StopTimeUpdate) NyctTrack {
+	if update == nil || !proto.HasExtension(update, E_NyctStopTimeUpdate) {
+		return NyctTrack{}
+	}
+	ext, _ := proto.GetExtension(update, E_NyctStopTimeUpdate).(*NyctStopTimeUpdate)
+	return NyctTrack{
+		ScheduledTrack: ext.GetScheduledTrack(),
+		ActualTrack:    ext.GetActualTrack(),
+	}
+}
@@ -0,0 +1,266 @@
+package subway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotLayout names each recorded snapshot by the time it was downloaded,
+// so that the files of a feed sort in the order they were recorded.
+const snapshotLayout = "20060102T150405.000Z"
+
+// FeedRecorder saves the raw bytes of every feed a gtfsrt.FeedManager downloads, as
+// <dir>/<feed name>/<time>.pb, so that they can be replayed by a FeedReplay.
+type FeedRecorder struct {
+	dir       string
+	retention time.Duration
+}
+
+type FeedRecorderOption func(*FeedRecorder)
+
+// WithRecordRetention deletes the snapshots of a feed once they were recorded
+// more than d before its latest one. A retention of 0 keeps every snapshot.
+func WithRecordRetention(d time.Duration) FeedRecorderOption {
+	return func(r *FeedRecorder) {
+		r.retention = d
+	}
+}
+
+func NewFeedRecorder(dir string, opts ...FeedRecorderOption) *FeedRecorder {
+	r := &FeedRecorder{dir: dir}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Record saves body as the snapshot of the feed at feedURL downloaded at t,
+// and deletes the snapshots of the feed that are past the retention.
+func (r *FeedRecorder) Record(feedURL string, body []byte, t time.Time) error {
+	dir := filepath.Join(r.dir, FeedName(feedURL))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, t.UTC().Format(snapshotLayout)+".pb"), body, 0o644); err != nil {
+		return err
+	}
+	if r.retention > 0 {
+		return prune(dir, t.Add(-r.retention))
+	}
+	return nil
+}
+
+// prune deletes the snapshots in dir recorded before cutoff.
+func prune(dir string, cutoff time.Time) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		recordedAt, err := time.Parse(snapshotLayout, strings.TrimSuffix(file.Name(), ".pb"))
+		if err != nil || file.IsDir() || !recordedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FeedName names a feed by the last segment of its URL, e.g. "nyct-gtfs-ace"
+// for the A, C and E feed.
+func FeedName(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return "feed"
+	}
+	name, err := url.PathUnescape(path.Base(u.EscapedPath()))
+	if err != nil || name == "/" || name == "." {
+		return u.Host
+	}
+	return strings.ReplaceAll(name, "/", "-")
+}
+
+// FeedReplay serves the snapshots saved by a FeedRecorder back in the order
+// they were recorded. The replay starts at the first snapshot, and every
+// request for a feed gets the snapshot that was the latest one at that point
+// of the recording. Feeds keep their first snapshot until then, and their last
+// one once the recording is over.
+//
+// FeedReplay is an http.RoundTripper that answers requests for the original
+// feed URLs, and an http.Handler that serves each feed at /<feed name>.
+type FeedReplay struct {
+	snapshots map[string][]snapshot
+	start     time.Time
+	speed     float64
+	now       func() time.Time
+
+	once      sync.Once
+	startedAt time.Time
+}
+
+type snapshot struct {
+	path       string
+	recordedAt time.Time
+}
+
+var (
+	_ http.RoundTripper = (*FeedReplay)(nil)
+	_ http.Handler      = (*FeedReplay)(nil)
+)
+
+type FeedReplayOption func(*FeedReplay)
+
+// WithReplayStart starts the replay at t instead of at the first snapshot.
+func WithReplayStart(t time.Time) FeedReplayOption {
+	return func(r *FeedReplay) {
+		r.start = t
+	}
+}
+
+// WithReplaySpeed plays the recording speed times faster than it was recorded.
+func WithReplaySpeed(speed float64) FeedReplayOption {
+	return func(r *FeedReplay) {
+		r.speed = speed
+	}
+}
+
+func WithReplayClock(now func() time.Time) FeedReplayOption {
+	return func(r *FeedReplay) {
+		r.now = now
+	}
+}
+
+// OpenFeedReplay reads the snapshots recorded in dir.
+func OpenFeedReplay(dir string, opts ...FeedReplayOption) (*FeedReplay, error) {
+	r := &FeedReplay{
+		snapshots: map[string][]snapshot{},
+		speed:     1,
+		now:       time.Now,
+	}
+	feeds, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, feed := range feeds {
+		if !feed.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, feed.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			recordedAt, err := time.Parse(snapshotLayout, strings.TrimSuffix(file.Name(), ".pb"))
+			if err != nil || file.IsDir() {
+				slog.Debug("skipping file that is not a feed snapshot", "feed", feed.Name(), "file", file.Name())
+				continue
+			}
+			r.snapshots[feed.Name()] = append(r.snapshots[feed.Name()], snapshot{
+				path:       filepath.Join(dir, feed.Name(), file.Name()),
+				recordedAt: recordedAt,
+			})
+			if r.start.IsZero() || recordedAt.Before(r.start) {
+				r.start = recordedAt
+			}
+		}
+	}
+	if len(r.snapshots) == 0 {
+		return nil, fmt.Errorf("no feed snapshots in %s", dir)
+	}
+	for _, snapshots := range r.snapshots {
+		slices.SortFunc(snapshots, func(a, b snapshot) int { return a.recordedAt.Compare(b.recordedAt) })
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r, nil
+}
+
+// Now returns the point of the recording the replay is at. The replay starts
+// with the first request, or the first call to Now.
+func (r *FeedReplay) Now() time.Time {
+	r.once.Do(func() {
+		r.startedAt = r.now()
+	})
+	elapsed := float64(r.now().Sub(r.startedAt)) * r.speed
+	return r.start.Add(time.Duration(elapsed))
+}
+
+// FeedURLs returns the URL of each line's feed on a server at baseURL that
+// serves r, for use with WithFeedURLs.
+func (r *FeedReplay) FeedURLs(baseURL string) map[TrainLine]string {
+	urls := map[TrainLine]string{}
+	for line, feedURL := range feedUrls {
+		urls[line] = strings.TrimSuffix(baseURL, "/") + "/" + FeedName(feedURL)
+	}
+	return urls
+}
+
+// read returns the snapshot of the named feed at the current point of the
+// replay and when it was recorded.
+func (r *FeedReplay) read(name string) ([]byte, time.Time, error) {
+	snapshots, ok := r.snapshots[name]
+	if !ok {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	now := r.Now()
+	i, _ := slices.BinarySearchFunc(snapshots, now, func(s snapshot, t time.Time) int {
+		if s.recordedAt.After(t) {
+			return 1
+		}
+		return -1
+	})
+	current := snapshots[max(i-1, 0)]
+	body, err := os.ReadFile(current.path)
+	return body, current.recordedAt, err
+}
+
+func (r *FeedReplay) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, recordedAt, err := r.read(FeedName(req.URL.String()))
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+	switch {
+	case os.IsNotExist(err):
+		res.StatusCode = http.StatusNotFound
+	case err != nil:
+		return nil, err
+	default:
+		res.ContentLength = int64(len(body))
+		res.Header.Set("Last-Modified", recordedAt.Format(http.TimeFormat))
+	}
+	res.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	return res, nil
+}
+
+func (r *FeedReplay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, recordedAt, err := r.read(path.Base(req.URL.Path))
+	if os.IsNotExist(err) {
+		http.NotFound(w, req)
+		return
+	} else if err != nil {
+		slog.Error("failed to read feed snapshot", "feed", req.URL.Path, "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Last-Modified", recordedAt.Format(http.TimeFormat))
+	w.Write(body)
+}
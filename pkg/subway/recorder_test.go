@@ -0,0 +1,166 @@
+package subway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+)
+
+const lFeedURL = "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-l"
+
+func TestFeedName(t *testing.T) {
+	tests := map[string]string{
+		lFeedURL: "nyct-gtfs-l",
+		"https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs": "nyct-gtfs",
+		"http://redmaple.tree/feeds/ferry?key=1":                             "ferry",
+		"http://redmaple.tree/":                                              "redmaple.tree",
+	}
+	for url, want := range tests {
+		if got := subway.FeedName(url); got != want {
+			t.Errorf("FeedName(%q) = %q, expected %q", url, got, want)
+		}
+	}
+}
+
+// recordFeeds records the L feed twice, 30 seconds apart, with the train
+// arriving at 1000 and then at 1100.
+func recordFeeds(t *testing.T, start time.Time) string {
+	t.Helper()
+	dir := t.TempDir()
+	now := start
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{lFeedURL: tripFeed("L", 1000, "L03N")}, calls: map[string]int{}}
+	feeds := gtfsrt.NewFeedManager("subway", &http.Client{Transport: ft},
+		gtfsrt.WithFeedRecorder(subway.NewFeedRecorder(dir)),
+		gtfsrt.WithFeedClock(func() time.Time { return now }),
+	)
+	if _, err := feeds.Get(t.Context(), lFeedURL); err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	ft.feeds[lFeedURL] = tripFeed("L", 1100, "L03N")
+	if _, err := feeds.Get(t.Context(), lFeedURL); err != nil {
+		t.Fatalf("Get error: %v", err)
+	}
+	return dir
+}
+
+func TestFeedRecorder(t *testing.T) {
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	dir := recordFeeds(t, start)
+
+	files, err := os.ReadDir(filepath.Join(dir, "nyct-gtfs-l"))
+	if err != nil {
+		t.Fatalf("expected the feed to be recorded: %v", err)
+	}
+	if len(files) != 2 || files[0].Name() != "20261016T080000.000Z.pb" || files[1].Name() != "20261016T080030.000Z.pb" {
+		t.Errorf("expected a snapshot per download, got %v", files)
+	}
+}
+
+func TestFeedRecorderRetention(t *testing.T) {
+	dir := t.TempDir()
+	recorder := subway.NewFeedRecorder(dir, subway.WithRecordRetention(time.Minute))
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		if err := recorder.Record(lFeedURL, []byte("feed"), start.Add(time.Duration(i)*30*time.Second)); err != nil {
+			t.Fatalf("Record error: %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(filepath.Join(dir, "nyct-gtfs-l"))
+	if err != nil {
+		t.Fatalf("ReadDir error: %v", err)
+	}
+	if len(files) != 3 || files[0].Name() != "20261016T080030.000Z.pb" {
+		t.Errorf("expected the snapshots of the last minute, got %v", files)
+	}
+}
+
+func TestFeedReplay(t *testing.T) {
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	dir := recordFeeds(t, start)
+
+	now := time.Now()
+	replay, err := subway.OpenFeedReplay(dir, subway.WithReplayClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("OpenFeedReplay error: %v", err)
+	}
+	if !replay.Now().Equal(start) {
+		t.Errorf("expected the replay to start at %v, got %v", start, replay.Now())
+	}
+	client, _ := subway.NewClientWithOptions(
+		subway.WithFeedManager(gtfsrt.NewFeedManager("subway", &http.Client{Transport: replay}, gtfsrt.WithPollInterval(0))),
+		subway.WithClock(replay.Now),
+	)
+
+	arrival := func() int64 {
+		t.Helper()
+		feed, err := client.GetFeed(t.Context(), subway.LTrain)
+		if err != nil {
+			t.Fatalf("GetFeed error: %v", err)
+		}
+		return feed.Entity[0].TripUpdate.StopTimeUpdate[0].Arrival.GetTime()
+	}
+	if got := arrival(); got != 1000 {
+		t.Errorf("expected the first snapshot, got arrival %d", got)
+	}
+	now = now.Add(29 * time.Second)
+	if got := arrival(); got != 1000 {
+		t.Errorf("expected the first snapshot until the second was recorded, got arrival %d", got)
+	}
+	now = now.Add(time.Second)
+	if got := arrival(); got != 1100 {
+		t.Errorf("expected the second snapshot, got arrival %d", got)
+	}
+	now = now.Add(time.Hour)
+	if got := arrival(); got != 1100 {
+		t.Errorf("expected the last snapshot after the recording, got arrival %d", got)
+	}
+
+	if _, err := client.GetFeed(t.Context(), subway.GTrain); err == nil {
+		t.Error("expected an error for a feed that was not recorded")
+	}
+}
+
+func TestFeedReplay_ServeHTTP(t *testing.T) {
+	dir := recordFeeds(t, time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC))
+	replay, err := subway.OpenFeedReplay(dir, subway.WithReplaySpeed(60))
+	if err != nil {
+		t.Fatalf("OpenFeedReplay error: %v", err)
+	}
+	server := httptest.NewServer(replay)
+	defer server.Close()
+
+	client, _ := subway.NewClientWithOptions(
+		subway.WithHTTPClient(server.Client()),
+		subway.WithFeedURLs(replay.FeedURLs(server.URL)),
+	)
+	feed, err := client.GetFeed(t.Context(), subway.LTrain)
+	if err != nil {
+		t.Fatalf("GetFeed error: %v", err)
+	}
+	if len(feed.Entity) != 1 {
+		t.Errorf("expected the recorded trip, got %v", feed.Entity)
+	}
+
+	resp, err := http.Get(server.URL + "/nyct-gtfs-g")
+	if err != nil {
+		t.Fatalf("GET error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for a feed that was not recorded, got %d", resp.StatusCode)
+	}
+}
+
+func TestOpenFeedReplay_Empty(t *testing.T) {
+	if _, err := subway.OpenFeedReplay(t.TempDir()); err == nil {
+		t.Error("expected an error for a directory without recordings")
+	}
+}
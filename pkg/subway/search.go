@@ -0,0 +1,206 @@
+package subway
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const earthRadiusMeters = 6371000
+
+// Station is a parent station from stops.txt with the lines serving it and
+// its platform for each direction.
+type Station struct {
+	SubwayStop
+	Routes      []TrainLine
+	NorthStopID string
+	SouthStopID string
+	// Distance is how far the station is from the searched location, in
+	// meters. It is only set by NearestStations.
+	Distance float64
+}
+
+// SearchStations returns up to limit stations whose names match query, best
+// match first. Matching ignores case and punctuation, accepts abbreviations
+// such as "st" for "street" and forgives small typos.
+func (c *ClientImpl) SearchStations(query string, limit int) []Station {
+	queryTokens := nameTokens(query)
+	if len(queryTokens) == 0 {
+		return []Station{}
+	}
+
+	type match struct {
+		station Station
+		score   float64
+		extra   int
+	}
+	matches := []match{}
+	for _, station := range c.stations() {
+		tokens := nameTokens(station.Name)
+		score := 0.0
+		for _, queryToken := range queryTokens {
+			best := 0.0
+			for _, token := range tokens {
+				best = max(best, tokenScore(queryToken, token))
+			}
+			if best == 0 {
+				score = 0
+				break
+			}
+			score += best
+		}
+		if score > 0 {
+			matches = append(matches, match{station, score / float64(len(queryTokens)), len(tokens) - len(queryTokens)})
+		}
+	}
+	slices.SortFunc(matches, func(a, b match) int {
+		return cmp.Or(
+			cmp.Compare(b.score, a.score),
+			// prefer names with fewer words the query did not ask for
+			cmp.Compare(a.extra, b.extra),
+			strings.Compare(a.station.Name, b.station.Name),
+			strings.Compare(a.station.ID, b.station.ID),
+		)
+	})
+
+	res := []Station{}
+	for _, m := range matches[:min(limit, len(matches))] {
+		res = append(res, m.station)
+	}
+	return res
+}
+
+// NearestStations returns up to limit stations closest to lat, lon.
+func (c *ClientImpl) NearestStations(lat, lon float64, limit int) []Station {
+	stations := c.stations()
+	for i := range stations {
+		stations[i].Distance = distance(lat, lon, stations[i].Latitude, stations[i].Longitude)
+	}
+	slices.SortFunc(stations, func(a, b Station) int {
+		return cmp.Or(cmp.Compare(a.Distance, b.Distance), strings.Compare(a.ID, b.ID))
+	})
+	return stations[:min(limit, len(stations))]
+}
+
+func (c *ClientImpl) stations() []Station {
+	stations := []Station{}
+	for _, stop := range c.stopMap {
+		if stop.LocationType != RootStationType {
+			continue
+		}
+		station := Station{SubwayStop: stop, Routes: slices.Clone(c.LinesAtStop(stop.ID))}
+		if _, ok := c.stopMap[stop.ID+"N"]; ok {
+			station.NorthStopID = stop.ID + "N"
+		}
+		if _, ok := c.stopMap[stop.ID+"S"]; ok {
+			station.SouthStopID = stop.ID + "S"
+		}
+		if station.Routes == nil {
+			station.Routes = []TrainLine{}
+		}
+		stations = append(stations, station)
+	}
+	return stations
+}
+
+// abbreviations are the forms that station names use for common words.
+var abbreviations = map[string]string{
+	"street":    "st",
+	"avenue":    "av",
+	"ave":       "av",
+	"road":      "rd",
+	"boulevard": "blvd",
+	"parkway":   "pkwy",
+	"square":    "sq",
+	"center":    "ctr",
+	"heights":   "hts",
+	"junction":  "jct",
+	"place":     "pl",
+	"east":      "e",
+	"west":      "w",
+	"north":     "n",
+	"south":     "s",
+}
+
+// nameTokens splits a station name into lowercase words without punctuation,
+// abbreviating common words and dropping ordinal suffixes, so that "14th
+// Street" and "14 St" have the same tokens.
+func nameTokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := []string{}
+	for _, field := range fields {
+		if abbreviation, ok := abbreviations[field]; ok {
+			field = abbreviation
+		}
+		if trimmed := strings.TrimRight(field, "stndrh"); trimmed != field && trimmed != "" && isDigits(trimmed) {
+			field = trimmed
+		}
+		tokens = append(tokens, field)
+	}
+	return tokens
+}
+
+func isDigits(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+}
+
+// tokenScore rates how well a query word matches a word of a station name,
+// from 0 for no match to 1 for the same word.
+func tokenScore(query, token string) float64 {
+	switch {
+	case query == token:
+		return 1
+	case isDigits(query) || isDigits(token):
+		// 14 St must not match 145 St
+		return 0
+	case strings.HasPrefix(token, query):
+		return 0.8
+	case len(query) >= 4 && editDistance(query, token) <= 1:
+		return 0.6
+	case len(query) >= 7 && editDistance(query, token) <= 2:
+		return 0.4
+	default:
+		return 0
+	}
+}
+
+// editDistance is the number of single letter insertions, deletions,
+// substitutions and swaps of adjacent letters that turn a into b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// distance is the great-circle distance between two points, in meters.
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
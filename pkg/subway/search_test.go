@@ -0,0 +1,88 @@
+package subway_test
+
+import (
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+)
+
+var searchFS = fstest.MapFS{
+	"mta/stops.txt": &fstest.MapFile{Data: []byte("stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+		"635,14 St-Union Sq,40.734673,-73.989951,1,\n" +
+		"635N,14 St-Union Sq,40.734673,-73.989951,0,635\n" +
+		"635S,14 St-Union Sq,40.734673,-73.989951,0,635\n" +
+		"A12,145 St,40.824783,-73.944216,1,\n" +
+		"F07,Union Tpke,40.718331,-73.837324,1,\n" +
+		"L08,Bedford Av,40.717304,-73.956872,1,\n" +
+		"L08N,Bedford Av,40.717304,-73.956872,0,L08\n" +
+		"L08S,Bedford Av,40.717304,-73.956872,0,L08\n" +
+		"L10,Graham Av,40.714565,-73.944053,1,\n")},
+}
+
+func stationNames(stations []subway.Station) []string {
+	names := []string{}
+	for _, station := range stations {
+		names = append(names, station.Name)
+	}
+	return names
+}
+
+func TestSearchStations(t *testing.T) {
+	client, err := subway.NewClientFromFS(searchFS)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"union square", []string{"14 St-Union Sq"}},
+		{"14th Street", []string{"14 St-Union Sq"}},
+		{"union", []string{"Union Tpke", "14 St-Union Sq"}},
+		{"bedfrod", []string{"Bedford Av"}},
+		{"av", []string{"Bedford Av", "Graham Av"}},
+		{"times sq", []string{}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if got := stationNames(client.SearchStations(tt.query, 10)); !slices.Equal(got, tt.want) {
+				t.Errorf("SearchStations(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+
+	stations := client.SearchStations("union sq", 1)
+	if len(stations) != 1 {
+		t.Fatalf("expected 1 station, got %d", len(stations))
+	}
+	got := stations[0]
+	if got.ID != "635" || got.NorthStopID != "635N" || got.SouthStopID != "635S" {
+		t.Errorf("expected 635 with platforms 635N and 635S, got %+v", got)
+	}
+	if !slices.Equal(got.Routes, []subway.TrainLine{subway.SixTrain, subway.FourTrain, subway.FiveTrain}) {
+		t.Errorf("expected the routes guessed from the stop ID, got %v", got.Routes)
+	}
+}
+
+func TestNearestStations(t *testing.T) {
+	client, err := subway.NewClientFromFS(searchFS)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	// N 7 St & Berry St, between Bedford Av and Graham Av
+	stations := client.NearestStations(40.7195, -73.9585, 2)
+	if got, want := stationNames(stations), []string{"Bedford Av", "Graham Av"}; !slices.Equal(got, want) {
+		t.Fatalf("NearestStations = %v, want %v", got, want)
+	}
+	if stations[0].Distance < 250 || stations[0].Distance > 300 {
+		t.Errorf("expected Bedford Av about 280m away, got %.0fm", stations[0].Distance)
+	}
+	if stations[1].Distance <= stations[0].Distance {
+		t.Errorf("expected stations ordered by distance, got %v", stations)
+	}
+}
@@ -0,0 +1,92 @@
+package subway_test
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	subway "github.com/mpoegel/red-maple/pkg/subway"
+)
+
+func TestRouteToLine_Shuttles(t *testing.T) {
+	tests := map[string]subway.TrainLine{
+		"GS": subway.GSTrain,
+		"FS": subway.FSTrain,
+		"H":  subway.HTrain,
+		"S":  subway.GSTrain,
+		"6X": subway.SixTrain,
+	}
+	for routeID, want := range tests {
+		if got := subway.RouteToLine(routeID); got != want {
+			t.Errorf("RouteToLine(%q) = %v, want %v", routeID, got, want)
+		}
+	}
+}
+
+func TestShuttleStops(t *testing.T) {
+	fsys := fstest.MapFS{"mta/stops.txt": &fstest.MapFile{Data: []byte(
+		"stop_id,stop_name,stop_lat,stop_lon,location_type,parent_station\n" +
+			"901,Grand Central-42 St,40.752769,-73.979189,1,\n" +
+			"901S,Grand Central-42 St,40.752769,-73.979189,,901\n" +
+			"902,Times Sq-42 St,40.755983,-73.986229,1,\n" +
+			"902N,Times Sq-42 St,40.755983,-73.986229,,902\n" +
+			"G29,Metropolitan Av,40.712792,-73.951418,1,\n" +
+			"S01,Franklin Av,40.680596,-73.955827,1,\n" +
+			"S09,Tottenville,40.512764,-74.251961,1,\n" +
+			"H12,Beach 90 St,40.588034,-73.813641,1,\n" +
+			"H11,Far Rockaway-Mott Av,40.603995,-73.755405,1,\n")}}
+	gsFeed := tripFeed("GS", 1700000000, "902S", "901S")
+	ft := &feedTransport{
+		feeds: map[string]*gtfsrt.FeedMessage{"http://redmaple.tree/gtfs": gsFeed},
+		calls: map[string]int{},
+	}
+	client, err := subway.NewClientFromFS(fsys,
+		subway.WithHTTPClient(&http.Client{Transport: ft}),
+		subway.WithFeedURLs(map[subway.TrainLine]string{
+			subway.GSTrain: "http://redmaple.tree/gtfs",
+			subway.FSTrain: "http://redmaple.tree/gtfs-bdfm",
+			subway.HTrain:  "http://redmaple.tree/gtfs-ace",
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewClientFromFS error: %v", err)
+	}
+
+	stops, err := client.GetStopsOnLine(t.Context(), subway.GSTrain)
+	if err != nil {
+		t.Fatalf("GetStopsOnLine error: %v", err)
+	}
+	ids := []string{}
+	for _, stop := range stops {
+		ids = append(ids, stop.ID)
+	}
+	slices.Sort(ids)
+	// the G's stations start with G, but are not on the 42 St Shuttle
+	if want := []string{"901", "901S", "902", "902N"}; !slices.Equal(ids, want) {
+		t.Errorf("expected the 42 St Shuttle stops %v, got %v", want, ids)
+	}
+
+	updates, _, err := client.GetTripsAtStop(t.Context(), "901S")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(updates) != 1 || updates[0].Line != subway.GSTrain {
+		t.Errorf("expected a 42 St Shuttle at 901S, got %v", updates)
+	}
+	if ft.calls["http://redmaple.tree/gtfs-bdfm"] != 0 || ft.calls["http://redmaple.tree/gtfs-ace"] != 0 {
+		t.Errorf("expected only the 42 St Shuttle feed to be fetched, got %v", ft.calls)
+	}
+
+	if got := client.LinesAtStop("H11"); slices.Contains(got, subway.HTrain) {
+		t.Errorf("expected Far Rockaway not to be on the Rockaway Park Shuttle, got %v", got)
+	}
+	if got := client.LinesAtStop("S01"); !slices.Equal(got, []subway.TrainLine{subway.FSTrain}) {
+		t.Errorf("expected Franklin Av on the Franklin Av Shuttle, got %v", got)
+	}
+	// the Staten Island Railway shares the S prefix
+	if got := client.LinesAtStop("S09"); len(got) != 0 {
+		t.Errorf("expected Tottenville to have no known lines, got %v", got)
+	}
+}
@@ -1,5 +1,9 @@
 package subway
 
+import (
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+)
+
 type TrainLine string
 
 const (
@@ -25,10 +29,15 @@ const (
 	RTrain       TrainLine = "R"
 	WTrain       TrainLine = "W"
 	ZTrain       TrainLine = "Z"
-	STrain       TrainLine = "S"
+	GSTrain      TrainLine = "GS" // 42 St Shuttle
+	FSTrain      TrainLine = "FS" // Franklin Av Shuttle
+	HTrain       TrainLine = "H"  // Rockaway Park Shuttle
 	UnknownTrain TrainLine = "n/a"
 )
 
+// Shuttles are the lines signed as the S. Each has its own route and stations.
+var Shuttles = []TrainLine{GSTrain, FSTrain, HTrain}
+
 func ParseTrainLine(s string) TrainLine {
 	switch s {
 	case "1":
@@ -75,8 +84,13 @@ func ParseTrainLine(s string) TrainLine {
 		return WTrain
 	case "Z":
 		return ZTrain
-	case "S":
-		return STrain
+	// S alone is the best known shuttle, between Times Sq and Grand Central
+	case "GS", "S":
+		return GSTrain
+	case "FS":
+		return FSTrain
+	case "H":
+		return HTrain
 	default:
 		return UnknownTrain
 	}
@@ -99,13 +113,43 @@ const (
 )
 
 type StopUpdate struct {
+	NyctTrip
+	NyctTrack
+	TripID      string
 	Stop        SubwayStop
-	Arrival     *TripUpdate_StopTimeEvent
-	Departure   *TripUpdate_StopTimeEvent
+	Line        TrainLine
+	Arrival     *gtfsrt.TripUpdate_StopTimeEvent
+	Departure   *gtfsrt.TripUpdate_StopTimeEvent
 	Destination SubwayStop
+	// ScheduledTime is the unix timestamp the train is scheduled to arrive
+	// at the stop, or 0 if the trip is not in the static schedule.
+	ScheduledTime int64
+	// Delay is how many seconds the train is behind schedule, negative if it
+	// is early.
+	Delay int64
+}
+
+// ArrivalTime returns the arrival time at the stop as a unix timestamp, or the
+// departure time for the first stop of a trip.
+func (u *StopUpdate) ArrivalTime() int64 {
+	if u.Arrival.GetTime() != 0 {
+		return u.Arrival.GetTime()
+	}
+	return u.Departure.GetTime()
 }
 
 type TrainUpdate struct {
+	NyctTrip
+	// NyctTrack is the track at NextStop, if the feed has a trip update for
+	// the train.
+	NyctTrack
+	TripID   string
 	NextStop SubwayStop
 	IsAtStop bool
+	// Stations are the parent stations of the train's trip, if the trip is
+	// in the static schedule.
+	Stations []string
+	// ScheduledTime and Delay are as for StopUpdate, at NextStop.
+	ScheduledTime int64
+	Delay         int64
 }
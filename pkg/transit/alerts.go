@@ -0,0 +1,129 @@
+package transit
+
+import (
+	"slices"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+)
+
+// Alert is a GTFS-realtime alert about disrupted service. Its routes and
+// stops are the agency's own IDs from the static GTFS.
+type Alert struct {
+	ID          string
+	Header      string
+	Description string
+	// ActivePeriods are the times the alert is in effect. An alert without
+	// any is always in effect.
+	ActivePeriods    []ActivePeriod
+	Effect           gtfsrt.Alert_Effect
+	Cause            gtfsrt.Alert_Cause
+	InformedEntities []InformedEntity
+}
+
+// ActivePeriod is a time range of an alert. A zero Start or End leaves that
+// side of the range open.
+type ActivePeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// InformedEntity is a route, stop or both that an alert is about. An entity
+// with neither applies to the whole agency.
+type InformedEntity struct {
+	RouteID string
+	StopID  string
+}
+
+// ParseAlert converts a feed entity's alert into an Alert.
+func ParseAlert(id string, alert *gtfsrt.Alert) Alert {
+	res := Alert{
+		ID:          id,
+		Header:      translation(alert.GetHeaderText()),
+		Description: translation(alert.GetDescriptionText()),
+		Effect:      alert.GetEffect(),
+		Cause:       alert.GetCause(),
+	}
+	for _, period := range alert.GetActivePeriod() {
+		ap := ActivePeriod{}
+		if period.Start != nil {
+			ap.Start = time.Unix(int64(period.GetStart()), 0)
+		}
+		if period.End != nil {
+			ap.End = time.Unix(int64(period.GetEnd()), 0)
+		}
+		res.ActivePeriods = append(res.ActivePeriods, ap)
+	}
+	for _, entity := range alert.GetInformedEntity() {
+		routeID := entity.GetRouteId()
+		if routeID == "" {
+			routeID = entity.GetTrip().GetRouteId()
+		}
+		res.InformedEntities = append(res.InformedEntities, InformedEntity{RouteID: routeID, StopID: entity.GetStopId()})
+	}
+	return res
+}
+
+// translation picks the English plain text of s, or the first translation if
+// there is no English one.
+func translation(s *gtfsrt.TranslatedString) string {
+	translations := s.GetTranslation()
+	for _, t := range translations {
+		if lang := t.GetLanguage(); lang == "" || lang == "en" {
+			return t.GetText()
+		}
+	}
+	if len(translations) > 0 {
+		return translations[0].GetText()
+	}
+	return ""
+}
+
+// IsActive reports whether the alert is in effect at t.
+func (a Alert) IsActive(t time.Time) bool {
+	if len(a.ActivePeriods) == 0 {
+		return true
+	}
+	for _, period := range a.ActivePeriods {
+		if (period.Start.IsZero() || !t.Before(period.Start)) && (period.End.IsZero() || t.Before(period.End)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Affects reports whether the alert is about any of routeIDs or any of
+// stopIDs.
+func (a Alert) Affects(routeIDs, stopIDs []string) bool {
+	// alerts without informed entities are agency-wide
+	if len(a.InformedEntities) == 0 {
+		return true
+	}
+	for _, entity := range a.InformedEntities {
+		switch {
+		case entity.RouteID == "" && entity.StopID == "":
+			return true
+		case entity.RouteID == "":
+			if slices.Contains(stopIDs, entity.StopID) {
+				return true
+			}
+		case slices.Contains(routeIDs, entity.RouteID):
+			if entity.StopID == "" || slices.Contains(stopIDs, entity.StopID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterAlerts returns the alerts that are active at t and affect any of
+// routeIDs or stopIDs.
+func FilterAlerts(alerts []Alert, routeIDs, stopIDs []string, t time.Time) []Alert {
+	res := []Alert{}
+	for _, alert := range alerts {
+		if alert.IsActive(t) && alert.Affects(routeIDs, stopIDs) {
+			res = append(res, alert)
+		}
+	}
+	return res
+}
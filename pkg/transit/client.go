@@ -0,0 +1,261 @@
+// Package transit reads the GTFS-realtime feeds of any agency, such as the
+// LIRR, Metro-North or NYC Ferry, using the agency's static GTFS zip to name
+// the stops, routes and trips in them.
+package transit
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+)
+
+type Client interface {
+	// GetTripsAtStop returns the upcoming trips at stopID, or at any of its
+	// platforms if it is a station, ordered by arrival, and the active alerts
+	// about the stop or the routes serving it.
+	GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []Alert, error)
+	// GetAlerts returns every active alert in the feeds.
+	GetAlerts(ctx context.Context) ([]Alert, error)
+	GetStop(stopID string) (Stop, bool)
+	GetRoute(routeID string) (Route, bool)
+}
+
+type ClientImpl struct {
+	httpClient   *http.Client
+	static       *Static
+	feedURLs     []string
+	header       http.Header
+	pollInterval time.Duration
+	feeds        *gtfsrt.FeedManager
+	now          func() time.Time
+}
+
+var _ Client = (*ClientImpl)(nil)
+
+type Option func(*ClientImpl)
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *ClientImpl) {
+		c.httpClient = client
+	}
+}
+
+// WithFeedURLs sets the GTFS-realtime feeds of the agency. Trips and alerts
+// are read from all of them.
+func WithFeedURLs(urls ...string) Option {
+	return func(c *ClientImpl) {
+		c.feedURLs = urls
+	}
+}
+
+// WithAPIKey sends key in the named header with every feed request.
+func WithAPIKey(header, key string) Option {
+	return func(c *ClientImpl) {
+		c.header.Set(header, key)
+	}
+}
+
+// WithPollInterval sets how long a downloaded feed is used before it is
+// downloaded again.
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *ClientImpl) {
+		c.pollInterval = interval
+	}
+}
+
+// WithClock sets the clock used to decide which alerts are active.
+func WithClock(now func() time.Time) Option {
+	return func(c *ClientImpl) {
+		c.now = now
+	}
+}
+
+// NewClient creates a client for the agency described by static, as loaded by
+// OpenStatic or LoadStatic.
+func NewClient(static *Static, opts ...Option) *ClientImpl {
+	c := &ClientImpl{
+		httpClient: http.DefaultClient,
+		static:     static,
+		header:     http.Header{},
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	feedOpts := []gtfsrt.FeedManagerOption{}
+	if c.pollInterval > 0 {
+		feedOpts = append(feedOpts, gtfsrt.WithPollInterval(c.pollInterval))
+	}
+	for key := range c.header {
+		feedOpts = append(feedOpts, gtfsrt.WithFeedHeader(key, c.header.Get(key)))
+	}
+	c.feeds = gtfsrt.NewFeedManager("transit", c.httpClient, feedOpts...)
+	return c
+}
+
+// StopUpdate is a trip's predicted arrival at a stop.
+type StopUpdate struct {
+	Stop   Stop
+	Route  Route
+	TripID string
+	// Headsign is where the trip is going, from trips.txt or else the name
+	// of its last stop in the feed.
+	Headsign string
+	// Arrival is the predicted arrival as a unix timestamp, or the departure
+	// for the first stop of a trip.
+	Arrival int64
+	// Delay is how many seconds the trip is behind schedule according to the
+	// feed, negative if it is early.
+	Delay int64
+}
+
+func (c *ClientImpl) GetStop(stopID string) (Stop, bool) {
+	stop, ok := c.static.Stops[stopID]
+	return stop, ok
+}
+
+func (c *ClientImpl) GetRoute(routeID string) (Route, bool) {
+	route, ok := c.static.Routes[routeID]
+	return route, ok
+}
+
+func (c *ClientImpl) GetTripsAtStop(ctx context.Context, stopID string) ([]*StopUpdate, []Alert, error) {
+	feeds, err := c.getFeeds(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stopIDs := c.static.StopIDs(stopID)
+	routeIDs := []string{}
+	for _, id := range stopIDs {
+		routeIDs = append(routeIDs, c.static.StopRoutes[id]...)
+	}
+	res := []*StopUpdate{}
+	alerts := []Alert{}
+	for _, feed := range feeds {
+		for _, entity := range feed.Entity {
+			if entity.GetIsDeleted() || entity.TripUpdate == nil {
+				continue
+			}
+			if update := c.tripAtStop(entity.TripUpdate, stopIDs); update != nil {
+				res = append(res, update)
+				routeIDs = append(routeIDs, update.Route.ID)
+			}
+		}
+		alerts = appendAlerts(alerts, feed)
+	}
+
+	slices.SortStableFunc(res, func(a, b *StopUpdate) int {
+		return cmp.Compare(a.Arrival, b.Arrival)
+	})
+	return res, FilterAlerts(alerts, routeIDs, stopIDs, c.now()), nil
+}
+
+func (c *ClientImpl) GetAlerts(ctx context.Context) ([]Alert, error) {
+	feeds, err := c.getFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	alerts := []Alert{}
+	for _, feed := range feeds {
+		alerts = appendAlerts(alerts, feed)
+	}
+	res := []Alert{}
+	for _, alert := range alerts {
+		if alert.IsActive(c.now()) {
+			res = append(res, alert)
+		}
+	}
+	return res, nil
+}
+
+// getFeeds downloads every feed of the agency. Feeds that fail are skipped
+// unless all of them do.
+func (c *ClientImpl) getFeeds(ctx context.Context) ([]*gtfsrt.FeedMessage, error) {
+	if len(c.feedURLs) == 0 {
+		return nil, errors.New("no realtime feeds configured")
+	}
+	feeds := []*gtfsrt.FeedMessage{}
+	errs := []error{}
+	for _, url := range c.feedURLs {
+		feed, err := c.feeds.Get(ctx, url)
+		if err != nil {
+			slog.Warn("failed to get transit feed", "url", url, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		feeds = append(feeds, feed)
+	}
+	if len(errs) == len(c.feedURLs) {
+		return nil, errors.Join(errs...)
+	}
+	return feeds, nil
+}
+
+// tripAtStop returns the predicted arrival of trip at any of stopIDs, or nil
+// if it does not stop at them.
+func (c *ClientImpl) tripAtStop(trip *gtfsrt.TripUpdate, stopIDs []string) *StopUpdate {
+	if trip.GetTrip().GetScheduleRelationship() == gtfsrt.TripDescriptor_CANCELED {
+		return nil
+	}
+	for _, stopTimeUpdate := range trip.StopTimeUpdate {
+		if !slices.Contains(stopIDs, stopTimeUpdate.GetStopId()) ||
+			stopTimeUpdate.GetScheduleRelationship() == gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED {
+			continue
+		}
+		event := stopTimeUpdate.GetArrival()
+		if event.GetTime() == 0 {
+			event = stopTimeUpdate.GetDeparture()
+		}
+		if event.GetTime() == 0 {
+			// predictions given only as a delay need the static stop times
+			return nil
+		}
+
+		tripID := trip.GetTrip().GetTripId()
+		static := c.static.Trips[tripID]
+		routeID := cmp.Or(trip.GetTrip().GetRouteId(), static.RouteID)
+		route, ok := c.static.Routes[routeID]
+		if !ok {
+			route = Route{ID: routeID}
+		}
+		update := &StopUpdate{
+			Stop:     c.static.Stops[stopTimeUpdate.GetStopId()],
+			Route:    route,
+			TripID:   tripID,
+			Headsign: static.Headsign,
+			Arrival:  event.GetTime(),
+			Delay:    int64(event.GetDelay()),
+		}
+		if event.Delay == nil {
+			update.Delay = int64(trip.GetDelay())
+		}
+		if update.Headsign == "" {
+			last := trip.StopTimeUpdate[len(trip.StopTimeUpdate)-1]
+			update.Headsign = c.static.Stops[last.GetStopId()].Name
+		}
+		return update
+	}
+	return nil
+}
+
+// appendAlerts adds the alerts in feed to alerts, skipping any that are
+// already there because they are in more than one feed.
+func appendAlerts(alerts []Alert, feed *gtfsrt.FeedMessage) []Alert {
+	for _, entity := range feed.Entity {
+		if entity.GetIsDeleted() || entity.Alert == nil {
+			continue
+		}
+		alert := ParseAlert(entity.GetId(), entity.Alert)
+		if !slices.ContainsFunc(alerts, func(a Alert) bool { return a.ID != "" && a.ID == alert.ID }) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
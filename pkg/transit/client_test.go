@@ -0,0 +1,307 @@
+package transit_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	gtfsrt "github.com/mpoegel/red-maple/pkg/gtfsrt"
+	transit "github.com/mpoegel/red-maple/pkg/transit"
+	proto "google.golang.org/protobuf/proto"
+)
+
+const (
+	trainsURL = "http://redmaple.tree/lirr"
+	alertsURL = "http://redmaple.tree/lirr-alerts"
+)
+
+// gtfsFiles describe two branches leaving from a station with two platforms.
+var gtfsFiles = map[string]string{
+	"stops.txt": "stop_id,stop_code,stop_name,stop_lat,stop_lon,parent_station\n" +
+		"PSN,PSN,Penn Station,40.750580,-73.993580,\n" +
+		"PSN1,PSN,Penn Station Track 1,40.750580,-73.993580,PSN\n" +
+		"PSN2,PSN,Penn Station Track 2,40.750580,-73.993580,PSN\n" +
+		"JAM,JAM,Jamaica,40.699768,-73.808136,\n" +
+		"BTA,BTA,Babylon,40.700661,-73.323685,\n" +
+		"HEM,HEM,Hempstead,40.713008,-73.625046,\n",
+	"routes.txt": "route_id,agency_id,route_short_name,route_long_name,route_color\n" +
+		"1,LI,,Babylon Branch,00985F\n" +
+		"2,LI,,Hempstead Branch,CE8E00\n" +
+		"3,LI,,Port Washington Branch,C60C30\n",
+	"trips.txt": "route_id,service_id,trip_id,trip_headsign\n" +
+		"1,WKD,T100,Babylon\n" +
+		"2,WKD,T200,\n",
+	"stop_times.txt": "trip_id,arrival_time,departure_time,stop_id,stop_sequence\n" +
+		"T100,08:00:00,08:00:00,PSN1,1\n" +
+		"T100,08:20:00,08:20:00,JAM,2\n" +
+		"T100,09:05:00,09:05:00,BTA,3\n" +
+		"T200,08:10:00,08:10:00,PSN2,1\n" +
+		"T200,08:30:00,08:30:00,JAM,2\n" +
+		"T200,09:00:00,09:00:00,HEM,3\n",
+}
+
+// writeGTFSZip writes files into a GTFS zip and returns its path.
+func writeGTFSZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "gtfs.zip")
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create zip: %v", err)
+	}
+	defer fp.Close()
+	archive := zip.NewWriter(fp)
+	for name, data := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+		w.Write([]byte(data))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+	return path
+}
+
+// staticFS is files as the contents of an unzipped GTFS zip.
+func staticFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, data := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return fsys
+}
+
+// feedTransport serves feeds by URL, failing for any other URL, and records
+// the API key of each request.
+type feedTransport struct {
+	feeds   map[string]*gtfsrt.FeedMessage
+	apiKeys []string
+}
+
+func (f *feedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.apiKeys = append(f.apiKeys, req.Header.Get("x-api-key"))
+	feed, ok := f.feeds[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+	}
+	body, err := proto.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(body))}, nil
+}
+
+func stopTime(stopID string, arrival, departure int64) *gtfsrt.TripUpdate_StopTimeUpdate {
+	update := &gtfsrt.TripUpdate_StopTimeUpdate{StopId: proto.String(stopID)}
+	if arrival != 0 {
+		update.Arrival = &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(arrival)}
+	}
+	if departure != 0 {
+		update.Departure = &gtfsrt.TripUpdate_StopTimeEvent{Time: proto.Int64(departure)}
+	}
+	return update
+}
+
+func tripEntity(tripID, routeID string, stopTimes ...*gtfsrt.TripUpdate_StopTimeUpdate) *gtfsrt.FeedEntity {
+	trip := &gtfsrt.TripDescriptor{TripId: proto.String(tripID)}
+	if routeID != "" {
+		trip.RouteId = proto.String(routeID)
+	}
+	return &gtfsrt.FeedEntity{
+		Id:         proto.String(tripID),
+		TripUpdate: &gtfsrt.TripUpdate{Trip: trip, StopTimeUpdate: stopTimes},
+	}
+}
+
+func alertEntity(id, routeID, stopID string, periods ...*gtfsrt.TimeRange) *gtfsrt.FeedEntity {
+	entity := &gtfsrt.EntitySelector{}
+	if routeID != "" {
+		entity.RouteId = proto.String(routeID)
+	}
+	if stopID != "" {
+		entity.StopId = proto.String(stopID)
+	}
+	return &gtfsrt.FeedEntity{
+		Id: proto.String(id),
+		Alert: &gtfsrt.Alert{
+			ActivePeriod:   periods,
+			InformedEntity: []*gtfsrt.EntitySelector{entity},
+			HeaderText: &gtfsrt.TranslatedString{Translation: []*gtfsrt.TranslatedString_Translation{
+				{Text: proto.String(id)},
+			}},
+		},
+	}
+}
+
+func feedMessage(entities ...*gtfsrt.FeedEntity) *gtfsrt.FeedMessage {
+	return &gtfsrt.FeedMessage{
+		Header: &gtfsrt.FeedHeader{GtfsRealtimeVersion: proto.String("2.0")},
+		Entity: entities,
+	}
+}
+
+func alertIDs(alerts []transit.Alert) []string {
+	ids := []string{}
+	for _, alert := range alerts {
+		ids = append(ids, alert.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestOpenStatic(t *testing.T) {
+	static, err := transit.OpenStatic(writeGTFSZip(t, gtfsFiles))
+	if err != nil {
+		t.Fatalf("OpenStatic error: %v", err)
+	}
+	if got := static.Stops["PSN1"]; got.Name != "Penn Station Track 1" || got.ParentStation != "PSN" {
+		t.Errorf("unexpected stop PSN1: %+v", got)
+	}
+	if got := static.Routes["1"]; got.Name() != "Babylon Branch" || got.Color != "00985F" {
+		t.Errorf("unexpected route 1: %+v", got)
+	}
+	if got, want := static.StopRoutes["JAM"], []string{"1", "2"}; !slices.Equal(got, want) {
+		t.Errorf("routes at JAM = %v, want %v", got, want)
+	}
+	if got, want := static.StopIDs("PSN"), []string{"PSN", "PSN1", "PSN2"}; !slices.Equal(got, want) {
+		t.Errorf("StopIDs(PSN) = %v, want %v", got, want)
+	}
+
+	files := map[string]string{}
+	for name, data := range gtfsFiles {
+		if name != "routes.txt" {
+			files[name] = data
+		}
+	}
+	if _, err := transit.OpenStatic(writeGTFSZip(t, files)); err == nil {
+		t.Error("expected an error for a zip without routes.txt")
+	}
+}
+
+func TestGetTripsAtStop(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	static, err := transit.OpenStatic(writeGTFSZip(t, gtfsFiles))
+	if err != nil {
+		t.Fatalf("OpenStatic error: %v", err)
+	}
+
+	late := tripEntity("T100", "1", stopTime("PSN1", 0, now.Unix()+600), stopTime("BTA", now.Unix()+4500, 0))
+	late.TripUpdate.StopTimeUpdate[0].Departure.Delay = proto.Int32(120)
+	// the route and headsign of T200 are only in the static data
+	noRoute := tripEntity("T200", "", stopTime("PSN2", now.Unix()+300, 0), stopTime("HEM", now.Unix()+3300, 0))
+	noRoute.TripUpdate.Delay = proto.Int32(60)
+	canceled := tripEntity("T300", "1", stopTime("PSN1", now.Unix()+900, 0))
+	canceled.TripUpdate.Trip.ScheduleRelationship = gtfsrt.TripDescriptor_CANCELED.Enum()
+	skipped := tripEntity("T400", "1", stopTime("PSN1", now.Unix()+1200, 0), stopTime("JAM", now.Unix()+2400, 0))
+	skipped.TripUpdate.StopTimeUpdate[0].ScheduleRelationship = gtfsrt.TripUpdate_StopTimeUpdate_SKIPPED.Enum()
+
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{
+		trainsURL: feedMessage(late, noRoute, canceled, skipped),
+		alertsURL: feedMessage(
+			alertEntity("babylon", "1", ""),
+			alertEntity("port-washington", "3", ""),
+			alertEntity("track-1", "", "PSN1"),
+			alertEntity("jamaica", "", "JAM"),
+		),
+	}}
+	client := transit.NewClient(static,
+		transit.WithHTTPClient(&http.Client{Transport: ft}),
+		transit.WithFeedURLs(trainsURL, alertsURL, "http://redmaple.tree/down"),
+		transit.WithAPIKey("x-api-key", "secret"),
+		transit.WithClock(func() time.Time { return now }),
+	)
+
+	updates, alerts, err := client.GetTripsAtStop(t.Context(), "PSN")
+	if err != nil {
+		t.Fatalf("GetTripsAtStop error: %v", err)
+	}
+	if len(updates) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(updates))
+	}
+	first, second := updates[0], updates[1]
+	if first.TripID != "T200" || first.Route.Name() != "Hempstead Branch" || first.Headsign != "Hempstead" || first.Delay != 60 {
+		t.Errorf("unexpected first update: %+v", first)
+	}
+	if first.Stop.ID != "PSN2" || first.Arrival != now.Unix()+300 {
+		t.Errorf("expected arrival at PSN2 in 5 minutes, got %s at %d", first.Stop.ID, first.Arrival)
+	}
+	if second.TripID != "T100" || second.Headsign != "Babylon" || second.Delay != 120 || second.Arrival != now.Unix()+600 {
+		t.Errorf("unexpected second update: %+v", second)
+	}
+	if got, want := alertIDs(alerts), []string{"babylon", "track-1"}; !slices.Equal(got, want) {
+		t.Errorf("alerts = %v, want %v", got, want)
+	}
+	for _, key := range ft.apiKeys {
+		if key != "secret" {
+			t.Errorf("expected the API key on every request, got %q", key)
+		}
+	}
+}
+
+func TestGetTripsAtStop_FeedsDown(t *testing.T) {
+	static, err := transit.LoadStatic(staticFS(gtfsFiles))
+	if err != nil {
+		t.Fatalf("LoadStatic error: %v", err)
+	}
+	client := transit.NewClient(static,
+		transit.WithHTTPClient(&http.Client{Transport: &feedTransport{}}),
+		transit.WithFeedURLs(trainsURL),
+	)
+	if _, _, err := client.GetTripsAtStop(t.Context(), "PSN"); err == nil {
+		t.Error("expected an error when every feed is down")
+	}
+}
+
+func TestGetAlerts(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	static, err := transit.LoadStatic(staticFS(gtfsFiles))
+	if err != nil {
+		t.Fatalf("LoadStatic error: %v", err)
+	}
+	expired := &gtfsrt.TimeRange{Start: proto.Uint64(uint64(now.Unix() - 7200)), End: proto.Uint64(uint64(now.Unix() - 3600))}
+	ft := &feedTransport{feeds: map[string]*gtfsrt.FeedMessage{
+		trainsURL: feedMessage(alertEntity("babylon", "1", ""), alertEntity("expired", "2", "", expired)),
+		// the same alert can be in more than one feed
+		alertsURL: feedMessage(alertEntity("babylon", "1", "")),
+	}}
+	client := transit.NewClient(static,
+		transit.WithHTTPClient(&http.Client{Transport: ft}),
+		transit.WithFeedURLs(trainsURL, alertsURL),
+		transit.WithClock(func() time.Time { return now }),
+	)
+
+	alerts, err := client.GetAlerts(t.Context())
+	if err != nil {
+		t.Fatalf("GetAlerts error: %v", err)
+	}
+	if got, want := alertIDs(alerts), []string{"babylon"}; !slices.Equal(got, want) {
+		t.Errorf("alerts = %v, want %v", got, want)
+	}
+}
+
+func TestParseAlert(t *testing.T) {
+	entity := alertEntity("shuttle", "GS", "631")
+	entity.Alert.InformedEntity = append(entity.Alert.InformedEntity, &gtfsrt.EntitySelector{
+		Trip: &gtfsrt.TripDescriptor{RouteId: proto.String("SB")},
+	})
+
+	alert := transit.ParseAlert(entity.GetId(), entity.Alert)
+	want := []transit.InformedEntity{{RouteID: "GS", StopID: "631"}, {RouteID: "SB"}}
+	if !slices.Equal(alert.InformedEntities, want) {
+		t.Errorf("expected informed entities %v, got %v", want, alert.InformedEntities)
+	}
+	if alert.Header != "shuttle" {
+		t.Errorf("expected header %q, got %q", "shuttle", alert.Header)
+	}
+	if !alert.Affects([]string{"GS"}, []string{"631"}) || alert.Affects([]string{"S"}, []string{"635"}) {
+		t.Error("expected the alert to match the agency's own route IDs only")
+	}
+}
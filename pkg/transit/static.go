@@ -0,0 +1,198 @@
+package transit
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Static is the part of an agency's static GTFS data that the client needs to
+// describe realtime trips.
+type Static struct {
+	Stops  map[string]Stop
+	Routes map[string]Route
+	Trips  map[string]Trip
+	// StopRoutes are the IDs of the routes stopping at each stop, if the
+	// static data has stop times.
+	StopRoutes map[string][]string
+}
+
+type Stop struct {
+	ID            string
+	Name          string
+	Latitude      float64
+	Longitude     float64
+	ParentStation string
+}
+
+type Route struct {
+	ID        string
+	ShortName string
+	LongName  string
+	// Color is the hex color of the route without the leading #, if set.
+	Color string
+}
+
+// Name returns the name riders know the route by.
+func (r Route) Name() string {
+	if r.ShortName != "" {
+		return r.ShortName
+	}
+	if r.LongName != "" {
+		return r.LongName
+	}
+	return r.ID
+}
+
+type Trip struct {
+	ID       string
+	RouteID  string
+	Headsign string
+}
+
+// OpenStatic loads the static GTFS zip at path.
+func OpenStatic(path string) (*Static, error) {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	return LoadStatic(archive)
+}
+
+// LoadStatic reads stops.txt, routes.txt and trips.txt from the root of fsys,
+// and stop_times.txt if it is there.
+func LoadStatic(fsys fs.FS) (*Static, error) {
+	static := &Static{
+		Stops:      map[string]Stop{},
+		Routes:     map[string]Route{},
+		Trips:      map[string]Trip{},
+		StopRoutes: map[string][]string{},
+	}
+
+	err := readCSV(fsys, "stops.txt", []string{"stop_id"}, []string{"stop_name", "stop_lat", "stop_lon", "parent_station"}, func(row []string) error {
+		stop := Stop{ID: row[0], Name: row[1], ParentStation: row[4]}
+		if row[2] != "" || row[3] != "" {
+			lat, err1 := strconv.ParseFloat(row[2], 64)
+			lon, err2 := strconv.ParseFloat(row[3], 64)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("stops.txt: stop %s: %w", row[0], errors.Join(err1, err2))
+			}
+			stop.Latitude, stop.Longitude = lat, lon
+		}
+		static.Stops[stop.ID] = stop
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readCSV(fsys, "routes.txt", []string{"route_id"}, []string{"route_short_name", "route_long_name", "route_color"}, func(row []string) error {
+		static.Routes[row[0]] = Route{ID: row[0], ShortName: row[1], LongName: row[2], Color: row[3]}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readCSV(fsys, "trips.txt", []string{"trip_id", "route_id"}, []string{"trip_headsign"}, func(row []string) error {
+		static.Trips[row[0]] = Trip{ID: row[0], RouteID: row[1], Headsign: row[2]}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// stop times are only used to find the routes at each stop, so feeds work
+	// without them
+	err = readCSV(fsys, "stop_times.txt", []string{"trip_id", "stop_id"}, nil, func(row []string) error {
+		trip, ok := static.Trips[row[0]]
+		if ok && !slices.Contains(static.StopRoutes[row[1]], trip.RouteID) {
+			static.StopRoutes[row[1]] = append(static.StopRoutes[row[1]], trip.RouteID)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return static, nil
+}
+
+// StopIDs returns stopID, its parent station and the stops whose parent
+// station it is, so that asking about a station includes all of its platforms
+// and alerts about a station apply to its platforms.
+func (s *Static) StopIDs(stopID string) []string {
+	ids := []string{stopID}
+	if parent := s.Stops[stopID].ParentStation; parent != "" {
+		ids = append(ids, parent)
+	}
+	for _, stop := range s.Stops {
+		if stop.ParentStation == stopID {
+			ids = append(ids, stop.ID)
+		}
+	}
+	slices.Sort(ids[1:])
+	return ids
+}
+
+// readCSV calls fn with the values of the required and then the optional
+// columns of every row of the named file. Optional columns missing from the
+// file are empty.
+func readCSV(fsys fs.FS, name string, required, optional []string, fn func(row []string) error) error {
+	fp, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	reader := csv.NewReader(fp)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	// some exports start with a byte order mark
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	columns := slices.Concat(required, optional)
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = slices.Index(header, column)
+		if indexes[i] < 0 && i < len(required) {
+			return fmt.Errorf("%s: missing column %s", name, column)
+		}
+	}
+
+	row := make([]string, len(columns))
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		for i, index := range indexes {
+			row[i] = ""
+			if index >= 0 && index < len(record) {
+				row[i] = strings.TrimSpace(record[index])
+			} else if i < len(required) {
+				return fmt.Errorf("%s: row is missing %s", name, columns[i])
+			}
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
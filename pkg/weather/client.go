@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+
+	metrics "github.com/mpoegel/red-maple/pkg/metrics"
 )
 
 const (
@@ -69,8 +71,10 @@ func (c *ClientImpl) GetWeather(ctx context.Context) (*WeatherData, error) {
 	slog.Debug("getting weather")
 	if c.lastData != nil && time.Since(c.lastUpdate) < weatherTTL {
 		slog.Debug("using cached weather data")
+		metrics.CacheLookups.Inc("weather", "hit")
 		return c.lastData, nil
 	}
+	metrics.CacheLookups.Inc("weather", "miss")
 
 	uri := fmt.Sprintf("%s/data/3.0/onecall?lat=%f&lon=%f&appid=%s&units=%s", c.baseURL, c.lat, c.lon, c.apiKey, defaultUnits)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
@@ -103,8 +107,10 @@ func (c *ClientImpl) GetPollution(ctx context.Context) (*PollutionData, error) {
 	slog.Debug("getting pollution")
 	if c.lastPollutionData != nil && time.Since(c.lastPollutionUpdate) < pollutionTTL {
 		slog.Debug("using cached pollution data")
+		metrics.CacheLookups.Inc("pollution", "hit")
 		return c.lastPollutionData, nil
 	}
+	metrics.CacheLookups.Inc("pollution", "miss")
 
 	uri := fmt.Sprintf("%s/data/2.5/air_pollution?lat=%f&lon=%f&appid=%s", c.baseURL, c.lat, c.lon, c.apiKey)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)